@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"cmp"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/mikemrm/masscan-exporter/internal/agent"
+	"github.com/mikemrm/masscan-exporter/internal/masscan"
+	"github.com/rs/zerolog"
+	"github.com/spf13/cobra"
+)
+
+var agentCmd = cobra.Command{
+	Use:   "agent",
+	Short: "Runs scans dispatched by a central exporter",
+	Run:   runAgent,
+}
+
+func runAgent(cmd *cobra.Command, _ []string) {
+	ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	logger := zerolog.Ctx(ctx).With().Str("component", "agent").Logger()
+
+	ctx = logger.WithContext(ctx)
+
+	cfg := getConfig(ctx)
+
+	a, err := agent.New(ctx, agent.WithConfig(cfg.Agent))
+	if err != nil {
+		logger.Fatal().Err(err).Msg("failed to initialize agent")
+	}
+
+	tempDir := cmp.Or(cfg.Agent.Masscan.TempDir, masscan.DefaultTempDir)
+
+	if err := masscan.CleanTempDir(ctx, tempDir); err != nil {
+		logger.Warn().Err(err).Msgf("failed to clean temp dir %s", tempDir)
+	}
+
+	defer func() {
+		if err := masscan.RemoveWorkDirs(); err != nil {
+			logger.Warn().Err(err).Msg("failed to remove work dirs")
+		}
+	}()
+
+	if !cfg.Probe.Disabled && cfg.Agent.Masscan.Helper == "" {
+		caps, err := masscan.Probe(ctx, cfg.Agent.Masscan, cfg.Probe)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("masscan is unusable")
+		}
+
+		if caps.PacketErr != nil {
+			logger.Warn().Err(caps.PacketErr).Str("version", caps.Version).Msg("masscan failed to send a test packet, scans may fail")
+		} else {
+			logger.Info().Str("command", caps.Command()).Str("version", caps.Version).Msg("masscan probed")
+		}
+	}
+
+	logger.Info().Msgf("Listening on %s", cfg.Agent.Listen)
+
+	if err := a.ListenAndServe(ctx); err != nil {
+		logger.Fatal().Err(err).Msg("error serving agent")
+	}
+}
+
+func init() {
+	agentCmd.Flags().String("agent.listen", agent.DefaultListen, "listen address for the agent api")
+
+	RootCmd.AddCommand(&agentCmd)
+}
@@ -7,8 +7,14 @@ import (
 	"strings"
 
 	"github.com/go-viper/mapstructure/v2"
+	"github.com/mikemrm/masscan-exporter/internal/agent"
+	"github.com/mikemrm/masscan-exporter/internal/budget"
 	"github.com/mikemrm/masscan-exporter/internal/collector"
 	"github.com/mikemrm/masscan-exporter/internal/exporter"
+	"github.com/mikemrm/masscan-exporter/internal/helper"
+	"github.com/mikemrm/masscan-exporter/internal/masscan"
+	"github.com/mikemrm/masscan-exporter/internal/scheduler"
+	"github.com/mikemrm/masscan-exporter/internal/state"
 	"github.com/rs/zerolog"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
@@ -23,9 +29,17 @@ type ctxConfigKey struct{}
 var configKey = ctxConfigKey{}
 
 type config struct {
-	LogLevel   zerolog.Level      `mapstructure:"loglevel"`
-	Collectors []collector.Config `mapstructure:"collectors"`
-	Exporter   exporter.Config    `mapstructure:"exporter"`
+	LogLevel   zerolog.Level       `mapstructure:"loglevel"`
+	Collectors []collector.Config  `mapstructure:"collectors"`
+	PortGroups masscan.PortGroups  `mapstructure:"port_groups"`
+	Exporter   exporter.Config     `mapstructure:"exporter"`
+	State      state.Config        `mapstructure:"state"`
+	Budget     budget.Config       `mapstructure:"budget"`
+	Scheduler  scheduler.Config    `mapstructure:"scheduler"`
+	Probe      masscan.ProbeConfig `mapstructure:"probe"`
+	Helper     helper.Config       `mapstructure:"helper"`
+	Agent      agent.Config        `mapstructure:"agent"`
+	Agents     []agent.Remote      `mapstructure:"agents"`
 	Server     struct {
 		Listen                 string `mapstructure:"listen"`
 		UnhealthyFailedScrapes *int   `mapstructure:"unhealthy_failed_scrapes"`
@@ -46,6 +60,7 @@ func initialize(cmd *cobra.Command, _ []string) {
 
 	v.BindPFlags(cmd.Root().Flags())
 	v.BindPFlags(cmd.Root().PersistentFlags())
+	v.BindPFlags(cmd.Flags())
 
 	v.AutomaticEnv()
 
@@ -2,11 +2,25 @@ package cmd
 
 import (
 	"bytes"
+	"cmp"
+	"context"
+	"errors"
 	"net/http"
+	"os"
+	"os/signal"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
 
+	"github.com/mikemrm/masscan-exporter/internal/agent"
+	"github.com/mikemrm/masscan-exporter/internal/budget"
 	"github.com/mikemrm/masscan-exporter/internal/collector"
 	"github.com/mikemrm/masscan-exporter/internal/exporter"
+	"github.com/mikemrm/masscan-exporter/internal/masscan"
+	"github.com/mikemrm/masscan-exporter/internal/scheduler"
+	"github.com/mikemrm/masscan-exporter/internal/state"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/rs/zerolog"
@@ -14,7 +28,8 @@ import (
 )
 
 func runExporter(cmd *cobra.Command, _ []string) {
-	ctx := cmd.Context()
+	ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
 	logger := zerolog.Ctx(ctx)
 
@@ -32,8 +47,60 @@ func runExporter(cmd *cobra.Command, _ []string) {
 		collectorLogger.Warn().Msg("no collectors configured")
 	}
 
+	if err := cfg.PortGroups.Validate(); err != nil {
+		collectorLogger.Fatal().Err(err).Msg("failed to load port groups")
+	}
+
+	cleanTempDirs(ctx, cfg)
+
+	if !cfg.Probe.Disabled {
+		cfg.Exporter.Masscan = probeMasscan(ctx, cfg)
+	}
+
+	var store *state.Store
+
+	if cfg.State.Dir != "" {
+		var err error
+
+		store, err = state.New(ctx, state.WithConfig(cfg.State))
+		if err != nil {
+			logger.Fatal().Err(err).Msg("failed to initialize state store")
+		}
+	}
+
+	var rateBudget *budget.Budget
+
+	if cfg.Budget.MaxRate > 0 {
+		var err error
+
+		rateBudget, err = budget.New(ctx, budget.WithConfig(cfg.Budget))
+		if err != nil {
+			logger.Fatal().Err(err).Msg("failed to initialize rate budget")
+		}
+	}
+
+	if cfg.Scheduler.MaxConcurrent > 0 {
+		var err error
+
+		cfg.Exporter.Scheduler, err = scheduler.New(ctx, scheduler.WithConfig(cfg.Scheduler))
+		if err != nil {
+			logger.Fatal().Err(err).Msg("failed to initialize scheduler")
+		}
+	}
+
 	for _, colCfg := range cfg.Collectors {
-		collector, err := collector.NewCollector(ctx, collector.WithConfig(colCfg))
+		colCfg.Masscan.PortGroups = cfg.PortGroups
+
+		if colCfg.Agent != "" {
+			colCfg.Scanner = newAgentScanner(ctx, cfg, colCfg)
+		}
+
+		collector, err := collector.NewCollector(ctx,
+			collector.WithConfig(colCfg),
+			collector.WithStore(store),
+			collector.WithBudget(rateBudget),
+			collector.WithScheduler(cfg.Exporter.Scheduler),
+		)
 		if err != nil {
 			collectorLogger.Fatal().
 				Err(err).
@@ -76,6 +143,16 @@ func runExporter(cmd *cobra.Command, _ []string) {
 			out.WriteString("[-]config not ok\n")
 		}
 
+		// Masscan is only probed on start, so a failed packet check is reported for information
+		// without marking the exporter unready, as nothing would make it ready again.
+		for _, caps := range cfg.Exporter.Masscan {
+			if caps.PacketErr == nil {
+				out.WriteString("[+]masscan " + caps.Command() + " ok (version " + caps.Version + ")\n")
+			} else {
+				out.WriteString("[+]masscan " + caps.Command() + " ok (version " + caps.Version + ", test packet failed on start: " + caps.PacketErr.Error() + ")\n")
+			}
+		}
+
 		if *cfg.Server.UnhealthyFailedScrapes > 0 {
 			for _, collector := range cfg.Exporter.Collectors {
 				if collector.FailedScrapes() < *cfg.Server.UnhealthyFailedScrapes {
@@ -95,11 +172,127 @@ func runExporter(cmd *cobra.Command, _ []string) {
 		w.Write(out.Bytes())
 	}))
 
+	server := &http.Server{
+		Addr:    cfg.Server.Listen,
+		Handler: mux,
+	}
+
+	go func() {
+		<-ctx.Done()
+
+		server.Close()
+	}()
+
 	serverLogger.Info().Msgf("Listening on %s", cfg.Server.Listen)
 
-	if err := http.ListenAndServe(cfg.Server.Listen, mux); err != nil {
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 		serverLogger.Fatal().Err(err).Msg("error starting server")
 	}
+
+	// Running scans must finish before their work dirs are removed.
+	var wg sync.WaitGroup
+
+	for _, collector := range cfg.Exporter.Collectors {
+		wg.Go(collector.Stop)
+	}
+
+	wg.Wait()
+
+	if err := masscan.RemoveWorkDirs(); err != nil {
+		logger.Warn().Err(err).Msg("failed to remove work dirs")
+	}
+}
+
+// probeMasscan probes each distinct masscan command used by the collectors, exiting if any are unusable.
+// Collectors which run masscan through the helper or an agent are not probed, they probe their own binary.
+func probeMasscan(ctx context.Context, cfg config) []masscan.Capabilities {
+	logger := zerolog.Ctx(ctx)
+
+	var (
+		probed   []masscan.Capabilities
+		commands []string
+	)
+
+	for _, colCfg := range cfg.Collectors {
+		if colCfg.Backend != "" && colCfg.Backend != collector.BackendMasscan || colCfg.Masscan.Helper != "" || colCfg.Agent != "" {
+			continue
+		}
+
+		masscanCfg := masscan.Config{
+			BinPath:  cmp.Or(colCfg.Masscan.BinPath, masscan.DefaultBinPath),
+			Launcher: colCfg.Masscan.Launcher,
+		}
+
+		command := strings.Join(append(slices.Clone(masscanCfg.Launcher), masscanCfg.BinPath), " ")
+
+		if slices.Contains(commands, command) {
+			continue
+		}
+
+		commands = append(commands, command)
+
+		caps, err := masscan.Probe(ctx, masscanCfg, cfg.Probe)
+		if err != nil {
+			logger.Fatal().Err(err).Str("command", command).Msg("masscan is unusable")
+		}
+
+		if caps.PacketErr != nil {
+			logger.Warn().Err(caps.PacketErr).Str("command", command).Str("version", caps.Version).Msg("masscan failed to send a test packet, scans may fail")
+		} else {
+			logger.Info().Str("command", command).Str("version", caps.Version).Bool("packet_checked", caps.PacketChecked).Msg("masscan probed")
+		}
+
+		probed = append(probed, caps)
+	}
+
+	return probed
+}
+
+// cleanTempDirs removes files left in each distinct temp_dir of the collectors by previous runs which did not exit cleanly.
+func cleanTempDirs(ctx context.Context, cfg config) {
+	logger := zerolog.Ctx(ctx)
+
+	var cleaned []string
+
+	for _, colCfg := range cfg.Collectors {
+		if colCfg.Backend != "" && colCfg.Backend != collector.BackendMasscan || colCfg.Agent != "" {
+			continue
+		}
+
+		tempDir := cmp.Or(colCfg.Masscan.TempDir, masscan.DefaultTempDir)
+
+		if slices.Contains(cleaned, tempDir) {
+			continue
+		}
+
+		cleaned = append(cleaned, tempDir)
+
+		if err := masscan.CleanTempDir(ctx, tempDir); err != nil {
+			logger.Warn().Err(err).Msgf("failed to clean temp dir %s", tempDir)
+		}
+	}
+}
+
+// newAgentScanner returns the scanner which dispatches the collector's scans to its agent, exiting if it is not configured.
+func newAgentScanner(ctx context.Context, cfg config, colCfg collector.Config) collector.Scanner {
+	logger := zerolog.Ctx(ctx)
+
+	for _, remote := range cfg.Agents {
+		if remote.Name != colCfg.Agent {
+			continue
+		}
+
+		scanner, err := agent.NewScanner(ctx, remote, colCfg.Name, colCfg.Masscan)
+		if err != nil {
+			logger.Fatal().Err(err).Msgf("failed to initialize agent %s for collector %s", remote.Name, colCfg.Name)
+		}
+
+		return scanner
+	}
+
+	logger.Fatal().Err(collector.ErrUnknownAgent).Msgf("agent %s for collector %s is not configured", colCfg.Agent, colCfg.Name)
+
+	return nil
 }
 
 func init() {
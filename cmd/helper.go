@@ -0,0 +1,59 @@
+package cmd
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/mikemrm/masscan-exporter/internal/helper"
+	"github.com/mikemrm/masscan-exporter/internal/masscan"
+	"github.com/rs/zerolog"
+	"github.com/spf13/cobra"
+)
+
+var helperCmd = cobra.Command{
+	Use:   "helper",
+	Short: "Runs masscan for an unprivileged exporter over a unix socket",
+	Run:   runHelper,
+}
+
+func runHelper(cmd *cobra.Command, _ []string) {
+	ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	logger := zerolog.Ctx(ctx).With().Str("component", "helper").Logger()
+
+	ctx = logger.WithContext(ctx)
+
+	cfg := getConfig(ctx)
+
+	h, err := helper.New(ctx, helper.WithConfig(cfg.Helper))
+	if err != nil {
+		logger.Fatal().Err(err).Msg("failed to initialize helper")
+	}
+
+	if !cfg.Probe.Disabled {
+		caps, err := masscan.Probe(ctx, masscan.Config{BinPath: cfg.Helper.BinPath}, cfg.Probe)
+		if err != nil {
+			logger.Fatal().Err(err).Msg("masscan is unusable")
+		}
+
+		if caps.PacketErr != nil {
+			logger.Warn().Err(caps.PacketErr).Str("version", caps.Version).Msg("masscan failed to send a test packet, scans may fail")
+		} else {
+			logger.Info().Str("bin_path", caps.BinPath).Str("version", caps.Version).Msg("masscan probed")
+		}
+	}
+
+	logger.Info().Msgf("Listening on %s", cfg.Helper.Socket)
+
+	if err := h.ListenAndServe(ctx); err != nil {
+		logger.Fatal().Err(err).Msg("error serving helper")
+	}
+}
+
+func init() {
+	helperCmd.Flags().String("helper.socket", helper.DefaultSocket, "unix socket the helper listens on")
+
+	RootCmd.AddCommand(&helperCmd)
+}
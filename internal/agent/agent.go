@@ -0,0 +1,244 @@
+// Package agent runs scans from remote vantage points on behalf of a central exporter.
+//
+// The agent exposes an authenticated http api which runs masscan with the config sent by the exporter,
+// and responds with the report. The exporter dispatches scans with a Scanner.
+package agent
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/mikemrm/masscan-exporter/internal/masscan"
+	"github.com/mikemrm/masscan-exporter/internal/scheduler"
+	"github.com/rs/zerolog"
+)
+
+const (
+	scanPath = "/v1/scan"
+
+	// maxRequestSize limits the size of a scan request.
+	maxRequestSize = 4 << 20
+)
+
+// ScanRequest asks the agent to run a scan with the masscan config.
+type ScanRequest struct {
+	// Collector is the name of the collector which dispatched the scan.
+	Collector string         `json:"collector"`
+	Masscan   masscan.Config `json:"masscan"`
+	// MaxRate overrides the configured max rate when greater than 0.
+	MaxRate int `json:"max_rate,omitempty"`
+}
+
+// ScanResponse is the result of a scan, the report is returned even if the scan failed.
+type ScanResponse struct {
+	Report masscan.Report `json:"report"`
+	Error  string         `json:"error,omitempty"`
+	// Reason classifies the error, see masscan.ErrorReason.
+	Reason string `json:"reason,omitempty"`
+}
+
+type Agent struct {
+	logger    *zerolog.Logger
+	cfg       Config
+	token     string
+	scheduler *scheduler.Scheduler
+}
+
+// Handler returns the agent's http api.
+func (a *Agent) Handler() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.Handle("POST "+scanPath, a.authorize(http.HandlerFunc(a.handleScan)))
+	mux.Handle("/livez", http.HandlerFunc(func(_ http.ResponseWriter, _ *http.Request) {}))
+
+	return mux
+}
+
+// ListenAndServe serves the agent's api until the context is canceled, returning once running scans have finished.
+func (a *Agent) ListenAndServe(ctx context.Context) error {
+	server := &http.Server{
+		Addr:    a.cfg.Listen,
+		Handler: a.Handler(),
+		BaseContext: func(_ net.Listener) context.Context {
+			return ctx
+		},
+	}
+
+	shutdown := make(chan struct{})
+
+	go func() {
+		defer close(shutdown)
+
+		<-ctx.Done()
+
+		// Requests share the canceled context, so running scans are interrupted and waited for.
+		server.Shutdown(context.WithoutCancel(ctx))
+	}()
+
+	var err error
+
+	if a.cfg.TLSCert != "" {
+		err = server.ListenAndServeTLS(a.cfg.TLSCert, a.cfg.TLSKey)
+	} else {
+		err = server.ListenAndServe()
+	}
+
+	if errors.Is(err, http.ErrServerClosed) {
+		<-shutdown
+
+		return nil
+	}
+
+	return err
+}
+
+func (a *Agent) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(a.token)) != 1 {
+			a.logger.Warn().Str("remote", r.RemoteAddr).Msg("unauthorized request")
+
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (a *Agent) handleScan(w http.ResponseWriter, r *http.Request) {
+	var req ScanRequest
+
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestSize)).Decode(&req); err != nil {
+		a.respond(w, http.StatusBadRequest, masscan.Report{Partial: true}, fmt.Errorf("%w: failed to decode request: %w", masscan.ErrInvalidOption, err))
+
+		return
+	}
+
+	logger := a.logger.With().Str("collector", req.Collector).Str("remote", r.RemoteAddr).Logger()
+
+	ctx := logger.WithContext(r.Context())
+
+	cfg, err := a.scanConfig(req.Masscan)
+	if err != nil {
+		logger.Warn().Err(err).Msg("scan rejected")
+
+		a.respond(w, http.StatusBadRequest, masscan.Report{Partial: true}, err)
+
+		return
+	}
+
+	scanner, err := masscan.New(ctx, masscan.WithConfig(cfg))
+	if err != nil {
+		logger.Warn().Err(err).Msg("scan rejected")
+
+		a.respond(w, http.StatusBadRequest, masscan.Report{Partial: true}, err)
+
+		return
+	}
+
+	if a.scheduler != nil {
+		slot, err := a.scheduler.Acquire(ctx, req.Collector, 0)
+		if err != nil {
+			a.respond(w, http.StatusOK, masscan.Report{Partial: true}, masscan.ContextError(ctx, fmt.Errorf("waiting for scheduler: %w", err)))
+
+			return
+		}
+
+		defer slot.Release()
+	}
+
+	var opts []masscan.RunOption
+
+	if req.MaxRate > 0 {
+		opts = append(opts, masscan.WithMaxRate(req.MaxRate))
+	}
+
+	logger.Info().Msg("scan started")
+
+	report, err := scanner.Run(ctx, opts...)
+	if err != nil {
+		logger.Err(err).Str("reason", masscan.ErrorReason(err)).Msg("scan failed")
+	} else {
+		logger.Info().Msg("scan completed")
+	}
+
+	a.respond(w, http.StatusOK, report, err)
+}
+
+// scanConfig replaces the options local to the agent, rejecting options which reference the agent's files.
+func (a *Agent) scanConfig(cfg masscan.Config) (masscan.Config, error) {
+	switch {
+	case cfg.ConfigPath != "":
+		return cfg, fmt.Errorf("%w: config_path is not supported by agents", masscan.ErrInvalidOption)
+	case cfg.Resume:
+		return cfg, fmt.Errorf("%w: resume is not supported by agents", masscan.ErrInvalidOption)
+	case cfg.Dynamic():
+		return cfg, fmt.Errorf("%w: values must be loaded before they are sent to agents", masscan.ErrInvalidOption)
+	}
+
+	cfg.TempDir = a.cfg.Masscan.TempDir
+	cfg.BinPath = a.cfg.Masscan.BinPath
+	cfg.WaitDelay = a.cfg.Masscan.WaitDelay
+	cfg.Launcher = a.cfg.Masscan.Launcher
+	cfg.Helper = a.cfg.Masscan.Helper
+	cfg.ResumeDir = ""
+	cfg.Resolver = nil
+
+	return cfg, nil
+}
+
+func (a *Agent) respond(w http.ResponseWriter, status int, report masscan.Report, err error) {
+	resp := ScanResponse{
+		Report: report,
+	}
+
+	if err != nil {
+		resp.Error = err.Error()
+		resp.Reason = masscan.ErrorReason(err)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		a.logger.Warn().Err(err).Msg("failed to write scan response")
+	}
+}
+
+func New(ctx context.Context, opts ...Option) (*Agent, error) {
+	cfg := newConfig(opts...)
+
+	token, err := cfg.Token.GetValue(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%w for token: %w", masscan.ErrLoadValue, err)
+	}
+
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return nil, ErrTokenRequired
+	}
+
+	agent := &Agent{
+		logger: zerolog.Ctx(ctx),
+		cfg:    cfg,
+		token:  token,
+	}
+
+	if cfg.MaxConcurrent > 0 {
+		agent.scheduler, err = scheduler.New(ctx, scheduler.WithMaxConcurrent(cfg.MaxConcurrent))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return agent, nil
+}
@@ -0,0 +1,162 @@
+package agent_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mikemrm/masscan-exporter/internal/agent"
+	"github.com/mikemrm/masscan-exporter/internal/masscan"
+	"github.com/mikemrm/masscan-exporter/internal/masscan/masscantest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testToken = "secret"
+
+func TestMain(m *testing.M) {
+	masscantest.Main(m)
+}
+
+// newTestAgent starts an in-process agent running the simulator, returning the remote for it.
+func newTestAgent(t *testing.T, sim *masscantest.Simulator) agent.Remote {
+	t.Helper()
+
+	a, err := agent.New(t.Context(),
+		agent.WithToken(testToken),
+		agent.WithMasscan(masscan.Config{
+			BinPath:   sim.Path(),
+			TempDir:   t.TempDir(),
+			WaitDelay: time.Second,
+		}),
+	)
+	require.NoError(t, err, "no error expected creating agent")
+
+	server := httptest.NewServer(a.Handler())
+
+	t.Cleanup(server.Close)
+
+	return agent.Remote{
+		Name:  "remote",
+		URL:   server.URL,
+		Token: masscan.DynamicValue[string]{Value: testToken},
+	}
+}
+
+func TestScanner_Run(t *testing.T) {
+	t.Parallel()
+
+	sim := masscantest.New(t, masscantest.Scenario{
+		Results: []masscan.RawResult{
+			{IP: "10.0.0.1", Timestamp: "1745695800", Ports: []masscan.RawPort{{Port: masscan.Port{Port: 80, Proto: "tcp", Status: "open"}}}},
+		},
+	})
+
+	rangesFile := filepath.Join(t.TempDir(), "ranges.json")
+	require.NoError(t, os.WriteFile(rangesFile, []byte(`["10.0.0.0/24"]`), 0600), "no error expected writing ranges")
+
+	scanner, err := agent.NewScanner(t.Context(), newTestAgent(t, sim), "test", masscan.Config{
+		BinPath: "/not/used/by/the/agent",
+		Ranges:  masscan.DynamicValue[[]string]{File: rangesFile},
+		Ports:   masscan.DynamicValue[[]string]{Value: []string{"80"}},
+	})
+	require.NoError(t, err, "no error expected creating scanner")
+
+	report, err := scanner.Run(t.Context(), masscan.WithMaxRate(250))
+	require.NoError(t, err, "no error expected running scan on agent")
+
+	assert.Equal(t, "remote", report.Vantage, "expected report vantage to be the agent")
+	assert.False(t, report.Partial, "expected report to be complete")
+	assert.Equal(t, []string{"10.0.0.0/24"}, report.Ranges, "expected ranges to be loaded by the exporter")
+	assert.Len(t, report.Results, 1, "unexpected number of hosts")
+
+	invocations := sim.Invocations(t)
+	require.Len(t, invocations, 1, "expected masscan to be executed once by the agent")
+
+	assert.Contains(t, invocations[0].Args, "10.0.0.0/24", "expected ranges to be passed")
+	assert.Contains(t, invocations[0].Args, "250", "expected max rate to be passed")
+}
+
+func TestScanner_Run_Failure(t *testing.T) {
+	t.Parallel()
+
+	sim := masscantest.New(t, masscantest.Scenario{
+		Stderr:   "FAIL: could not determine default interface\n",
+		NoOutput: true,
+		ExitCode: 1,
+	})
+
+	scanner, err := agent.NewScanner(t.Context(), newTestAgent(t, sim), "test", masscan.Config{
+		Ranges: masscan.DynamicValue[[]string]{Value: []string{"10.0.0.0/24"}},
+		Ports:  masscan.DynamicValue[[]string]{Value: []string{"80"}},
+	})
+	require.NoError(t, err, "no error expected creating scanner")
+
+	report, err := scanner.Run(t.Context())
+	require.ErrorIs(t, err, masscan.ErrExit, "expected the agent's error reason to be kept")
+
+	assert.ErrorContains(t, err, "could not determine default interface", "expected masscan output in error")
+	assert.Equal(t, "remote", report.Vantage, "expected report vantage to be the agent")
+	assert.True(t, report.Partial, "expected report to be partial")
+}
+
+func TestScanner_Run_Timeout(t *testing.T) {
+	t.Parallel()
+
+	sim := masscantest.New(t, masscantest.Scenario{
+		Delay: time.Minute,
+	})
+
+	scanner, err := agent.NewScanner(t.Context(), newTestAgent(t, sim), "test", masscan.Config{
+		Ranges: masscan.DynamicValue[[]string]{Value: []string{"10.0.0.0/24"}},
+		Ports:  masscan.DynamicValue[[]string]{Value: []string{"80"}},
+	})
+	require.NoError(t, err, "no error expected creating scanner")
+
+	ctx, cancel := context.WithTimeout(t.Context(), 200*time.Millisecond)
+	defer cancel()
+
+	_, err = scanner.Run(ctx)
+	require.ErrorIs(t, err, masscan.ErrTimeout, "expected timeout error")
+}
+
+func TestScanner_Run_Unauthorized(t *testing.T) {
+	t.Parallel()
+
+	sim := masscantest.New(t, masscantest.Scenario{})
+
+	remote := newTestAgent(t, sim)
+	remote.Token = masscan.DynamicValue[string]{Value: "wrong"}
+
+	scanner, err := agent.NewScanner(t.Context(), remote, "test", masscan.Config{
+		Ranges: masscan.DynamicValue[[]string]{Value: []string{"10.0.0.0/24"}},
+	})
+	require.NoError(t, err, "no error expected creating scanner")
+
+	_, err = scanner.Run(t.Context())
+	require.ErrorIs(t, err, agent.ErrAgentUnavailable, "expected unauthorized request to fail")
+
+	assert.ErrorContains(t, err, http.StatusText(http.StatusUnauthorized), "expected unauthorized status in error")
+	assert.Empty(t, sim.Invocations(t), "expected masscan to not be executed")
+}
+
+func TestAgent_Rejected(t *testing.T) {
+	t.Parallel()
+
+	sim := masscantest.New(t, masscantest.Scenario{})
+
+	remote := newTestAgent(t, sim)
+
+	_, err := agent.NewScanner(t.Context(), remote, "test", masscan.Config{ConfigPath: "/etc/masscan.conf"})
+	require.ErrorIs(t, err, masscan.ErrInvalidOption, "expected config_path to be rejected")
+
+	_, err = agent.NewScanner(t.Context(), agent.Remote{Name: "remote", URL: remote.URL}, "test", masscan.Config{})
+	require.ErrorIs(t, err, agent.ErrTokenRequired, "expected token to be required")
+
+	_, err = agent.New(t.Context())
+	require.ErrorIs(t, err, agent.ErrTokenRequired, "expected agent token to be required")
+}
@@ -0,0 +1,104 @@
+package agent
+
+import (
+	"errors"
+
+	"github.com/mikemrm/masscan-exporter/internal/masscan"
+)
+
+// DefaultListen is the address the agent listens on when not configured.
+const DefaultListen = ":9188"
+
+var (
+	ErrTokenRequired = errors.New("agent token required")
+	ErrNameRequired  = errors.New("agent name required")
+	ErrURLRequired   = errors.New("agent url required")
+)
+
+// Config configures the agent which runs scans for a central exporter.
+type Config struct {
+	Listen string `mapstructure:"listen"`
+
+	// Token authenticates the exporter, it must be sent as a bearer token with each request.
+	Token masscan.DynamicValue[string] `mapstructure:"token"`
+
+	// TLSCert and TLSKey serve the agent over https when set.
+	TLSCert string `mapstructure:"tls_cert"`
+	TLSKey  string `mapstructure:"tls_key"`
+
+	// MaxConcurrent is the number of scans which may run at the same time, unlimited when 0.
+	MaxConcurrent int `mapstructure:"max_concurrent"`
+
+	// Masscan sets the options which are local to the agent: temp_dir, bin_path, wait_delay, launcher and helper.
+	// They replace the options sent with each scan.
+	Masscan masscan.Config `mapstructure:"masscan"`
+}
+
+// Remote configures an agent the exporter dispatches scans to.
+type Remote struct {
+	// Name identifies the agent to collectors and is reported as the vantage of its results.
+	Name  string                       `mapstructure:"name"`
+	URL   string                       `mapstructure:"url"`
+	Token masscan.DynamicValue[string] `mapstructure:"token"`
+}
+
+func (r Remote) validate() error {
+	if r.Name == "" {
+		return ErrNameRequired
+	}
+
+	if r.URL == "" {
+		return ErrURLRequired
+	}
+
+	return nil
+}
+
+func newConfig(opts ...Option) Config {
+	var cfg Config
+
+	for _, opt := range opts {
+		cfg = opt.apply(cfg)
+	}
+
+	if cfg.Listen == "" {
+		cfg.Listen = DefaultListen
+	}
+
+	return cfg
+}
+
+type Option interface {
+	apply(Config) Config
+}
+
+type optionFunc func(Config) Config
+
+func (fn optionFunc) apply(cfg Config) Config {
+	return fn(cfg)
+}
+
+// WithConfig replaces the existing Config.
+func WithConfig(cfg Config) Option {
+	return optionFunc(func(_ Config) Config {
+		return cfg
+	})
+}
+
+// WithToken sets the token the exporter must authenticate with.
+func WithToken(token string) Option {
+	return optionFunc(func(cfg Config) Config {
+		cfg.Token = masscan.DynamicValue[string]{Value: token}
+
+		return cfg
+	})
+}
+
+// WithMasscan sets the masscan options local to the agent.
+func WithMasscan(m masscan.Config) Option {
+	return optionFunc(func(cfg Config) Config {
+		cfg.Masscan = m
+
+		return cfg
+	})
+}
@@ -0,0 +1,134 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/mikemrm/masscan-exporter/internal/masscan"
+	"github.com/rs/zerolog"
+)
+
+var ErrAgentUnavailable = errors.New("agent unavailable")
+
+// Scanner dispatches a collector's scans to a remote agent.
+//
+// The config, ranges, ports and excludes are loaded by the exporter before each scan, hostnames within
+// the ranges are resolved by the agent. Progress and estimates are not reported for remote scans.
+type Scanner struct {
+	remote    Remote
+	collector string
+	cfg       masscan.Config
+	token     string
+	client    *http.Client
+}
+
+// Run sends the scan to the agent and waits for its report.
+// Canceling the context cancels the request, which interrupts the scan on the agent.
+func (s *Scanner) Run(ctx context.Context, opts ...masscan.RunOption) (masscan.Report, error) {
+	logger := zerolog.Ctx(ctx)
+
+	options := masscan.NewRunOptions(opts...)
+
+	failed := masscan.Report{
+		Partial: true,
+		Vantage: s.remote.Name,
+	}
+
+	cfg, err := s.cfg.LoadValues(ctx)
+	if err != nil {
+		return failed, err
+	}
+
+	body, err := json.Marshal(ScanRequest{
+		Collector: s.collector,
+		Masscan:   cfg,
+		MaxRate:   options.MaxRate,
+	})
+	if err != nil {
+		return failed, fmt.Errorf("failed to encode scan request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(s.remote.URL, "/")+scanPath, bytes.NewReader(body))
+	if err != nil {
+		return failed, fmt.Errorf("%w: %w", ErrAgentUnavailable, err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+s.token)
+	req.Header.Set("Content-Type", "application/json")
+
+	logger.Debug().Str("agent", s.remote.Name).Msg("dispatching scan to agent")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return failed, masscan.ContextError(ctx, fmt.Errorf("%w: %s: %w", ErrAgentUnavailable, s.remote.Name, err))
+	}
+
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return failed, masscan.ContextError(ctx, fmt.Errorf("%w: %s: reading response: %w", ErrAgentUnavailable, s.remote.Name, err))
+	}
+
+	var result ScanResponse
+
+	if err := json.Unmarshal(data, &result); err != nil {
+		return failed, fmt.Errorf("%w: %s: %s: %s", ErrAgentUnavailable, s.remote.Name, resp.Status, strings.TrimSpace(string(data)))
+	}
+
+	report := result.Report
+	report.Vantage = s.remote.Name
+
+	if result.Error == "" {
+		return report, nil
+	}
+
+	// Wrap the error classified by the agent, so failures are reported with the same reason as local scans.
+	if reasonErr := masscan.ReasonError(result.Reason); reasonErr != nil {
+		return report, fmt.Errorf("%w: agent %s: %s", reasonErr, s.remote.Name, result.Error)
+	}
+
+	return report, fmt.Errorf("agent %s: %s", s.remote.Name, result.Error)
+}
+
+// NewScanner returns a Scanner which runs the collector's scans with the masscan config on the remote agent.
+func NewScanner(ctx context.Context, remote Remote, collector string, cfg masscan.Config) (*Scanner, error) {
+	if err := remote.validate(); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case cfg.ConfigPath != "":
+		return nil, fmt.Errorf("%w: config_path is not supported by agents", masscan.ErrInvalidOption)
+	case cfg.Resume:
+		return nil, fmt.Errorf("%w: resume is not supported by agents", masscan.ErrInvalidOption)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	token, err := remote.Token.GetValue(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%w for agent %s token: %w", masscan.ErrLoadValue, remote.Name, err)
+	}
+
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return nil, fmt.Errorf("%w: %s", ErrTokenRequired, remote.Name)
+	}
+
+	return &Scanner{
+		remote:    remote,
+		collector: collector,
+		cfg:       cfg,
+		token:     token,
+		client:    &http.Client{},
+	}, nil
+}
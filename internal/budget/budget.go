@@ -0,0 +1,186 @@
+// Package budget shares a packet rate limit between concurrent scans.
+package budget
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+)
+
+var ErrMaxRateRequired = errors.New("budget max rate required")
+
+// Budget allocates packet rates to scans from a shared limit.
+// The limit is divided evenly between the collectors which joined the budget, or the running and queued scans
+// if there are more. Scans are allocated their requested rate, up to their share and whatever remains of the limit,
+// and queue in the order they requested when the remaining rate is below the minimum.
+type Budget struct {
+	cfg Config
+
+	mu           sync.Mutex
+	available    int
+	active       int
+	participants int
+	queue        []*waiter
+}
+
+type waiter struct {
+	requested int
+	ready     chan int
+}
+
+// Allocation is the rate allocated to a scan, it must be released once the scan completes.
+type Allocation struct {
+	budget *Budget
+	rate   int
+	once   sync.Once
+}
+
+// Rate returns the packets per second allocated.
+func (a *Allocation) Rate() int {
+	return a.rate
+}
+
+// Release returns the allocated rate to the budget, allowing queued scans to start.
+func (a *Allocation) Release() {
+	a.once.Do(func() {
+		a.budget.mu.Lock()
+		defer a.budget.mu.Unlock()
+
+		a.budget.active--
+		a.budget.release(a.rate)
+	})
+}
+
+// MaxRate returns the total packets per second shared by all scans.
+func (b *Budget) MaxRate() int {
+	return b.cfg.MaxRate
+}
+
+// Available returns the packets per second which are not allocated.
+func (b *Budget) Available() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.available
+}
+
+// Queued returns the number of scans waiting for an allocation.
+func (b *Budget) Queued() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return len(b.queue)
+}
+
+// Join registers a collector which scans with the budget, so its share is reserved even while it is not scanning.
+// The returned function leaves the budget, it should be called once the collector stops.
+func (b *Budget) Join() func() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.participants++
+
+	var once sync.Once
+
+	return func() {
+		once.Do(func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+
+			b.participants--
+
+			// The shares of queued scans may have grown.
+			b.release(0)
+		})
+	}
+}
+
+// Acquire allocates up to the requested rate, waiting until the minimum rate is available.
+// Requests are capped at the budget's max rate. If ctx is done before the rate is allocated, its error is returned.
+func (b *Budget) Acquire(ctx context.Context, requested int) (*Allocation, error) {
+	requested = min(max(requested, 1), b.cfg.MaxRate)
+
+	w := &waiter{
+		requested: requested,
+		ready:     make(chan int, 1),
+	}
+
+	b.mu.Lock()
+
+	// Scans already queued are served first.
+	b.queue = append(b.queue, w)
+	b.release(0)
+
+	b.mu.Unlock()
+
+	select {
+	case rate := <-w.ready:
+		return &Allocation{budget: b, rate: rate}, nil
+	case <-ctx.Done():
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if i := slices.Index(b.queue, w); i != -1 {
+		b.queue = slices.Delete(b.queue, i, i+1)
+
+		// Removing the head of the queue may allow the next scan to start.
+		b.release(0)
+	} else {
+		// The rate was allocated after ctx was done.
+		b.active--
+		b.release(<-w.ready)
+	}
+
+	return nil, ctx.Err()
+}
+
+// grant allocates the rate for the scan at the head of the queue if enough is available, b.mu must be held.
+// The rate is capped at the scan's share of the limit, which is never below the minimum rate.
+func (b *Budget) grant(requested int) (int, bool) {
+	share := max(b.cfg.MaxRate/max(b.participants, b.active+len(b.queue)), b.cfg.MinRate)
+
+	rate := min(requested, share, b.available)
+
+	if rate < min(requested, b.cfg.MinRate) {
+		return 0, false
+	}
+
+	b.available -= rate
+	b.active++
+
+	return rate, true
+}
+
+// release returns the rate to the budget and allocates it to queued scans, b.mu must be held.
+func (b *Budget) release(rate int) {
+	b.available += rate
+
+	for len(b.queue) != 0 {
+		w := b.queue[0]
+
+		rate, ok := b.grant(w.requested)
+		if !ok {
+			break
+		}
+
+		b.queue = b.queue[1:]
+
+		w.ready <- rate
+	}
+}
+
+func New(_ context.Context, opts ...Option) (*Budget, error) {
+	cfg := newConfig(opts...)
+
+	if cfg.MaxRate <= 0 {
+		return nil, ErrMaxRateRequired
+	}
+
+	return &Budget{
+		cfg:       cfg,
+		available: cfg.MaxRate,
+	}, nil
+}
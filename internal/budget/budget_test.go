@@ -0,0 +1,196 @@
+package budget
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBudget_Acquire(t *testing.T) {
+	t.Parallel()
+
+	b, err := New(t.Context(), WithMaxRate(1000), WithMinRate(200))
+	require.NoError(t, err, "no error expected creating budget")
+
+	first, err := b.Acquire(t.Context(), 600)
+	require.NoError(t, err, "no error expected acquiring rate")
+	assert.Equal(t, 600, first.Rate(), "expected requested rate to be allocated")
+
+	second, err := b.Acquire(t.Context(), 600)
+	require.NoError(t, err, "no error expected acquiring rate")
+	assert.Equal(t, 400, second.Rate(), "expected remaining rate to be allocated")
+
+	assert.Equal(t, 0, b.Available(), "expected budget to be exhausted")
+
+	acquired := make(chan *Allocation)
+
+	go func() {
+		allocation, err := b.Acquire(context.Background(), 5000)
+		assert.NoError(t, err, "no error expected acquiring queued rate")
+
+		acquired <- allocation
+	}()
+
+	require.Eventually(t, func() bool { return b.Queued() == 1 }, time.Second, time.Millisecond, "expected scan to be queued")
+
+	second.Release()
+	second.Release()
+
+	allocation := <-acquired
+	assert.Equal(t, 400, allocation.Rate(), "expected released rate to be allocated to the queued scan")
+
+	allocation.Release()
+	first.Release()
+
+	assert.Equal(t, 1000, b.Available(), "expected all rate to be returned")
+
+	capped, err := b.Acquire(t.Context(), 5000)
+	require.NoError(t, err, "no error expected acquiring rate")
+	assert.Equal(t, 1000, capped.Rate(), "expected request to be capped at the max rate")
+}
+
+func TestBudget_Acquire_MinRate(t *testing.T) {
+	t.Parallel()
+
+	b, err := New(t.Context(), WithMaxRate(1000), WithMinRate(200))
+	require.NoError(t, err, "no error expected creating budget")
+
+	first, err := b.Acquire(t.Context(), 900)
+	require.NoError(t, err, "no error expected acquiring rate")
+
+	small, err := b.Acquire(t.Context(), 50)
+	require.NoError(t, err, "expected requests below the minimum to be allocated when their full rate is available")
+	assert.Equal(t, 50, small.Rate(), "unexpected rate")
+
+	ctx, cancel := context.WithTimeout(t.Context(), 20*time.Millisecond)
+	defer cancel()
+
+	_, err = b.Acquire(ctx, 500)
+	require.ErrorIs(t, err, context.DeadlineExceeded, "expected scan to queue while less than the minimum rate is available")
+
+	assert.Equal(t, 0, b.Queued(), "expected cancelled scan to be removed from the queue")
+
+	first.Release()
+	small.Release()
+
+	assert.Equal(t, 1000, b.Available(), "expected all rate to be returned")
+}
+
+func TestBudget_Acquire_Order(t *testing.T) {
+	t.Parallel()
+
+	// The minimum rate is the full limit, so only one scan runs at a time.
+	b, err := New(t.Context(), WithMaxRate(100), WithMinRate(100))
+	require.NoError(t, err, "no error expected creating budget")
+
+	held, err := b.Acquire(t.Context(), 100)
+	require.NoError(t, err, "no error expected acquiring rate")
+
+	order := make(chan int, 2)
+
+	for i := range 2 {
+		go func() {
+			allocation, err := b.Acquire(context.Background(), 100)
+			assert.NoError(t, err, "no error expected acquiring queued rate")
+
+			order <- i
+
+			allocation.Release()
+		}()
+
+		require.Eventually(t, func() bool { return b.Queued() == i+1 }, time.Second, time.Millisecond, "expected scan to be queued")
+	}
+
+	held.Release()
+
+	assert.Equal(t, 0, <-order, "expected first queued scan to be allocated first")
+	assert.Equal(t, 1, <-order, "expected second queued scan to be allocated second")
+}
+
+func TestBudget_Acquire_Share(t *testing.T) {
+	t.Parallel()
+
+	b, err := New(t.Context(), WithMaxRate(1000), WithMinRate(100))
+	require.NoError(t, err, "no error expected creating budget")
+
+	held, err := b.Acquire(t.Context(), 1000)
+	require.NoError(t, err, "no error expected acquiring rate")
+	assert.Equal(t, 1000, held.Rate(), "expected a single scan to be allocated the full limit")
+
+	allocations := make(chan *Allocation, 2)
+
+	for i := range 2 {
+		go func() {
+			allocation, err := b.Acquire(context.Background(), 1000)
+			assert.NoError(t, err, "no error expected acquiring queued rate")
+
+			allocations <- allocation
+		}()
+
+		require.Eventually(t, func() bool { return b.Queued() == i+1 }, time.Second, time.Millisecond, "expected scan to be queued")
+	}
+
+	held.Release()
+
+	first, second := <-allocations, <-allocations
+
+	assert.Equal(t, 500, first.Rate(), "expected queued scans to share the limit")
+	assert.Equal(t, 500, second.Rate(), "expected queued scans to share the limit")
+
+	first.Release()
+	second.Release()
+
+	assert.Equal(t, 1000, b.Available(), "expected all rate to be returned")
+}
+
+func TestBudget_Join(t *testing.T) {
+	t.Parallel()
+
+	b, err := New(t.Context(), WithMaxRate(1000), WithMinRate(100))
+	require.NoError(t, err, "no error expected creating budget")
+
+	leave := make([]func(), 3)
+
+	for i := range leave {
+		leave[i] = b.Join()
+	}
+
+	first, err := b.Acquire(t.Context(), 1000)
+	require.NoError(t, err, "no error expected acquiring rate")
+	assert.Equal(t, 333, first.Rate(), "expected the limit to be divided between the joined collectors")
+
+	leave[2]()
+	leave[2]()
+
+	second, err := b.Acquire(t.Context(), 1000)
+	require.NoError(t, err, "no error expected acquiring rate")
+	assert.Equal(t, 500, second.Rate(), "expected the share to grow once a collector leaves")
+
+	leave[0]()
+	leave[1]()
+
+	third, err := b.Acquire(t.Context(), 1000)
+	require.NoError(t, err, "no error expected acquiring rate")
+	assert.Equal(t, 167, third.Rate(), "expected the remaining rate to be allocated")
+
+	first.Release()
+	second.Release()
+	third.Release()
+
+	assert.Equal(t, 1000, b.Available(), "expected all rate to be returned")
+}
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+
+	_, err := New(t.Context())
+	require.ErrorIs(t, err, ErrMaxRateRequired, "expected max rate to be required")
+
+	b, err := New(t.Context(), WithMaxRate(50), WithMinRate(100))
+	require.NoError(t, err, "no error expected creating budget")
+
+	assert.Equal(t, 50, b.cfg.MinRate, "expected min rate to be capped at the max rate")
+}
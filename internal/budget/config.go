@@ -0,0 +1,63 @@
+package budget
+
+type Config struct {
+	// MaxRate is the total packets per second shared by all scans, the budget is disabled when 0.
+	MaxRate int `mapstructure:"max_rate"`
+
+	// MinRate is the lowest rate a scan is started with, scans queue until at least this rate is available.
+	// Scans requesting less than MinRate queue until their full rate is available.
+	MinRate int `mapstructure:"min_rate"`
+}
+
+func newConfig(opts ...Option) Config {
+	var cfg Config
+
+	for _, opt := range opts {
+		cfg = opt.apply(cfg)
+	}
+
+	if cfg.MinRate <= 0 {
+		cfg.MinRate = 1
+	}
+
+	if cfg.MaxRate > 0 {
+		cfg.MinRate = min(cfg.MinRate, cfg.MaxRate)
+	}
+
+	return cfg
+}
+
+type Option interface {
+	apply(Config) Config
+}
+
+type optionFunc func(Config) Config
+
+func (fn optionFunc) apply(cfg Config) Config {
+	return fn(cfg)
+}
+
+// WithConfig replaces the existing Config.
+func WithConfig(cfg Config) Option {
+	return optionFunc(func(_ Config) Config {
+		return cfg
+	})
+}
+
+// WithMaxRate sets the total packets per second shared by all scans.
+func WithMaxRate(rate int) Option {
+	return optionFunc(func(cfg Config) Config {
+		cfg.MaxRate = rate
+
+		return cfg
+	})
+}
+
+// WithMinRate sets the lowest rate a scan is started with.
+func WithMinRate(rate int) Option {
+	return optionFunc(func(cfg Config) Config {
+		cfg.MinRate = rate
+
+		return cfg
+	})
+}
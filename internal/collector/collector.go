@@ -2,16 +2,28 @@ package collector
 
 import (
 	"context"
+	"fmt"
+	"maps"
+	"slices"
 	"strconv"
 	"sync"
 	"time"
 
 	"github.com/adhocore/gronx"
+	"github.com/mikemrm/masscan-exporter/internal/budget"
+	"github.com/mikemrm/masscan-exporter/internal/connect"
 	"github.com/mikemrm/masscan-exporter/internal/masscan"
+	"github.com/mikemrm/masscan-exporter/internal/scheduler"
+	"github.com/mikemrm/masscan-exporter/internal/state"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/rs/zerolog"
 )
 
+// Scanner runs a scan and reports the results.
+type Scanner interface {
+	Run(ctx context.Context, opts ...masscan.RunOption) (masscan.Report, error)
+}
+
 type Collector struct {
 	logger zerolog.Logger
 
@@ -19,21 +31,69 @@ type Collector struct {
 	schedule    string
 	scanOnStart bool
 	startDelay  time.Duration
-	masscan     *masscan.Masscan
+	scanner     Scanner
 	timeout     time.Duration
+	store       *state.Store
+
+	refuseOverlap bool
+
+	scheduler *scheduler.Scheduler
+	priority  int
+
+	budget        *budget.Budget
+	requestedRate int
+	leaveBudget   func()
 
 	mu sync.RWMutex
 
-	collecting    bool
+	collecting bool
+	queued     bool
+	progress   *masscan.Progress
+	stats      scrapeStats
+	lastReport *masscan.Report
+	changes    []masscan.PortChange
+	start      time.Time
+	cache      []prometheus.Metric
+	nextScrape time.Time
+	nextCache  []prometheus.Metric
+
+	// ctx is canceled by Stop to interrupt running scans, wg tracks the scheduling goroutine.
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// scrapeStats tracks the outcomes of the collector's scrapes.
+type scrapeStats struct {
 	totalSuccess  int
 	totalFailures int
 	failedScrapes int
-	start         time.Time
-	cache         []prometheus.Metric
-	nextScrape    time.Time
-	nextCache     []prometheus.Metric
+	scrapeErrors  map[string]int
+	portChanges   map[string]int
+}
+
+func newScrapeStats() scrapeStats {
+	stats := scrapeStats{
+		scrapeErrors: make(map[string]int),
+		portChanges: map[string]int{
+			masscan.ChangeOpened: 0,
+			masscan.ChangeClosed: 0,
+		},
+	}
+
+	// Report every reason from the start so alerts on increases see the first failure.
+	for _, reason := range masscan.ErrorReasons() {
+		stats.scrapeErrors[reason] = 0
+	}
 
-	doneCh chan struct{}
+	return stats
+}
+
+func (s scrapeStats) clone() scrapeStats {
+	s.scrapeErrors = maps.Clone(s.scrapeErrors)
+	s.portChanges = maps.Clone(s.portChanges)
+
+	return s
 }
 
 func (c *Collector) Name() string {
@@ -52,7 +112,7 @@ func (c *Collector) run() error {
 		return err
 	}
 
-	go func() {
+	c.wg.Go(func() {
 		if c.scanOnStart {
 			nextTick = time.Now()
 
@@ -73,7 +133,7 @@ func (c *Collector) run() error {
 		for {
 			select {
 			case <-time.After(time.Until(nextTick)):
-			case <-c.doneCh:
+			case <-c.ctx.Done():
 				return
 			}
 
@@ -90,7 +150,7 @@ func (c *Collector) run() error {
 
 				select {
 				case <-time.After(time.Minute):
-				case <-c.doneCh:
+				case <-c.ctx.Done():
 					return
 				}
 			}
@@ -103,55 +163,152 @@ func (c *Collector) run() error {
 
 			c.mu.Unlock()
 		}
-	}()
+	})
 
 	return nil
 }
 
+// Stop stops scheduling scans and interrupts any running scan, returning once it has finished.
 func (c *Collector) Stop() {
-	close(c.doneCh)
+	c.cancel()
+
+	c.wg.Wait()
+
+	if c.leaveBudget != nil {
+		c.leaveBudget()
+	}
 }
 
 func (c *Collector) refresh() {
 	c.mu.Lock()
 
 	c.collecting = true
-	totalSuccess := c.totalSuccess
-	totalFailures := c.totalFailures
-	failedScrapes := c.failedScrapes
+	c.progress = nil
+	stats := c.stats.clone()
+	lastReport := c.lastReport
 
 	c.mu.Unlock()
 
 	start := time.Now()
 
-	result := c.doCollection()
+	report, err := c.doCollection()
 	duration := time.Since(start)
 
-	if result == 0 {
-		totalFailures++
-		failedScrapes++
+	var (
+		result  float64
+		changes []masscan.PortChange
+	)
+
+	if err != nil {
+		stats.totalFailures++
+		stats.failedScrapes++
+		stats.scrapeErrors[masscan.ErrorReason(err)]++
 	} else {
-		totalSuccess++
-		failedScrapes = 0
+		result = 1
+		stats.totalSuccess++
+		stats.failedScrapes = 0
+
+		// Partial reports are missing results, comparing them would report ports as closed which were not scanned.
+		if !report.Partial {
+			if lastReport != nil {
+				changes = masscan.DiffReports(*lastReport, report)
+			}
+
+			lastReport = &report
+		}
+
+		c.save(state.Entry{
+			Start:        start,
+			Duration:     duration,
+			TotalSuccess: stats.totalSuccess,
+			Report:       report,
+		})
+	}
+
+	for _, change := range changes {
+		stats.portChanges[change.Change]++
+
+		c.logger.Info().
+			Str("ip", change.IP).
+			Int("port", change.Port).
+			Str("proto", change.Proto).
+			Msgf("port %s", change.Change)
 	}
 
+	c.addScrapeMetrics(stats, result, start, duration)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.collecting = false
+	c.progress = nil
+	c.stats = stats
+	c.lastReport = lastReport
+	c.changes = changes
+	c.start = start
+	c.cache = c.nextCache
+	c.nextCache = nil
+}
+
+// addScrapeMetrics adds the metrics describing the outcome of a scrape.
+func (c *Collector) addScrapeMetrics(stats scrapeStats, result float64, start time.Time, duration time.Duration) {
 	c.addMetric(descScrapeSuccess, prometheus.GaugeValue, result, c.name)
 	c.addMetric(descScrapeStart, prometheus.CounterValue, float64(start.UnixNano())/float64(time.Second), c.name)
 	c.addMetric(descScrapeSeconds, prometheus.GaugeValue, float64(duration)/float64(time.Second), c.name)
-	c.addMetric(descScrapesTotal, prometheus.CounterValue, float64(totalSuccess), c.name, "success")
-	c.addMetric(descScrapesTotal, prometheus.CounterValue, float64(totalFailures), c.name, "failed")
-	c.addMetric(descScrapesFailed, prometheus.GaugeValue, float64(failedScrapes), c.name)
+	c.addMetric(descScrapesTotal, prometheus.CounterValue, float64(stats.totalSuccess), c.name, "success")
+	c.addMetric(descScrapesTotal, prometheus.CounterValue, float64(stats.totalFailures), c.name, "failed")
+	c.addMetric(descScrapesFailed, prometheus.GaugeValue, float64(stats.failedScrapes), c.name)
+
+	for reason, count := range stats.scrapeErrors {
+		c.addMetric(descScrapeErrors, prometheus.CounterValue, float64(count), c.name, reason)
+	}
+
+	for change, count := range stats.portChanges {
+		c.addMetric(descPortChanges, prometheus.CounterValue, float64(count), c.name, change)
+	}
+}
+
+// save writes the entry to the state store if one is configured.
+func (c *Collector) save(entry state.Entry) {
+	if c.store == nil {
+		return
+	}
+
+	if err := c.store.Save(c.logger.WithContext(context.Background()), c.name, entry); err != nil {
+		c.logger.Warn().Err(err).Msg("failed to save report")
+	}
+}
+
+// restore rebuilds the metrics from the latest saved report so they are available before the first scan completes.
+func (c *Collector) restore(ctx context.Context) {
+	entry, err := c.store.Latest(ctx, c.name)
+	if err != nil {
+		c.logger.Warn().Err(err).Msg("failed to load saved report")
+
+		return
+	}
+
+	if entry == nil {
+		return
+	}
 
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	c.collecting = false
-	c.totalSuccess = totalSuccess
-	c.totalFailures = totalFailures
-	c.failedScrapes = failedScrapes
-	c.start = start
+	c.stats.totalSuccess = entry.TotalSuccess
+	c.start = entry.Start
+
+	if !entry.Report.Partial {
+		c.lastReport = &entry.Report
+	}
+
+	c.addReportMetrics(entry.Report)
+	c.addScrapeMetrics(c.stats, 1, entry.Start, entry.Duration)
+
 	c.cache = c.nextCache
 	c.nextCache = nil
+
+	c.logger.Info().Msgf("restored report from scan started at %s", entry.Start.Format(time.RFC3339))
 }
 
 func (c *Collector) Collect(ch chan<- prometheus.Metric) {
@@ -172,6 +329,36 @@ func (c *Collector) Collect(ch chan<- prometheus.Metric) {
 		ch <- metric
 	}
 
+	if c.scheduler != nil || c.budget != nil {
+		var queued float64
+
+		if c.queued {
+			queued = 1
+		}
+
+		if metric := c.buildMetric(descScrapeQueued, prometheus.GaugeValue, queued, c.name); metric != nil {
+			ch <- metric
+		}
+	}
+
+	if c.collecting && c.progress != nil {
+		progressMetrics := []struct {
+			desc  *prometheus.Desc
+			value float64
+		}{
+			{descProgressPercent, c.progress.Percent},
+			{descProgressRate, c.progress.Rate},
+			{descProgressFound, float64(c.progress.Found)},
+			{descProgressETA, c.progress.Remaining.Seconds()},
+		}
+
+		for _, m := range progressMetrics {
+			if metric := c.buildMetric(m.desc, prometheus.GaugeValue, m.value, c.name); metric != nil {
+				ch <- metric
+			}
+		}
+	}
+
 	if !c.nextScrape.IsZero() {
 		nextScrape := float64(c.nextScrape.UnixNano()) / float64(time.Second)
 		if metric := c.buildMetric(descScrapeNextStart, prometheus.GaugeValue, nextScrape, c.name); metric != nil {
@@ -180,7 +367,7 @@ func (c *Collector) Collect(ch chan<- prometheus.Metric) {
 	}
 }
 
-func (c *Collector) doCollection() float64 {
+func (c *Collector) doCollection() (masscan.Report, error) {
 	c.logger.Info().Msg("collection started")
 
 	start := time.Now()
@@ -189,38 +376,213 @@ func (c *Collector) doCollection() float64 {
 		c.logger.Info().Msgf("finished collecting in %s", time.Since(start))
 	}()
 
-	ctx := context.Background()
+	ctx := c.ctx
 
 	if c.timeout > 0 {
 		var cancel func()
 
-		ctx, cancel = context.WithTimeout(context.Background(), c.timeout)
+		ctx, cancel = context.WithTimeout(ctx, c.timeout)
 
 		defer cancel()
 	}
 
-	report, err := c.masscan.Run(c.logger.WithContext(ctx))
+	opts := []masscan.RunOption{
+		masscan.WithProgress(c.setProgress),
+		masscan.WithEstimate(c.checkEstimate(start)),
+	}
+
+	if c.scheduler != nil {
+		slot, err := c.waitForSlot(ctx)
+		if err != nil {
+			c.logger.Err(err).Str("reason", masscan.ErrorReason(err)).Msg("failed to start scan")
+
+			return masscan.Report{Partial: true}, err
+		}
+
+		defer slot.Release()
+	}
+
+	if c.budget != nil {
+		allocation, err := c.acquireRate(ctx)
+		if err != nil {
+			c.logger.Err(err).Str("reason", masscan.ErrorReason(err)).Msg("failed to allocate rate")
+
+			return masscan.Report{Partial: true}, err
+		}
+
+		defer allocation.Release()
+
+		opts = append(opts, masscan.WithMaxRate(allocation.Rate()))
+	}
+
+	report, err := c.scanner.Run(c.logger.WithContext(ctx), opts...)
+
+	for _, shard := range report.Shards {
+		var value float64
+
+		if shard.Success {
+			value = 1
+		}
+
+		c.addMetric(descScrapeShard, prometheus.GaugeValue, value, c.name, strconv.Itoa(shard.Shard))
+	}
+
+	if err != nil {
+		c.logger.Err(err).Str("reason", masscan.ErrorReason(err)).Msg("failed to execute masscan")
+
+		return report, err
+	}
+
+	if report.Partial {
+		c.logger.Warn().Msg("scan completed with partial results")
+	}
+
+	c.addReportMetrics(report)
+
+	return report, nil
+}
+
+// waitForSlot waits for the scheduler to start the collector's scan.
+// Time spent queued counts towards the scan's timeout.
+func (c *Collector) waitForSlot(ctx context.Context) (*scheduler.Slot, error) {
+	c.setQueued(true)
+
+	start := time.Now()
+
+	slot, err := c.scheduler.Acquire(ctx, c.name, c.priority)
+
+	wait := time.Since(start)
+
+	c.setQueued(false)
+
+	c.addMetric(descSchedulerWait, prometheus.GaugeValue, wait.Seconds(), c.name)
+
+	if err != nil {
+		return nil, masscan.ContextError(ctx, fmt.Errorf("waiting for scheduler: %w", err))
+	}
+
+	c.logger.Debug().Dur("wait", wait).Msg("scan started by scheduler")
+
+	return slot, nil
+}
+
+// acquireRate waits for the collector's rate to be allocated from the budget.
+// Time spent queued counts towards the scan's timeout.
+func (c *Collector) acquireRate(ctx context.Context) (*budget.Allocation, error) {
+	c.setQueued(true)
+
+	start := time.Now()
+
+	allocation, err := c.budget.Acquire(ctx, c.requestedRate)
+
+	queued := time.Since(start)
+
+	c.setQueued(false)
+
+	c.addMetric(descBudgetQueued, prometheus.GaugeValue, queued.Seconds(), c.name)
+
 	if err != nil {
-		c.logger.Err(err).Msg("failed to execute masscan")
+		return nil, masscan.ContextError(ctx, fmt.Errorf("waiting for rate budget: %w", err))
+	}
+
+	c.addMetric(descBudgetRate, prometheus.GaugeValue, float64(allocation.Rate()), c.name)
+
+	c.logger.Debug().
+		Int("requested_rate", c.requestedRate).
+		Int("rate", allocation.Rate()).
+		Dur("queued", queued).
+		Msg("allocated rate from budget")
+
+	return allocation, nil
+}
+
+// checkEstimate returns an EstimateFunc which records the estimate of the scan started at start,
+// and warns, or refuses the scan if configured, when it is not expected to finish before the next scheduled scan.
+func (c *Collector) checkEstimate(start time.Time) masscan.EstimateFunc {
+	return func(estimate masscan.Estimate) error {
+		c.addMetric(descEstimateAddresses, prometheus.GaugeValue, float64(estimate.Addresses), c.name)
+		c.addMetric(descEstimatePorts, prometheus.GaugeValue, float64(estimate.Ports), c.name)
+		c.addMetric(descEstimateSeconds, prometheus.GaugeValue, estimate.Duration.Seconds(), c.name)
+
+		logger := c.logger.With().
+			Uint64("addresses", estimate.Addresses).
+			Int("ports", estimate.Ports).
+			Uint64("packets", estimate.Packets).
+			Int("rate", estimate.Rate).
+			Dur("estimate", estimate.Duration).
+			Logger()
+
+		nextTick, err := gronx.NextTickAfter(c.schedule, start, false)
+		if err != nil {
+			logger.Err(err).Msg("Error calculating next tick")
+
+			return nil
+		}
+
+		available := nextTick.Sub(start)
 
-		return 0
+		if estimate.Duration <= available {
+			logger.Debug().Msgf("scan estimated to take %s", estimate.Duration)
+
+			return nil
+		}
+
+		if c.refuseOverlap {
+			return fmt.Errorf("%w: estimated duration %s exceeds the %s until the next scheduled scan", masscan.ErrScanRefused, estimate.Duration, available)
+		}
+
+		logger.Warn().Msgf("scan estimated to take %s, which exceeds the %s until the next scheduled scan", estimate.Duration, available)
+
+		return nil
 	}
+}
 
+// addReportMetrics adds the port metrics for the results of the report.
+func (c *Collector) addReportMetrics(report masscan.Report) {
 	for ip, results := range report.Results {
 		for _, port := range results.Ports {
-			var value float64 = 0
+			if port.Status != "" {
+				var value float64 = 0
 
-			if port.Status == "open" {
-				value = 1
+				if port.Status == "open" {
+					value = 1
+				}
+
+				c.addMetric(descPortsOpen, prometheus.GaugeValue, value,
+					c.name, ip, masscan.IPFamily(ip), report.Hostnames.Label(ip), strconv.Itoa(port.Port), port.Proto, port.Reason, report.Vantage,
+				)
 			}
 
-			c.addMetric(descPortsOpen, prometheus.GaugeValue, value,
-				c.name, ip, strconv.Itoa(port.Port), port.Proto, port.Reason,
-			)
+			// masscan may report the same service more than once for a port.
+			services := make(map[string]struct{}, len(port.Services))
+
+			for _, service := range port.Services {
+				if _, ok := services[service.Name]; ok {
+					continue
+				}
+
+				services[service.Name] = struct{}{}
+
+				c.addMetric(descPortService, prometheus.GaugeValue, 1,
+					c.name, ip, strconv.Itoa(port.Port), port.Proto, service.Name, report.Vantage,
+				)
+			}
 		}
 	}
+}
+
+func (c *Collector) setQueued(queued bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.queued = queued
+}
+
+func (c *Collector) setProgress(progress masscan.Progress) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
-	return 1
+	c.progress = &progress
 }
 
 func (c *Collector) buildMetric(desc *prometheus.Desc, valueType prometheus.ValueType, value float64, labelValues ...string) prometheus.Metric {
@@ -244,11 +606,33 @@ func (c *Collector) addMetric(desc *prometheus.Desc, valueType prometheus.ValueT
 	c.nextCache = append(c.nextCache, metric)
 }
 
+// Changes returns the ports which were opened or closed by the most recent scan,
+// compared to the last complete scan before it.
+func (c *Collector) Changes() []masscan.PortChange {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return slices.Clone(c.changes)
+}
+
 func (c *Collector) FailedScrapes() int {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 
-	return c.failedScrapes
+	return c.stats.failedScrapes
+}
+
+func newScanner(ctx context.Context, cfg Config) (Scanner, error) {
+	if cfg.Scanner != nil {
+		return cfg.Scanner, nil
+	}
+
+	switch cfg.Backend {
+	case BackendConnect:
+		return connect.New(ctx, connect.WithConfig(cfg.Connect), connect.WithTargets(cfg.Masscan))
+	default:
+		return masscan.New(ctx, masscan.WithConfig(cfg.Masscan))
+	}
 }
 
 func NewCollector(ctx context.Context, opts ...Option) (*Collector, error) {
@@ -265,7 +649,7 @@ func NewCollector(ctx context.Context, opts ...Option) (*Collector, error) {
 
 	ctx = logger.WithContext(ctx)
 
-	masscan, err := masscan.New(ctx, masscan.WithConfig(cfg.Masscan))
+	scanner, err := newScanner(ctx, cfg)
 	if err != nil {
 		return nil, err
 	}
@@ -277,10 +661,35 @@ func NewCollector(ctx context.Context, opts ...Option) (*Collector, error) {
 		schedule:    cfg.Schedule,
 		scanOnStart: cfg.ScanOnStart,
 		startDelay:  cfg.StartDelay,
-		masscan:     masscan,
+		scanner:     scanner,
 		timeout:     cfg.Timeout,
+		store:       cfg.Store,
+
+		refuseOverlap: cfg.RefuseOverlap,
+
+		priority: cfg.Priority,
+
+		requestedRate: cfg.requestedRate(),
+
+		stats: newScrapeStats(),
+	}
+
+	// Scans outlive the context used to create the collector, they are only interrupted by Stop.
+	collector.ctx, collector.cancel = context.WithCancel(context.Background())
+
+	// Scans dispatched to an agent do not send packets from this host,
+	// so they neither take a local scan slot nor a share of the local rate budget.
+	if cfg.Agent == "" {
+		collector.scheduler = cfg.Scheduler
+		collector.budget = cfg.Budget
+	}
+
+	if collector.budget != nil {
+		collector.leaveBudget = collector.budget.Join()
+	}
 
-		doneCh: make(chan struct{}),
+	if collector.store != nil {
+		collector.restore(ctx)
 	}
 
 	if err := collector.run(); err != nil {
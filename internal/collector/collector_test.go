@@ -0,0 +1,711 @@
+package collector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mikemrm/masscan-exporter/internal/agent"
+	"github.com/mikemrm/masscan-exporter/internal/budget"
+	"github.com/mikemrm/masscan-exporter/internal/masscan"
+	"github.com/mikemrm/masscan-exporter/internal/masscan/masscantest"
+	"github.com/mikemrm/masscan-exporter/internal/scheduler"
+	"github.com/mikemrm/masscan-exporter/internal/state"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMain(m *testing.M) {
+	masscantest.Main(m)
+}
+
+type testScanner struct {
+	report masscan.Report
+	err    error
+}
+
+func (s testScanner) Run(_ context.Context, _ ...masscan.RunOption) (masscan.Report, error) {
+	return s.report, s.err
+}
+
+// sequenceScanner returns each report in order, repeating the last report once exhausted.
+type sequenceScanner struct {
+	mu      sync.Mutex
+	reports []masscan.Report
+}
+
+func (s *sequenceScanner) Run(_ context.Context, _ ...masscan.RunOption) (masscan.Report, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	report := s.reports[0]
+
+	if len(s.reports) > 1 {
+		s.reports = s.reports[1:]
+	}
+
+	return report, nil
+}
+
+// blockingScanner blocks each scan until its context is done.
+type blockingScanner struct {
+	started chan struct{}
+}
+
+func (s blockingScanner) Run(ctx context.Context, _ ...masscan.RunOption) (masscan.Report, error) {
+	close(s.started)
+
+	<-ctx.Done()
+
+	return masscan.Report{Partial: true}, masscan.ContextError(ctx, ctx.Err())
+}
+
+// testMetrics adapts a Collector to a prometheus.Collector.
+type testMetrics struct {
+	*Collector
+}
+
+func (testMetrics) Describe(ch chan<- *prometheus.Desc) {
+	Describe(ch)
+}
+
+func newTestCollector(t *testing.T, scanner Scanner) *Collector {
+	t.Helper()
+
+	ctx := zerolog.Nop().WithContext(t.Context())
+
+	c, err := NewCollector(ctx, WithConfig(Config{
+		Name:     "test",
+		Schedule: "@yearly",
+	}), WithScanner(scanner))
+	require.NoError(t, err, "no error expected creating collector")
+
+	t.Cleanup(c.Stop)
+
+	return c
+}
+
+func TestCollector_refresh(t *testing.T) {
+	t.Parallel()
+
+	c := newTestCollector(t, testScanner{
+		report: masscan.Report{
+			Results: map[string]masscan.Results{
+				"10.0.0.1": {
+					IP: "10.0.0.1",
+					Ports: masscan.Ports{
+						{Port: 22, Proto: "tcp", Status: "open", Reason: "syn-ack", Services: []masscan.Service{{Name: "ssh"}}},
+						{Port: 80, Proto: "tcp", Status: "open", Reason: "syn-ack"},
+					},
+				},
+				"2001:db8::1": {
+					IP: "2001:db8::1",
+					Ports: masscan.Ports{
+						{Port: 443, Proto: "tcp", Status: "open", Reason: "syn-ack"},
+					},
+				},
+			},
+			Hostnames: masscan.Hostnames{
+				"2001:db8::1": {"www.example.com"},
+			},
+		},
+	})
+
+	c.refresh()
+
+	expected := `
+# HELP masscan_port_service_info Reports the services detected on a port when grabbing banners.
+# TYPE masscan_port_service_info gauge
+masscan_port_service_info{collector="test",ip="10.0.0.1",port="22",proto="tcp",service="ssh",vantage=""} 1
+# HELP masscan_ports_open Masscan port status report
+# TYPE masscan_ports_open gauge
+masscan_ports_open{collector="test",hostname="",ip="10.0.0.1",ip_family="ipv4",port="22",proto="tcp",reason="syn-ack",vantage=""} 1
+masscan_ports_open{collector="test",hostname="",ip="10.0.0.1",ip_family="ipv4",port="80",proto="tcp",reason="syn-ack",vantage=""} 1
+masscan_ports_open{collector="test",hostname="www.example.com",ip="2001:db8::1",ip_family="ipv6",port="443",proto="tcp",reason="syn-ack",vantage=""} 1
+# HELP masscan_scrape_collector_success Reports if the scrape was successful.
+# TYPE masscan_scrape_collector_success gauge
+masscan_scrape_collector_success{collector="test"} 1
+# HELP masscan_scrapes_total Total number of scrapes executed for the collector.
+# TYPE masscan_scrapes_total counter
+masscan_scrapes_total{collector="test",result="failed"} 0
+masscan_scrapes_total{collector="test",result="success"} 1
+`
+
+	err := testutil.CollectAndCompare(testMetrics{c}, strings.NewReader(expected),
+		"masscan_ports_open",
+		"masscan_port_service_info",
+		"masscan_scrape_collector_success",
+		"masscan_scrapes_total",
+	)
+	require.NoError(t, err, "unexpected metrics")
+}
+
+func TestCollector_refresh_Masscan(t *testing.T) {
+	t.Parallel()
+
+	sim := masscantest.New(t, masscantest.Scenario{
+		Results: []masscan.RawResult{
+			{
+				IP: "10.0.0.1",
+				Ports: []masscan.RawPort{
+					{Port: masscan.Port{Port: 443, Proto: "tcp", Status: "open", Reason: "syn-ack", TTL: 64}},
+				},
+			},
+		},
+	})
+
+	ctx := zerolog.Nop().WithContext(t.Context())
+
+	c, err := NewCollector(ctx, WithConfig(Config{
+		Name:     "test",
+		Schedule: "@yearly",
+		Masscan: masscan.Config{
+			BinPath: sim.Path(),
+			TempDir: t.TempDir(),
+			Ranges:  masscan.DynamicValue[[]string]{Value: []string{"10.0.0.0/24"}},
+			Ports:   masscan.DynamicValue[[]string]{Value: []string{"443"}},
+		},
+	}))
+	require.NoError(t, err, "no error expected creating collector")
+
+	t.Cleanup(c.Stop)
+
+	c.refresh()
+
+	expected := `
+# HELP masscan_ports_open Masscan port status report
+# TYPE masscan_ports_open gauge
+masscan_ports_open{collector="test",hostname="",ip="10.0.0.1",ip_family="ipv4",port="443",proto="tcp",reason="syn-ack",vantage=""} 1
+# HELP masscan_scrape_collector_success Reports if the scrape was successful.
+# TYPE masscan_scrape_collector_success gauge
+masscan_scrape_collector_success{collector="test"} 1
+`
+
+	err = testutil.CollectAndCompare(testMetrics{c}, strings.NewReader(expected),
+		"masscan_ports_open",
+		"masscan_scrape_collector_success",
+	)
+	require.NoError(t, err, "unexpected metrics")
+}
+
+func TestCollector_refresh_Agent(t *testing.T) {
+	t.Parallel()
+
+	sim := masscantest.New(t, masscantest.Scenario{
+		Results: []masscan.RawResult{
+			{
+				IP: "10.0.0.1",
+				Ports: []masscan.RawPort{
+					{Port: masscan.Port{Port: 443, Proto: "tcp", Status: "open", Reason: "syn-ack", TTL: 64}},
+				},
+			},
+		},
+	})
+
+	ctx := zerolog.Nop().WithContext(t.Context())
+
+	a, err := agent.New(ctx, agent.WithToken("secret"), agent.WithMasscan(masscan.Config{
+		BinPath: sim.Path(),
+		TempDir: t.TempDir(),
+	}))
+	require.NoError(t, err, "no error expected creating agent")
+
+	server := httptest.NewServer(a.Handler())
+
+	t.Cleanup(server.Close)
+
+	cfg := Config{
+		Name:     "test",
+		Schedule: "@yearly",
+		Agent:    "eu-west",
+		Masscan: masscan.Config{
+			Ranges: masscan.DynamicValue[[]string]{Value: []string{"10.0.0.0/24"}},
+			Ports:  masscan.DynamicValue[[]string]{Value: []string{"443"}},
+		},
+	}
+
+	scanner, err := agent.NewScanner(ctx, agent.Remote{
+		Name:  cfg.Agent,
+		URL:   server.URL,
+		Token: masscan.DynamicValue[string]{Value: "secret"},
+	}, cfg.Name, cfg.Masscan)
+	require.NoError(t, err, "no error expected creating agent scanner")
+
+	// Local scans hold the whole scheduler and rate budget, which agent scans do not use.
+	sched, err := scheduler.New(ctx, scheduler.WithMaxConcurrent(1))
+	require.NoError(t, err, "no error expected creating scheduler")
+
+	slot, err := sched.Acquire(ctx, "other", 0)
+	require.NoError(t, err, "no error expected acquiring slot")
+
+	t.Cleanup(slot.Release)
+
+	rateBudget, err := budget.New(ctx, budget.WithMaxRate(1000))
+	require.NoError(t, err, "no error expected creating budget")
+
+	allocation, err := rateBudget.Acquire(ctx, 1000)
+	require.NoError(t, err, "no error expected acquiring rate")
+
+	t.Cleanup(allocation.Release)
+
+	cfg.Timeout = 5 * time.Second
+
+	c, err := NewCollector(ctx, WithConfig(cfg), WithScanner(scanner), WithScheduler(sched), WithBudget(rateBudget))
+	require.NoError(t, err, "no error expected creating collector")
+
+	t.Cleanup(c.Stop)
+
+	c.refresh()
+
+	assert.Equal(t, 0, c.FailedScrapes(), "expected agent scan to run without waiting for the scheduler or budget")
+
+	invocations := sim.Invocations(t)
+	require.Len(t, invocations, 1, "expected masscan to be executed by the agent")
+
+	assert.NotContains(t, invocations[0].Args, "--max-rate", "expected agent scan not to be limited by the local budget")
+
+	expected := `
+# HELP masscan_ports_open Masscan port status report
+# TYPE masscan_ports_open gauge
+masscan_ports_open{collector="test",hostname="",ip="10.0.0.1",ip_family="ipv4",port="443",proto="tcp",reason="syn-ack",vantage="eu-west"} 1
+# HELP masscan_scrape_collector_success Reports if the scrape was successful.
+# TYPE masscan_scrape_collector_success gauge
+masscan_scrape_collector_success{collector="test"} 1
+`
+
+	err = testutil.CollectAndCompare(testMetrics{c}, strings.NewReader(expected),
+		"masscan_ports_open",
+		"masscan_scrape_collector_success",
+	)
+	require.NoError(t, err, "unexpected metrics")
+}
+
+func TestCollector_refresh_Estimate(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name          string
+		refuseOverlap bool
+		expectSuccess string
+	}{
+		{"warn", false, "1"},
+		{"refuse", true, "0"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			sim := masscantest.New(t, masscantest.Scenario{})
+
+			ctx := zerolog.Nop().WithContext(t.Context())
+
+			c, err := NewCollector(ctx, WithConfig(Config{
+				Name:          "test",
+				Schedule:      "* * * * *",
+				RefuseOverlap: tc.refuseOverlap,
+				Masscan: masscan.Config{
+					BinPath: sim.Path(),
+					TempDir: t.TempDir(),
+					MaxRate: 100,
+					Ranges:  masscan.DynamicValue[[]string]{Value: []string{"10.0.0.0/16"}},
+					Ports:   masscan.DynamicValue[[]string]{Value: []string{"80", "443"}},
+				},
+			}))
+			require.NoError(t, err, "no error expected creating collector")
+
+			t.Cleanup(c.Stop)
+
+			c.refresh()
+
+			expected := `
+# HELP masscan_scrape_collector_success Reports if the scrape was successful.
+# TYPE masscan_scrape_collector_success gauge
+masscan_scrape_collector_success{collector="test"} ` + tc.expectSuccess + `
+# HELP masscan_scrape_estimated_addresses Reports the number of addresses to be scanned by the most recent scrape.
+# TYPE masscan_scrape_estimated_addresses gauge
+masscan_scrape_estimated_addresses{collector="test"} 65536
+# HELP masscan_scrape_estimated_ports Reports the number of ports to be scanned on each address by the most recent scrape.
+# TYPE masscan_scrape_estimated_ports gauge
+masscan_scrape_estimated_ports{collector="test"} 2
+# HELP masscan_scrape_estimated_seconds Reports the estimated duration of the most recent scrape, including retries and waiting for responses.
+# TYPE masscan_scrape_estimated_seconds gauge
+masscan_scrape_estimated_seconds{collector="test"} 1320.72
+`
+
+			err = testutil.CollectAndCompare(testMetrics{c}, strings.NewReader(expected),
+				"masscan_scrape_collector_success",
+				"masscan_scrape_estimated_addresses",
+				"masscan_scrape_estimated_ports",
+				"masscan_scrape_estimated_seconds",
+			)
+			require.NoError(t, err, "unexpected metrics")
+
+			if tc.refuseOverlap {
+				assert.Empty(t, sim.Invocations(t), "expected masscan to not be executed when the scan is refused")
+			} else {
+				assert.Len(t, sim.Invocations(t), 1, "expected masscan to be executed")
+			}
+		})
+	}
+}
+
+func TestCollector_refresh_Budget(t *testing.T) {
+	t.Parallel()
+
+	sim := masscantest.New(t, masscantest.Scenario{})
+
+	ctx := zerolog.Nop().WithContext(t.Context())
+
+	rateBudget, err := budget.New(ctx, budget.WithMaxRate(1000))
+	require.NoError(t, err, "no error expected creating budget")
+
+	// Another collector holding part of the budget.
+	held, err := rateBudget.Acquire(ctx, 800)
+	require.NoError(t, err, "no error expected acquiring rate")
+
+	c, err := NewCollector(ctx, WithConfig(Config{
+		Name:     "test",
+		Schedule: "@yearly",
+		Masscan: masscan.Config{
+			BinPath: sim.Path(),
+			TempDir: t.TempDir(),
+			MaxRate: 500,
+			Ranges:  masscan.DynamicValue[[]string]{Value: []string{"10.0.0.0/24"}},
+			Ports:   masscan.DynamicValue[[]string]{Value: []string{"443"}},
+		},
+	}), WithBudget(rateBudget))
+	require.NoError(t, err, "no error expected creating collector")
+
+	t.Cleanup(c.Stop)
+
+	c.refresh()
+
+	held.Release()
+
+	assert.Equal(t, 1000, rateBudget.Available(), "expected allocated rate to be released after the scan")
+
+	invocations := sim.Invocations(t)
+	require.Len(t, invocations, 1, "expected masscan to be executed once")
+
+	assert.Subset(t, invocations[0].Args, []string{"--max-rate", "200"}, "expected the remaining budget to be allocated")
+
+	expected := `
+# HELP masscan_scrape_budget_rate Reports the packets per second allocated to the most recent scrape from the rate budget.
+# TYPE masscan_scrape_budget_rate gauge
+masscan_scrape_budget_rate{collector="test"} 200
+# HELP masscan_scrape_queued Reports if a scrape is waiting for the scheduler or rate budget.
+# TYPE masscan_scrape_queued gauge
+masscan_scrape_queued{collector="test"} 0
+`
+
+	err = testutil.CollectAndCompare(testMetrics{c}, strings.NewReader(expected),
+		"masscan_scrape_budget_rate",
+		"masscan_scrape_queued",
+	)
+	require.NoError(t, err, "unexpected metrics")
+}
+
+func TestCollector_refresh_Scheduler(t *testing.T) {
+	t.Parallel()
+
+	ctx := zerolog.Nop().WithContext(t.Context())
+
+	sched, err := scheduler.New(ctx, scheduler.WithMaxConcurrent(1))
+	require.NoError(t, err, "no error expected creating scheduler")
+
+	c, err := NewCollector(ctx, WithConfig(Config{
+		Name:     "test",
+		Schedule: "@yearly",
+		Timeout:  20 * time.Millisecond,
+	}), WithScanner(testScanner{}), WithScheduler(sched))
+	require.NoError(t, err, "no error expected creating collector")
+
+	t.Cleanup(c.Stop)
+
+	// Another collector's scan is running.
+	held, err := sched.Acquire(ctx, "other", 0)
+	require.NoError(t, err, "no error expected acquiring slot")
+
+	c.refresh()
+
+	assert.Equal(t, 1, c.FailedScrapes(), "expected scrape to time out while queued")
+	assert.Equal(t, 1, c.stats.scrapeErrors[masscan.ReasonTimeout], "expected scrape to fail with the timeout reason")
+
+	held.Release()
+
+	c.refresh()
+
+	assert.Equal(t, 0, c.FailedScrapes(), "expected scrape to run once the slot is released")
+	assert.Equal(t, 0, sched.Running(), "expected slot to be released after the scrape")
+
+	expected := `
+# HELP masscan_scrape_queued Reports if a scrape is waiting for the scheduler or rate budget.
+# TYPE masscan_scrape_queued gauge
+masscan_scrape_queued{collector="test"} 0
+`
+
+	err = testutil.CollectAndCompare(testMetrics{c}, strings.NewReader(expected), "masscan_scrape_queued")
+	require.NoError(t, err, "unexpected metrics")
+}
+
+func TestCollector_refresh_Failure(t *testing.T) {
+	t.Parallel()
+
+	c := newTestCollector(t, testScanner{
+		err: fmt.Errorf("%w for ranges: %w", masscan.ErrLoadValue, errors.New("unexpected status code")),
+	})
+
+	c.refresh()
+	c.refresh()
+
+	assert.Equal(t, 2, c.FailedScrapes(), "unexpected failed scrapes")
+
+	expected := `
+# HELP masscan_scrape_collector_success Reports if the scrape was successful.
+# TYPE masscan_scrape_collector_success gauge
+masscan_scrape_collector_success{collector="test"} 0
+# HELP masscan_scrape_errors_total Total number of failed scrapes by the reason for the failure.
+# TYPE masscan_scrape_errors_total counter
+masscan_scrape_errors_total{collector="test",reason="binary_not_found"} 0
+masscan_scrape_errors_total{collector="test",reason="canceled"} 0
+masscan_scrape_errors_total{collector="test",reason="exit"} 0
+masscan_scrape_errors_total{collector="test",reason="invalid_target"} 0
+masscan_scrape_errors_total{collector="test",reason="killed"} 0
+masscan_scrape_errors_total{collector="test",reason="invalid_config"} 0
+masscan_scrape_errors_total{collector="test",reason="load_value"} 2
+masscan_scrape_errors_total{collector="test",reason="parse_report"} 0
+masscan_scrape_errors_total{collector="test",reason="permission_denied"} 0
+masscan_scrape_errors_total{collector="test",reason="refused"} 0
+masscan_scrape_errors_total{collector="test",reason="resolve"} 0
+masscan_scrape_errors_total{collector="test",reason="timeout"} 0
+masscan_scrape_errors_total{collector="test",reason="unknown"} 0
+# HELP masscan_scrapes_failed_current The number of consecutive scrapes which have failed.
+# TYPE masscan_scrapes_failed_current gauge
+masscan_scrapes_failed_current{collector="test"} 2
+`
+
+	err := testutil.CollectAndCompare(testMetrics{c}, strings.NewReader(expected),
+		"masscan_scrape_collector_success",
+		"masscan_scrape_errors_total",
+		"masscan_scrapes_failed_current",
+	)
+	require.NoError(t, err, "unexpected metrics")
+}
+
+func TestCollector_refresh_Changes(t *testing.T) {
+	t.Parallel()
+
+	openPorts := func(partial bool, ports ...int) masscan.Report {
+		report := masscan.Report{
+			Partial: partial,
+			Results: map[string]masscan.Results{},
+		}
+
+		for _, port := range ports {
+			result := report.Results["10.0.0.1"]
+			result.IP = "10.0.0.1"
+			result.Ports = append(result.Ports, masscan.Port{Port: port, Proto: "tcp", Status: "open", Reason: "syn-ack"})
+			report.Results["10.0.0.1"] = result
+		}
+
+		return report
+	}
+
+	c := newTestCollector(t, &sequenceScanner{
+		reports: []masscan.Report{
+			openPorts(false, 22, 80),
+			openPorts(false, 22, 443),
+			openPorts(true),
+			openPorts(false, 22, 443, 8080),
+		},
+	})
+
+	c.refresh()
+
+	assert.Empty(t, c.Changes(), "expected no changes for the first scan")
+
+	c.refresh()
+
+	expected := []masscan.PortChange{
+		{IP: "10.0.0.1", Port: 80, Proto: "tcp", Change: masscan.ChangeClosed},
+		{IP: "10.0.0.1", Port: 443, Proto: "tcp", Change: masscan.ChangeOpened},
+	}
+
+	assert.Equal(t, expected, c.Changes(), "unexpected changes")
+
+	c.refresh()
+
+	assert.Empty(t, c.Changes(), "expected partial scans to not be compared")
+
+	c.refresh()
+
+	expected = []masscan.PortChange{
+		{IP: "10.0.0.1", Port: 8080, Proto: "tcp", Change: masscan.ChangeOpened},
+	}
+
+	assert.Equal(t, expected, c.Changes(), "expected changes compared to the last complete scan")
+
+	metrics := `
+# HELP masscan_port_changes_total Total number of ports opened or closed between consecutive complete scans.
+# TYPE masscan_port_changes_total counter
+masscan_port_changes_total{change="closed",collector="test"} 1
+masscan_port_changes_total{change="opened",collector="test"} 2
+`
+
+	err := testutil.CollectAndCompare(testMetrics{c}, strings.NewReader(metrics), "masscan_port_changes_total")
+	require.NoError(t, err, "unexpected metrics")
+}
+
+func TestCollector_restore(t *testing.T) {
+	t.Parallel()
+
+	ctx := zerolog.Nop().WithContext(t.Context())
+
+	store, err := state.New(ctx, state.WithDir(t.TempDir()))
+	require.NoError(t, err, "no error expected creating store")
+
+	newCollector := func(scanner Scanner) *Collector {
+		c, err := NewCollector(ctx, WithConfig(Config{
+			Name:     "test",
+			Schedule: "@yearly",
+		}), WithScanner(scanner), WithStore(store))
+		require.NoError(t, err, "no error expected creating collector")
+
+		t.Cleanup(c.Stop)
+
+		return c
+	}
+
+	report := func(ports ...int) masscan.Report {
+		result := masscan.Results{IP: "10.0.0.1"}
+
+		for _, port := range ports {
+			result.Ports = append(result.Ports, masscan.Port{Port: port, Proto: "tcp", Status: "open", Reason: "syn-ack"})
+		}
+
+		return masscan.Report{Results: map[string]masscan.Results{"10.0.0.1": result}}
+	}
+
+	first := newCollector(testScanner{report: report(22)})
+
+	first.refresh()
+
+	// The restored collector has not scanned yet, its metrics come from the saved report.
+	restored := newCollector(&sequenceScanner{reports: []masscan.Report{report(22, 80)}})
+
+	expected := `
+# HELP masscan_ports_open Masscan port status report
+# TYPE masscan_ports_open gauge
+masscan_ports_open{collector="test",hostname="",ip="10.0.0.1",ip_family="ipv4",port="22",proto="tcp",reason="syn-ack",vantage=""} 1
+# HELP masscan_scrape_collector_success Reports if the scrape was successful.
+# TYPE masscan_scrape_collector_success gauge
+masscan_scrape_collector_success{collector="test"} 1
+# HELP masscan_scrapes_total Total number of scrapes executed for the collector.
+# TYPE masscan_scrapes_total counter
+masscan_scrapes_total{collector="test",result="failed"} 0
+masscan_scrapes_total{collector="test",result="success"} 1
+`
+
+	err = testutil.CollectAndCompare(testMetrics{restored}, strings.NewReader(expected),
+		"masscan_ports_open",
+		"masscan_scrape_collector_success",
+		"masscan_scrapes_total",
+	)
+	require.NoError(t, err, "unexpected restored metrics")
+
+	restored.refresh()
+
+	expectedChanges := []masscan.PortChange{
+		{IP: "10.0.0.1", Port: 80, Proto: "tcp", Change: masscan.ChangeOpened},
+	}
+
+	assert.Equal(t, expectedChanges, restored.Changes(), "expected changes compared to the restored report")
+	assert.Equal(t, 2, restored.stats.totalSuccess, "expected total success to continue from the restored report")
+}
+
+func TestCollector_Stop(t *testing.T) {
+	t.Parallel()
+
+	scanner := blockingScanner{started: make(chan struct{})}
+
+	ctx := zerolog.Nop().WithContext(t.Context())
+
+	c, err := NewCollector(ctx, WithConfig(Config{
+		Name:        "test",
+		Schedule:    "@yearly",
+		ScanOnStart: true,
+	}), WithScanner(scanner))
+	require.NoError(t, err, "no error expected creating collector")
+
+	select {
+	case <-scanner.started:
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "expected scan to start")
+	}
+
+	stopped := make(chan struct{})
+
+	go func() {
+		c.Stop()
+
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "expected Stop to interrupt the running scan")
+	}
+
+	assert.Equal(t, 1, c.FailedScrapes(), "expected the scan to have finished before Stop returned")
+}
+
+func TestNewConfig_ResumeDir(t *testing.T) {
+	t.Parallel()
+
+	cfg := newConfig(WithConfig(Config{
+		Name:    "../other/collector",
+		Masscan: masscan.Config{TempDir: "/var/tmp", Resume: true},
+	}))
+
+	assert.Equal(t, "/var/tmp/masscan-resume/..%2Fother%2Fcollector", cfg.Masscan.ResumeDir, "expected collector name to be escaped")
+}
+
+func TestConfig_Validate(t *testing.T) {
+	t.Parallel()
+
+	cfg := newConfig(WithConfig(Config{Name: "test", Schedule: "@daily"}))
+
+	require.NoError(t, cfg.Validate(), "no error expected for default backend")
+
+	cfg.Backend = "unknown"
+
+	require.ErrorIs(t, cfg.Validate(), ErrUnknownBackend, "expected unknown backend error")
+
+	cfg.Backend = BackendMasscan
+	cfg.Name = ".."
+
+	require.ErrorIs(t, cfg.Validate(), ErrInvalidName, "expected invalid name error")
+
+	cfg.Name = "test"
+	cfg.Agent = "eu-west"
+
+	require.ErrorIs(t, cfg.Validate(), ErrUnknownAgent, "expected unknown agent error without a scanner")
+
+	cfg.Scanner = testScanner{}
+
+	require.NoError(t, cfg.Validate(), "no error expected for agent with scanner")
+
+	cfg.Backend = BackendConnect
+
+	require.ErrorIs(t, cfg.Validate(), ErrAgentBackend, "expected agent backend error")
+}
@@ -2,15 +2,31 @@ package collector
 
 import (
 	"errors"
+	"fmt"
+	"net/url"
+	"path/filepath"
 	"time"
 
 	"github.com/adhocore/gronx"
+	"github.com/mikemrm/masscan-exporter/internal/budget"
+	"github.com/mikemrm/masscan-exporter/internal/connect"
 	"github.com/mikemrm/masscan-exporter/internal/masscan"
+	"github.com/mikemrm/masscan-exporter/internal/scheduler"
+	"github.com/mikemrm/masscan-exporter/internal/state"
+)
+
+const (
+	BackendMasscan = "masscan"
+	BackendConnect = "connect"
 )
 
 var (
 	ErrNameRequired    = errors.New("collector name required")
+	ErrInvalidName     = errors.New("invalid collector name")
 	ErrInvalidSchedule = errors.New("invalid collector schedule")
+	ErrUnknownBackend  = errors.New("unknown collector backend")
+	ErrUnknownAgent    = errors.New("unknown agent")
+	ErrAgentBackend    = errors.New("agents only support the masscan backend")
 )
 
 type Config struct {
@@ -18,8 +34,35 @@ type Config struct {
 	Schedule    string         `mapstructure:"schedule"`
 	ScanOnStart bool           `mapstructure:"scan_on_start"`
 	StartDelay  time.Duration  `mapstructure:"start_delay"`
+	Backend     string         `mapstructure:"backend"`
 	Masscan     masscan.Config `mapstructure:"masscan"`
+	Connect     connect.Config `mapstructure:"connect"`
 	Timeout     time.Duration  `mapstructure:"timeout"`
+
+	// Agent is the name of the remote agent the collector's scans are dispatched to, scans run locally when empty.
+	// The agent's scanner must be set with Scanner.
+	Agent string `mapstructure:"agent"`
+
+	// Priority orders the collector's scans when queued by the scheduler, higher priorities start first.
+	Priority int `mapstructure:"priority"`
+
+	// RefuseOverlap fails scans which are estimated to not finish before the next scheduled scan,
+	// instead of only logging a warning.
+	RefuseOverlap bool `mapstructure:"refuse_overlap"`
+
+	// Scanner overrides the scanner built from the configured backend.
+	Scanner Scanner `mapstructure:"-"`
+
+	// Scheduler limits the number of scans running at the same time as other collectors when set.
+	// It is not used by collectors with an Agent.
+	Scheduler *scheduler.Scheduler `mapstructure:"-"`
+
+	// Budget limits the rate of the collector's scans to a share of a rate shared with other collectors when set.
+	// It is not used by collectors with an Agent.
+	Budget *budget.Budget `mapstructure:"-"`
+
+	// Store saves each completed report and restores the latest on start when set.
+	Store *state.Store `mapstructure:"-"`
 }
 
 func (c Config) Validate() error {
@@ -27,13 +70,47 @@ func (c Config) Validate() error {
 		return ErrNameRequired
 	}
 
+	// The name is used as a directory name for resume and state files.
+	if c.Name == "." || c.Name == ".." {
+		return fmt.Errorf("%w: %s", ErrInvalidName, c.Name)
+	}
+
 	if c.Schedule == "" || !gronx.IsValid(c.Schedule) {
 		return ErrInvalidSchedule
 	}
 
+	switch c.Backend {
+	case BackendMasscan, BackendConnect:
+	default:
+		return fmt.Errorf("%w: %s", ErrUnknownBackend, c.Backend)
+	}
+
+	if c.Agent != "" {
+		if c.Backend != BackendMasscan {
+			return ErrAgentBackend
+		}
+
+		if c.Scanner == nil {
+			return fmt.Errorf("%w: %s", ErrUnknownAgent, c.Agent)
+		}
+	}
+
 	return nil
 }
 
+// requestedRate returns the rate the collector's scans request from the budget.
+func (c Config) requestedRate() int {
+	if c.Masscan.MaxRate > 0 {
+		return c.Masscan.MaxRate
+	}
+
+	if c.Backend == BackendConnect {
+		return connect.DefaultMaxRate
+	}
+
+	return masscan.DefaultMaxRate
+}
+
 func newConfig(opts ...Option) Config {
 	var cfg Config
 
@@ -41,6 +118,19 @@ func newConfig(opts ...Option) Config {
 		cfg = opt.apply(cfg)
 	}
 
+	if cfg.Backend == "" {
+		cfg.Backend = BackendMasscan
+	}
+
+	if cfg.Masscan.Resume && cfg.Masscan.ResumeDir == "" {
+		tempDir := cfg.Masscan.TempDir
+		if tempDir == "" {
+			tempDir = masscan.DefaultTempDir
+		}
+
+		cfg.Masscan.ResumeDir = filepath.Join(tempDir, "masscan-resume", url.PathEscape(cfg.Name))
+	}
+
 	return cfg
 }
 
@@ -60,3 +150,39 @@ func WithConfig(cfg Config) Option {
 		return cfg
 	})
 }
+
+// WithScanner sets the scanner used by the collector, ignoring the configured backend.
+func WithScanner(scanner Scanner) Option {
+	return optionFunc(func(cfg Config) Config {
+		cfg.Scanner = scanner
+
+		return cfg
+	})
+}
+
+// WithStore sets the store reports are saved to and restored from.
+func WithStore(store *state.Store) Option {
+	return optionFunc(func(cfg Config) Config {
+		cfg.Store = store
+
+		return cfg
+	})
+}
+
+// WithBudget sets the rate budget shared with other collectors.
+func WithBudget(b *budget.Budget) Option {
+	return optionFunc(func(cfg Config) Config {
+		cfg.Budget = b
+
+		return cfg
+	})
+}
+
+// WithScheduler sets the scheduler shared with other collectors.
+func WithScheduler(s *scheduler.Scheduler) Option {
+	return optionFunc(func(cfg Config) Config {
+		cfg.Scheduler = s
+
+		return cfg
+	})
+}
@@ -3,14 +3,29 @@ package collector
 import "github.com/prometheus/client_golang/prometheus"
 
 var (
-	descScrapeSuccess    = prometheus.NewDesc("masscan_scrape_collector_success", "Reports if the scrape was successful.", []string{"collector"}, nil)
-	descScrapeStart      = prometheus.NewDesc("masscan_scrape_start_time", "Reports the start time of the scrape.", []string{"collector"}, nil)
-	descScrapeNextStart  = prometheus.NewDesc("masscan_scrape_next_start_time", "Reports the start time for the next scrape.", []string{"collector"}, nil)
-	descScrapeSeconds    = prometheus.NewDesc("masscan_scrape_seconds", "Reports how long a scrape took in seconds.", []string{"collector"}, nil)
-	descScrapeInProgress = prometheus.NewDesc("masscan_scrape_in_progress", "Reports if a scrape is in progress.", []string{"collector"}, nil)
-	descScrapesTotal     = prometheus.NewDesc("masscan_scrapes_total", "Total number of scrapes executed for the collector.", []string{"collector", "result"}, nil)
-	descScrapesFailed    = prometheus.NewDesc("masscan_scrapes_failed_current", "The number of consecutive scrapes which have failed.", []string{"collector"}, nil)
-	descPortsOpen        = prometheus.NewDesc("masscan_ports_open", "Masscan port status report", []string{"collector", "ip", "port", "proto", "reason"}, nil)
+	descScrapeSuccess     = prometheus.NewDesc("masscan_scrape_collector_success", "Reports if the scrape was successful.", []string{"collector"}, nil)
+	descScrapeStart       = prometheus.NewDesc("masscan_scrape_start_time", "Reports the start time of the scrape.", []string{"collector"}, nil)
+	descScrapeNextStart   = prometheus.NewDesc("masscan_scrape_next_start_time", "Reports the start time for the next scrape.", []string{"collector"}, nil)
+	descScrapeSeconds     = prometheus.NewDesc("masscan_scrape_seconds", "Reports how long a scrape took in seconds.", []string{"collector"}, nil)
+	descScrapeInProgress  = prometheus.NewDesc("masscan_scrape_in_progress", "Reports if a scrape is in progress.", []string{"collector"}, nil)
+	descProgressPercent   = prometheus.NewDesc("masscan_scrape_progress_percent", "Reports the percentage of the in progress scrape which has been transmitted.", []string{"collector"}, nil)
+	descProgressRate      = prometheus.NewDesc("masscan_scrape_progress_packets_per_second", "Reports the current transmit rate of the in progress scrape.", []string{"collector"}, nil)
+	descProgressFound     = prometheus.NewDesc("masscan_scrape_progress_found", "Reports the number of ports found so far by the in progress scrape.", []string{"collector"}, nil)
+	descProgressETA       = prometheus.NewDesc("masscan_scrape_progress_eta_seconds", "Reports the estimated seconds until the in progress scrape completes.", []string{"collector"}, nil)
+	descScrapeQueued      = prometheus.NewDesc("masscan_scrape_queued", "Reports if a scrape is waiting for the scheduler or rate budget.", []string{"collector"}, nil)
+	descSchedulerWait     = prometheus.NewDesc("masscan_scrape_scheduler_wait_seconds", "Reports how long the most recent scrape waited for the scheduler to start it.", []string{"collector"}, nil)
+	descBudgetQueued      = prometheus.NewDesc("masscan_scrape_budget_queued_seconds", "Reports how long the most recent scrape waited for the rate budget.", []string{"collector"}, nil)
+	descBudgetRate        = prometheus.NewDesc("masscan_scrape_budget_rate", "Reports the packets per second allocated to the most recent scrape from the rate budget.", []string{"collector"}, nil)
+	descEstimateAddresses = prometheus.NewDesc("masscan_scrape_estimated_addresses", "Reports the number of addresses to be scanned by the most recent scrape.", []string{"collector"}, nil)
+	descEstimatePorts     = prometheus.NewDesc("masscan_scrape_estimated_ports", "Reports the number of ports to be scanned on each address by the most recent scrape.", []string{"collector"}, nil)
+	descEstimateSeconds   = prometheus.NewDesc("masscan_scrape_estimated_seconds", "Reports the estimated duration of the most recent scrape, including retries and waiting for responses.", []string{"collector"}, nil)
+	descScrapesTotal      = prometheus.NewDesc("masscan_scrapes_total", "Total number of scrapes executed for the collector.", []string{"collector", "result"}, nil)
+	descScrapeShard       = prometheus.NewDesc("masscan_scrape_shard_success", "Reports if each shard of the scrape was successful.", []string{"collector", "shard"}, nil)
+	descScrapesFailed     = prometheus.NewDesc("masscan_scrapes_failed_current", "The number of consecutive scrapes which have failed.", []string{"collector"}, nil)
+	descScrapeErrors      = prometheus.NewDesc("masscan_scrape_errors_total", "Total number of failed scrapes by the reason for the failure.", []string{"collector", "reason"}, nil)
+	descPortsOpen         = prometheus.NewDesc("masscan_ports_open", "Masscan port status report", []string{"collector", "ip", "ip_family", "hostname", "port", "proto", "reason", "vantage"}, nil)
+	descPortChanges       = prometheus.NewDesc("masscan_port_changes_total", "Total number of ports opened or closed between consecutive complete scans.", []string{"collector", "change"}, nil)
+	descPortService       = prometheus.NewDesc("masscan_port_service_info", "Reports the services detected on a port when grabbing banners.", []string{"collector", "ip", "port", "proto", "service", "vantage"}, nil)
 )
 
 func Describe(ch chan<- *prometheus.Desc) {
@@ -19,7 +34,22 @@ func Describe(ch chan<- *prometheus.Desc) {
 	ch <- descScrapeNextStart
 	ch <- descScrapeSeconds
 	ch <- descScrapeInProgress
+	ch <- descProgressPercent
+	ch <- descProgressRate
+	ch <- descProgressFound
+	ch <- descProgressETA
+	ch <- descScrapeQueued
+	ch <- descSchedulerWait
+	ch <- descBudgetQueued
+	ch <- descBudgetRate
+	ch <- descEstimateAddresses
+	ch <- descEstimatePorts
+	ch <- descEstimateSeconds
 	ch <- descScrapesTotal
 	ch <- descScrapesFailed
+	ch <- descScrapeErrors
+	ch <- descScrapeShard
 	ch <- descPortsOpen
+	ch <- descPortService
+	ch <- descPortChanges
 }
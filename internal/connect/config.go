@@ -0,0 +1,70 @@
+package connect
+
+import (
+	"time"
+
+	"github.com/mikemrm/masscan-exporter/internal/masscan"
+)
+
+const (
+	DefaultTimeout     = time.Second
+	DefaultConcurrency = 100
+	DefaultMaxRate     = 100
+)
+
+type Config struct {
+	Timeout     time.Duration `mapstructure:"timeout"`
+	Concurrency int           `mapstructure:"concurrency"`
+
+	// Targets provides the ranges, ports, excludes and max rate to scan.
+	// All other masscan options are ignored.
+	Targets masscan.Config `mapstructure:"-"`
+}
+
+func newConfig(opts ...Option) Config {
+	var cfg Config
+
+	for _, opt := range opts {
+		cfg = opt.apply(cfg)
+	}
+
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+
+	if cfg.Concurrency <= 0 {
+		cfg.Concurrency = DefaultConcurrency
+	}
+
+	if cfg.Targets.MaxRate <= 0 {
+		cfg.Targets.MaxRate = DefaultMaxRate
+	}
+
+	return cfg
+}
+
+type Option interface {
+	apply(Config) Config
+}
+
+type optionFunc func(Config) Config
+
+func (fn optionFunc) apply(cfg Config) Config {
+	return fn(cfg)
+}
+
+// WithConfig replaces the existing Config.
+func WithConfig(cfg Config) Option {
+	return optionFunc(func(_ Config) Config {
+		return cfg
+	})
+}
+
+// WithTargets sets the masscan config which provides the targets to scan.
+func WithTargets(targets masscan.Config) Option {
+	return optionFunc(func(cfg Config) Config {
+		cfg.Targets = targets
+
+		return cfg
+	})
+}
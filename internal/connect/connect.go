@@ -0,0 +1,278 @@
+// Package connect implements an unprivileged scanner which uses full tcp connections
+// rather than raw packets. It is intended for low rate scans where masscan is unavailable
+// or the process is not permitted to open raw sockets.
+package connect
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net"
+	"net/netip"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mikemrm/masscan-exporter/internal/masscan"
+	"github.com/rs/zerolog"
+)
+
+const progressInterval = time.Second
+
+type Scanner struct {
+	cfg Config
+
+	dial func(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+type target struct {
+	addr netip.Addr
+	port int
+}
+
+// Run scans all configured targets and returns a report of the open ports.
+func (s *Scanner) Run(ctx context.Context, opts ...masscan.RunOption) (masscan.Report, error) {
+	logger := zerolog.Ctx(ctx)
+
+	options := masscan.NewRunOptions(opts...)
+
+	rate := s.cfg.Targets.MaxRate
+
+	if options.MaxRate > 0 {
+		rate = options.MaxRate
+	}
+
+	report := masscan.Report{
+		Partial: true,
+		MaxRate: rate,
+	}
+
+	ranges, err := s.cfg.Targets.Ranges.GetValue(ctx)
+	if err != nil {
+		return report, fmt.Errorf("%w for ranges: %w", masscan.ErrLoadValue, err)
+	}
+
+	report.Ranges = ranges
+
+	ports, err := s.cfg.Targets.Ports.GetValue(ctx)
+	if err != nil {
+		return report, fmt.Errorf("%w for ports: %w", masscan.ErrLoadValue, err)
+	}
+
+	report.Ports = ports
+
+	expanded, groups, err := s.cfg.Targets.PortGroups.Expand(ports)
+	if err != nil {
+		return report, err
+	}
+
+	report.PortGroups = groups
+
+	excludes, err := s.cfg.Targets.Excludes.GetValue(ctx)
+	if err != nil {
+		return report, fmt.Errorf("%w for excludes: %w", masscan.ErrLoadValue, err)
+	}
+
+	report.Excludes = excludes
+
+	resolved, hostnames, err := s.cfg.Targets.ResolveRanges(ctx, ranges)
+	if err != nil {
+		return report, err
+	}
+
+	report.Hostnames = hostnames
+
+	parsed, err := masscan.ParseTargets(resolved, excludes, expanded)
+	if err != nil {
+		return report, err
+	}
+
+	report.Targets = parsed
+	report.AddressCount = parsed.AddressCount()
+
+	scanPorts, skipped := tcpPorts(parsed.Ports)
+
+	if len(skipped) != 0 {
+		logger.Warn().Strs("ports", skipped).Msg("connect scans only support tcp, skipping ports")
+	}
+
+	// Large ipv6 ranges may not be countable, the total is capped so progress reporting does not overflow.
+	total := int(min(report.AddressCount, uint64(math.MaxInt)/uint64(max(len(scanPorts), 1)))) * len(scanPorts)
+
+	if options.Estimate != nil && total > 0 {
+		estimate := masscan.NewEstimate(report.AddressCount, len(scanPorts), 0, rate, s.cfg.Timeout)
+
+		if err := options.Estimate(estimate); err != nil {
+			return report, err
+		}
+	}
+
+	logger.Debug().Msgf("scanning %d targets at %d connections per second", total, rate)
+
+	var (
+		mu      sync.Mutex
+		results = make(map[netip.Addr]masscan.Ports)
+		done    int
+		found   int
+		start   = time.Now()
+	)
+
+	targets := make(chan target)
+
+	var wg sync.WaitGroup
+
+	for range s.cfg.Concurrency {
+		wg.Go(func() {
+			for t := range targets {
+				open := s.probe(ctx, t)
+
+				mu.Lock()
+
+				done++
+
+				if open {
+					found++
+
+					results[t.addr] = append(results[t.addr], masscan.Port{
+						Port:   t.port,
+						Proto:  "tcp",
+						Status: "open",
+						Reason: "connect",
+					})
+				}
+
+				mu.Unlock()
+			}
+		})
+	}
+
+	progressDone := make(chan struct{})
+
+	if options.Progress != nil {
+		go func() {
+			ticker := time.NewTicker(progressInterval)
+			defer ticker.Stop()
+
+			for {
+				select {
+				case <-ticker.C:
+				case <-progressDone:
+					return
+				}
+
+				mu.Lock()
+				progress := buildProgress(done, found, total, time.Since(start))
+				mu.Unlock()
+
+				options.Progress(progress)
+			}
+		}()
+	}
+
+	err = s.dispatch(ctx, rate, parsed.Addresses(), scanPorts, targets)
+
+	close(targets)
+
+	wg.Wait()
+
+	close(progressDone)
+
+	for addr, ports := range results {
+		slices.SortFunc(ports, func(a, b masscan.Port) int {
+			return a.Port - b.Port
+		})
+
+		if report.Results == nil {
+			report.Results = make(map[string]masscan.Results, len(results))
+		}
+
+		report.Results[addr.String()] = masscan.Results{
+			IP:    addr.String(),
+			Ports: ports,
+		}
+	}
+
+	if err != nil {
+		return report, masscan.ContextError(ctx, fmt.Errorf("scan interrupted: %w", err))
+	}
+
+	report.Partial = false
+
+	return report, nil
+}
+
+// dispatch sends each target to the workers at no more than rate per second.
+func (s *Scanner) dispatch(ctx context.Context, rate int, addresses []masscan.AddrRange, ports []int, targets chan<- target) error {
+	ticker := time.NewTicker(max(time.Second/time.Duration(rate), time.Nanosecond))
+	defer ticker.Stop()
+
+	for _, r := range addresses {
+		for addr := r.From; addr.IsValid() && addr.Compare(r.To) <= 0; addr = addr.Next() {
+			for _, port := range ports {
+				select {
+				case <-ticker.C:
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+
+				select {
+				case targets <- target{addr, port}:
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// probe reports if a tcp connection could be established to the target.
+func (s *Scanner) probe(ctx context.Context, t target) bool {
+	ctx, cancel := context.WithTimeout(ctx, s.cfg.Timeout)
+	defer cancel()
+
+	conn, err := s.dial(ctx, "tcp", net.JoinHostPort(t.addr.String(), strconv.Itoa(t.port)))
+	if err != nil {
+		return false
+	}
+
+	conn.Close()
+
+	return true
+}
+
+func buildProgress(done, found, total int, elapsed time.Duration) masscan.Progress {
+	progress := masscan.Progress{
+		Percent: 100,
+		Found:   found,
+	}
+
+	if total > 0 {
+		progress.Percent = float64(done) / float64(total) * 100
+	}
+
+	if seconds := elapsed.Seconds(); seconds > 0 {
+		progress.Rate = float64(done) / seconds
+	}
+
+	if progress.Rate > 0 {
+		progress.Remaining = time.Duration(float64(total-done) / progress.Rate * float64(time.Second))
+	}
+
+	return progress
+}
+
+func New(_ context.Context, opts ...Option) (*Scanner, error) {
+	cfg := newConfig(opts...)
+
+	dialer := &net.Dialer{
+		Timeout: cfg.Timeout,
+	}
+
+	return &Scanner{
+		cfg:  cfg,
+		dial: dialer.DialContext,
+	}, nil
+}
@@ -0,0 +1,114 @@
+package connect
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/mikemrm/masscan-exporter/internal/masscan"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testListener(t *testing.T) int {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err, "no error expected creating listener")
+
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			conn.Close()
+		}
+	}()
+
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+// testClosedPort returns a port which is not listening.
+func testClosedPort(t *testing.T) int {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err, "no error expected creating listener")
+
+	port := listener.Addr().(*net.TCPAddr).Port
+
+	listener.Close()
+
+	return port
+}
+
+func TestScanner_Run(t *testing.T) {
+	t.Parallel()
+
+	openPort := testListener(t)
+	closedPort := testClosedPort(t)
+
+	scanner, err := New(t.Context(),
+		WithTargets(masscan.Config{
+			MaxRate: 1000,
+			Ranges:  masscan.DynamicValue[[]string]{Value: []string{"127.0.0.1", "127.0.0.2-127.0.0.3"}},
+			Ports: masscan.DynamicValue[[]string]{Value: []string{
+				strconv.Itoa(openPort), "T:" + strconv.Itoa(closedPort), "U:53",
+			}},
+			Excludes: masscan.DynamicValue[[]string]{Value: []string{"127.0.0.2/31"}},
+		}),
+	)
+	require.NoError(t, err, "no error expected creating scanner")
+
+	report, err := scanner.Run(t.Context())
+	require.NoError(t, err, "no error expected running scan")
+
+	assert.False(t, report.Partial, "expected report to be complete")
+	assert.Equal(t, map[string]masscan.Results{
+		"127.0.0.1": {
+			IP: "127.0.0.1",
+			Ports: masscan.Ports{
+				{Port: openPort, Proto: "tcp", Status: "open", Reason: "connect"},
+			},
+		},
+	}, report.Results, "unexpected results")
+}
+
+func TestScanner_Run_Cancelled(t *testing.T) {
+	t.Parallel()
+
+	scanner, err := New(t.Context(),
+		WithTargets(masscan.Config{
+			MaxRate: 1,
+			Ranges:  masscan.DynamicValue[[]string]{Value: []string{"127.0.0.0/24"}},
+			Ports:   masscan.DynamicValue[[]string]{Value: []string{strconv.Itoa(testClosedPort(t))}},
+		}),
+	)
+	require.NoError(t, err, "no error expected creating scanner")
+
+	ctx, cancel := context.WithTimeout(t.Context(), 1500*time.Millisecond)
+	defer cancel()
+
+	report, err := scanner.Run(ctx)
+	require.Error(t, err, "expected error when cancelled")
+
+	assert.True(t, report.Partial, "expected report to be partial")
+}
+
+func TestTCPPorts(t *testing.T) {
+	t.Parallel()
+
+	parsed, err := masscan.ParsePorts([]string{"80,443", "T:8000-8002", "u:53", "80"})
+	require.NoError(t, err, "no error expected parsing ports")
+
+	ports, skipped := tcpPorts(parsed)
+
+	assert.Equal(t, []int{80, 443, 8000, 8001, 8002}, ports, "unexpected ports")
+	assert.Equal(t, []string{"U:53"}, skipped, "unexpected skipped ports")
+}
@@ -0,0 +1,26 @@
+package connect
+
+import "github.com/mikemrm/masscan-exporter/internal/masscan"
+
+// tcpPorts returns each tcp port within the port ranges.
+// UDP and other protocols are not supported by connect scans and are returned as skipped.
+func tcpPorts(ports []masscan.PortRange) ([]int, []string) {
+	var (
+		parsed  []int
+		skipped []string
+	)
+
+	for _, r := range ports {
+		if r.Proto != masscan.ProtoTCP {
+			skipped = append(skipped, r.String())
+
+			continue
+		}
+
+		for port := r.From; port <= r.To; port++ {
+			parsed = append(parsed, port)
+		}
+	}
+
+	return parsed, skipped
+}
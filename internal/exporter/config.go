@@ -2,12 +2,20 @@ package exporter
 
 import (
 	"github.com/mikemrm/masscan-exporter/internal/collector"
+	"github.com/mikemrm/masscan-exporter/internal/masscan"
+	"github.com/mikemrm/masscan-exporter/internal/scheduler"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
 type Config struct {
 	Registerer prometheus.Registerer  `mapstructure:"-"`
 	Collectors []*collector.Collector `mapstructure:"-"`
+
+	// Scheduler reports the state of the scheduler shared by the collectors when set.
+	Scheduler *scheduler.Scheduler `mapstructure:"-"`
+
+	// Masscan are the probed masscan binaries reported as build info.
+	Masscan []masscan.Capabilities `mapstructure:"-"`
 }
 
 func newConfig(opts ...Option) Config {
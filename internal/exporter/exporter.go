@@ -3,23 +3,36 @@ package exporter
 import (
 	"context"
 	"fmt"
+	"strings"
 
 	"github.com/mikemrm/masscan-exporter/internal/collector"
+	"github.com/mikemrm/masscan-exporter/internal/masscan"
+	"github.com/mikemrm/masscan-exporter/internal/scheduler"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/rs/zerolog"
 )
 
 var (
-	descCollectors = prometheus.NewDesc("masscan_collectors_total", "Reports the number of configured collectors.", nil, nil)
+	descCollectors             = prometheus.NewDesc("masscan_collectors_total", "Reports the number of configured collectors.", nil, nil)
+	descSchedulerRunning       = prometheus.NewDesc("masscan_scheduler_running", "Reports the number of scans started by the scheduler which are running.", nil, nil)
+	descSchedulerQueued        = prometheus.NewDesc("masscan_scheduler_queued", "Reports the number of scans waiting for the scheduler to start them.", nil, nil)
+	descSchedulerMaxConcurrent = prometheus.NewDesc("masscan_scheduler_max_concurrent", "Reports the number of scans the scheduler runs at the same time.", nil, nil)
+	descBuildInfo              = prometheus.NewDesc("masscan_build_info", "Reports the version of each masscan binary probed on start.", []string{"bin_path", "launcher", "version"}, nil)
 )
 
 type exporter struct {
 	logger     *zerolog.Logger
 	collectors []*collector.Collector
+	scheduler  *scheduler.Scheduler
+	masscan    []masscan.Capabilities
 }
 
 func (e *exporter) Describe(ch chan<- *prometheus.Desc) {
 	ch <- descCollectors
+	ch <- descSchedulerRunning
+	ch <- descSchedulerQueued
+	ch <- descSchedulerMaxConcurrent
+	ch <- descBuildInfo
 
 	collector.Describe(ch)
 }
@@ -32,6 +45,39 @@ func (e *exporter) Collect(ch chan<- prometheus.Metric) {
 		ch <- totalCollectors
 	}
 
+	if e.scheduler != nil {
+		schedulerMetrics := []struct {
+			desc  *prometheus.Desc
+			value int
+		}{
+			{descSchedulerRunning, e.scheduler.Running()},
+			{descSchedulerQueued, e.scheduler.Queued()},
+			{descSchedulerMaxConcurrent, e.scheduler.MaxConcurrent()},
+		}
+
+		for _, m := range schedulerMetrics {
+			metric, err := prometheus.NewConstMetric(m.desc, prometheus.GaugeValue, float64(m.value))
+			if err != nil {
+				e.logger.Err(err).Msg("failed to create scheduler metric")
+
+				continue
+			}
+
+			ch <- metric
+		}
+	}
+
+	for _, caps := range e.masscan {
+		buildInfo, err := prometheus.NewConstMetric(descBuildInfo, prometheus.GaugeValue, 1, caps.BinPath, strings.Join(caps.Launcher, " "), caps.Version)
+		if err != nil {
+			e.logger.Err(err).Msg("failed to create build info metric")
+
+			continue
+		}
+
+		ch <- buildInfo
+	}
+
 	for _, c := range e.collectors {
 		c.Collect(ch)
 	}
@@ -43,6 +89,8 @@ func New(ctx context.Context, opts ...Option) (prometheus.Collector, error) {
 	exporter := &exporter{
 		logger:     zerolog.Ctx(ctx),
 		collectors: cfg.Collectors,
+		scheduler:  cfg.Scheduler,
+		masscan:    cfg.Masscan,
 	}
 
 	if err := cfg.Registerer.Register(exporter); err != nil {
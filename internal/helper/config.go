@@ -0,0 +1,88 @@
+package helper
+
+import (
+	"time"
+
+	"github.com/mikemrm/masscan-exporter/internal/masscan"
+)
+
+// DefaultSocket is the unix socket the helper listens on when not configured.
+const DefaultSocket = "/run/masscan-exporter/helper.sock"
+
+type Config struct {
+	// Socket is the unix socket the helper listens on.
+	Socket string `mapstructure:"socket"`
+	// BinPath is the masscan binary run for each request.
+	BinPath string `mapstructure:"bin_path"`
+	// Dirs are the directories the files masscan reads must be within,
+	// they should match the temp_dir and resume_dir of the collectors using the helper.
+	Dirs []string `mapstructure:"dirs"`
+	// MaxRate limits the rate of each masscan process when set.
+	MaxRate int `mapstructure:"max_rate"`
+	// WaitDelay is how long masscan may take to exit after it is interrupted before it is killed.
+	WaitDelay time.Duration `mapstructure:"wait_delay"`
+}
+
+func (c Config) policy() masscan.HelperPolicy {
+	return masscan.HelperPolicy{
+		Dirs:    c.Dirs,
+		MaxRate: c.MaxRate,
+	}
+}
+
+func newConfig(opts ...Option) Config {
+	var cfg Config
+
+	for _, opt := range opts {
+		cfg = opt.apply(cfg)
+	}
+
+	if cfg.Socket == "" {
+		cfg.Socket = DefaultSocket
+	}
+
+	if cfg.BinPath == "" {
+		cfg.BinPath = masscan.DefaultBinPath
+	}
+
+	if cfg.WaitDelay <= 0 {
+		cfg.WaitDelay = masscan.DefaultWaitDelay
+	}
+
+	return cfg
+}
+
+type Option interface {
+	apply(Config) Config
+}
+
+type optionFunc func(Config) Config
+
+func (fn optionFunc) apply(cfg Config) Config {
+	return fn(cfg)
+}
+
+// WithConfig replaces the existing Config.
+func WithConfig(cfg Config) Option {
+	return optionFunc(func(_ Config) Config {
+		return cfg
+	})
+}
+
+// WithBinPath sets the masscan binary run for each request.
+func WithBinPath(path string) Option {
+	return optionFunc(func(cfg Config) Config {
+		cfg.BinPath = path
+
+		return cfg
+	})
+}
+
+// WithDirs sets the directories the files masscan reads must be within.
+func WithDirs(dirs ...string) Option {
+	return optionFunc(func(cfg Config) Config {
+		cfg.Dirs = dirs
+
+		return cfg
+	})
+}
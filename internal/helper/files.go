@@ -0,0 +1,113 @@
+package helper
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/mikemrm/masscan-exporter/internal/masscan"
+)
+
+const (
+	// maxFileSize limits the size of each file copied from a request.
+	maxFileSize = 64 << 20
+
+	// resultsChunkSize is the size of each chunk of results sent to the client.
+	resultsChunkSize = 64 << 10
+
+	// resultsFile is the name masscan writes its results to within the run directory.
+	resultsFile = "results.json"
+
+	// pausedConfFile is written by masscan to its working directory when it is interrupted.
+	pausedConfFile = "paused.conf"
+)
+
+// prepare copies the files of the request into dir, which is owned by the helper, and returns the args masscan
+// is run with. The returned args only reference files within dir, and masscan writes its results to resultsFile.
+// Files which fail the checks of readFile or masscan.HelperPolicy.CheckConfig are rejected with masscan.ErrHelperRejected.
+func (h *Helper) prepare(dir string, uid uint32, req masscan.HelperRequest, files []masscan.HelperFile) ([]string, error) {
+	args := slices.Clone(req.Args)
+	results := filepath.Join(dir, resultsFile)
+
+	// Like the exporter's temp files, the results are created before masscan runs so they are only readable by the helper.
+	if err := os.WriteFile(results, nil, 0o600); err != nil {
+		return nil, fmt.Errorf("failed to create results file: %w", err)
+	}
+
+	for i, file := range files {
+		if file.Output {
+			args[file.Arg] = results
+
+			continue
+		}
+
+		flag := req.Args[file.Arg-1]
+
+		data, err := readFile(req.Args[file.Arg], uid)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %w", masscan.ErrHelperRejected, flag, err)
+		}
+
+		if file.Config {
+			if err := h.policy.CheckConfig(string(data)); err != nil {
+				return nil, fmt.Errorf("%s: %w", flag, err)
+			}
+		}
+
+		path := filepath.Join(dir, fmt.Sprintf("file-%d", i))
+
+		if err := os.WriteFile(path, data, 0o600); err != nil {
+			return nil, fmt.Errorf("failed to copy %s: %w", flag, err)
+		}
+
+		args[file.Arg] = path
+	}
+
+	// Configs may also set an output file, the last one given is used by masscan.
+	return append(args, "--output-filename", results), nil
+}
+
+// sendResults sends the results and paused.conf masscan wrote to dir.
+func sendResults(w *messageWriter, dir string) error {
+	f, err := os.Open(filepath.Join(dir, resultsFile))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	if err == nil {
+		defer f.Close()
+
+		buf := make([]byte, resultsChunkSize)
+
+		for {
+			n, err := f.Read(buf)
+			if n > 0 {
+				if err := w.send(masscan.HelperMessage{Results: buf[:n]}); err != nil {
+					return err
+				}
+			}
+
+			if errors.Is(err, io.EOF) {
+				break
+			}
+
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	paused, err := os.ReadFile(filepath.Join(dir, pausedConfFile))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+
+		return err
+	}
+
+	return w.send(masscan.HelperMessage{Paused: paused})
+}
@@ -0,0 +1,10 @@
+//go:build !unix
+
+package helper
+
+import "errors"
+
+// readFile returns an error, the owner and permissions of files can only be checked on unix.
+func readFile(_ string, _ uint32) ([]byte, error) {
+	return nil, errors.New("request files are only supported on unix")
+}
@@ -0,0 +1,50 @@
+//go:build unix
+
+package helper
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"syscall"
+)
+
+// readFile reads the file at path, which must be a regular file owned by uid and not writable by other users.
+// The checks are made on the opened file without following symlinks, so the file can not be swapped after it is checked.
+func readFile(path string, uid uint32) ([]byte, error) {
+	// O_NONBLOCK prevents opening a fifo from blocking before it can be rejected.
+	f, err := os.OpenFile(path, os.O_RDONLY|syscall.O_NOFOLLOW|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	if !info.Mode().IsRegular() {
+		return nil, fmt.Errorf("'%s' must be a regular file", path)
+	}
+
+	if info.Mode().Perm()&0o022 != 0 {
+		return nil, fmt.Errorf("'%s' must not be writable by other users", path)
+	}
+
+	if stat, ok := info.Sys().(*syscall.Stat_t); !ok || stat.Uid != uid {
+		return nil, fmt.Errorf("'%s' must be owned by the client's user", path)
+	}
+
+	data, err := io.ReadAll(io.LimitReader(f, maxFileSize+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(data) > maxFileSize {
+		return nil, fmt.Errorf("'%s' exceeds %d bytes", path, maxFileSize)
+	}
+
+	return data, nil
+}
@@ -0,0 +1,99 @@
+//go:build unix
+
+package helper
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadFile(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	uid := uint32(os.Geteuid())
+
+	writeFile := func(name string, mode os.FileMode) string {
+		path := filepath.Join(dir, name)
+
+		require.NoError(t, os.WriteFile(path, []byte("10.0.0.5\n"), 0o600), "no error expected writing file")
+		require.NoError(t, os.Chmod(path, mode), "no error expected setting file mode")
+
+		return path
+	}
+
+	file := writeFile("excludes.txt", 0o644)
+	writable := writeFile("writable.txt", 0o666)
+
+	link := filepath.Join(dir, "link.txt")
+	require.NoError(t, os.Symlink(file, link), "no error expected creating symlink")
+
+	fifo := filepath.Join(dir, "fifo")
+	require.NoError(t, syscall.Mkfifo(fifo, 0o600), "no error expected creating fifo")
+
+	testCases := []struct {
+		name      string
+		path      string
+		uid       uint32
+		expectErr string
+	}{
+		{
+			name: "file",
+			path: file,
+			uid:  uid,
+		},
+		{
+			name:      "symlink",
+			path:      link,
+			uid:       uid,
+			expectErr: "too many levels of symbolic links",
+		},
+		{
+			name:      "writable",
+			path:      writable,
+			uid:       uid,
+			expectErr: "must not be writable by other users",
+		},
+		{
+			name:      "fifo",
+			path:      fifo,
+			uid:       uid,
+			expectErr: "must be a regular file",
+		},
+		{
+			name:      "directory",
+			path:      dir,
+			uid:       uid,
+			expectErr: "must be a regular file",
+		},
+		{
+			name:      "other owner",
+			path:      file,
+			uid:       uid + 1,
+			expectErr: "must be owned by the client's user",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			data, err := readFile(tc.path, tc.uid)
+
+			if tc.expectErr == "" {
+				require.NoError(t, err, "no error expected reading file")
+
+				assert.Equal(t, "10.0.0.5\n", string(data), "unexpected file contents")
+
+				return
+			}
+
+			assert.ErrorContains(t, err, tc.expectErr, "unexpected error")
+		})
+	}
+}
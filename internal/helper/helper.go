@@ -0,0 +1,258 @@
+// Package helper runs masscan on behalf of an unprivileged exporter.
+//
+// The helper is the only process which requires raw socket permissions. It listens on a unix socket
+// and only runs masscan for requests which pass validation by masscan.HelperPolicy.
+// Files masscan reads are copied into a directory owned by the helper, where masscan also writes its results.
+package helper
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/mikemrm/masscan-exporter/internal/masscan"
+	"github.com/rs/zerolog"
+)
+
+var ErrDirsRequired = errors.New("helper requires dirs to be configured")
+
+// socketMode allows the exporter to connect when it shares the helper's group.
+const socketMode = 0660
+
+type Helper struct {
+	logger *zerolog.Logger
+	cfg    Config
+	policy masscan.HelperPolicy
+}
+
+// ListenAndServe listens on the configured socket and serves requests until the context is canceled.
+// A stale socket left by a previous helper is removed.
+func (h *Helper) ListenAndServe(ctx context.Context) error {
+	if err := os.Remove(h.cfg.Socket); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove stale socket: %w", err)
+	}
+
+	var lc net.ListenConfig
+
+	listener, err := lc.Listen(ctx, "unix", h.cfg.Socket)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Chmod(h.cfg.Socket, socketMode); err != nil {
+		listener.Close()
+
+		return fmt.Errorf("failed to set socket permissions: %w", err)
+	}
+
+	return h.Serve(ctx, listener)
+}
+
+// Serve handles connections from the listener until the context is canceled.
+// Any running scans are interrupted before Serve returns.
+func (h *Helper) Serve(ctx context.Context, listener net.Listener) error {
+	var wg sync.WaitGroup
+
+	defer wg.Wait()
+
+	go func() {
+		<-ctx.Done()
+
+		listener.Close()
+	}()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+
+			return err
+		}
+
+		wg.Go(func() {
+			h.handle(ctx, conn)
+		})
+	}
+}
+
+// messageWriter sends each write as output to the client.
+type messageWriter struct {
+	mu      sync.Mutex
+	encoder *json.Encoder
+}
+
+func (w *messageWriter) send(msg masscan.HelperMessage) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.encoder.Encode(msg)
+}
+
+// Write never fails, so masscan is not blocked if the client is gone. The client closing the connection
+// is detected by handle, which stops masscan.
+func (w *messageWriter) Write(p []byte) (int, error) {
+	w.send(masscan.HelperMessage{Output: p})
+
+	return len(p), nil
+}
+
+func (h *Helper) handle(ctx context.Context, conn net.Conn) {
+	defer conn.Close()
+
+	decoder := json.NewDecoder(conn)
+	writer := &messageWriter{encoder: json.NewEncoder(conn)}
+
+	var req masscan.HelperRequest
+
+	if err := decoder.Decode(&req); err != nil {
+		h.logger.Warn().Err(err).Msg("failed to decode request")
+
+		return
+	}
+
+	logger := h.logger.With().Strs("args", req.Args).Logger()
+
+	uid, err := peerUID(conn)
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to get client credentials")
+
+		writer.send(masscan.HelperMessage{Error: err.Error()})
+
+		return
+	}
+
+	files, err := h.policy.Validate(req)
+	if err != nil {
+		logger.Warn().Err(err).Msg("request rejected")
+
+		writer.send(masscan.HelperMessage{Rejected: err.Error()})
+
+		return
+	}
+
+	// masscan only uses files in a directory owned by the helper, so the client can not change them once checked.
+	dir, err := os.MkdirTemp("", "masscan-helper-*")
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to create run directory")
+
+		writer.send(masscan.HelperMessage{Error: err.Error()})
+
+		return
+	}
+
+	defer os.RemoveAll(dir)
+
+	args, err := h.prepare(dir, uid, req, files)
+	if err != nil {
+		if errors.Is(err, masscan.ErrHelperRejected) {
+			logger.Warn().Err(err).Msg("request rejected")
+
+			writer.send(masscan.HelperMessage{Rejected: err.Error()})
+		} else {
+			logger.Error().Err(err).Msg("failed to prepare request files")
+
+			writer.send(masscan.HelperMessage{Error: err.Error()})
+		}
+
+		return
+	}
+
+	cmd := exec.Command(h.cfg.BinPath, args...)
+	cmd.Dir = dir
+	cmd.Stdout = writer
+	cmd.Stderr = writer
+
+	if err := cmd.Start(); err != nil {
+		logger.Error().Err(err).Msg("failed to start masscan")
+
+		writer.send(masscan.HelperMessage{Error: err.Error()})
+
+		return
+	}
+
+	logger.Info().Int("pid", cmd.Process.Pid).Msg("masscan started")
+
+	exited := make(chan struct{})
+
+	go func() {
+		// The client closes the connection or its write side to stop masscan.
+		closed := make(chan struct{})
+
+		go func() {
+			io.Copy(io.Discard, io.MultiReader(decoder.Buffered(), conn))
+
+			close(closed)
+		}()
+
+		select {
+		case <-exited:
+			return
+		case <-closed:
+		case <-ctx.Done():
+		}
+
+		logger.Info().Msg("interrupting masscan")
+
+		cmd.Process.Signal(os.Interrupt)
+
+		select {
+		case <-exited:
+		case <-time.After(h.cfg.WaitDelay):
+			logger.Warn().Msg("masscan did not exit after being interrupted, killing")
+
+			cmd.Process.Kill()
+		}
+	}()
+
+	err = cmd.Wait()
+
+	close(exited)
+
+	var exitErr *exec.ExitError
+
+	switch {
+	case err == nil:
+	case errors.As(err, &exitErr):
+	default:
+		logger.Error().Err(err).Msg("failed to run masscan")
+
+		writer.send(masscan.HelperMessage{Error: err.Error()})
+
+		return
+	}
+
+	logger.Info().Int("exit_code", cmd.ProcessState.ExitCode()).Msg("masscan exited")
+
+	if err := sendResults(writer, dir); err != nil {
+		logger.Error().Err(err).Msg("failed to send results")
+
+		writer.send(masscan.HelperMessage{Error: err.Error()})
+
+		return
+	}
+
+	writer.send(masscan.HelperMessage{Done: true, ExitCode: cmd.ProcessState.ExitCode()})
+}
+
+func New(ctx context.Context, opts ...Option) (*Helper, error) {
+	cfg := newConfig(opts...)
+
+	if len(cfg.Dirs) == 0 {
+		return nil, ErrDirsRequired
+	}
+
+	return &Helper{
+		logger: zerolog.Ctx(ctx),
+		cfg:    cfg,
+		policy: cfg.policy(),
+	}, nil
+}
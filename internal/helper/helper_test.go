@@ -0,0 +1,196 @@
+//go:build linux
+
+package helper_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mikemrm/masscan-exporter/internal/helper"
+	"github.com/mikemrm/masscan-exporter/internal/masscan"
+	"github.com/mikemrm/masscan-exporter/internal/masscan/masscantest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMain(m *testing.M) {
+	masscantest.Main(m)
+}
+
+// serve starts a helper running the simulator which accepts files within dir, returning its socket.
+func serve(t *testing.T, sim *masscantest.Simulator, dir string) string {
+	t.Helper()
+
+	socket := filepath.Join(t.TempDir(), "helper.sock")
+
+	h, err := helper.New(t.Context(),
+		helper.WithConfig(helper.Config{WaitDelay: 100 * time.Millisecond}),
+		helper.WithBinPath(sim.Path()),
+		helper.WithDirs(dir),
+	)
+	require.NoError(t, err, "no error expected creating helper")
+
+	listener, err := net.Listen("unix", socket)
+	require.NoError(t, err, "no error expected listening on socket")
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	served := make(chan error, 1)
+
+	go func() {
+		served <- h.Serve(ctx, listener)
+	}()
+
+	t.Cleanup(func() {
+		cancel()
+
+		assert.NoError(t, <-served, "no error expected serving helper")
+	})
+
+	return socket
+}
+
+func TestHelper_Run(t *testing.T) {
+	t.Parallel()
+
+	sim := masscantest.New(t, masscantest.Scenario{
+		Results: []masscan.RawResult{
+			{IP: "10.0.0.1", Timestamp: "1745695800", Ports: []masscan.RawPort{{Port: masscan.Port{Port: 80, Proto: "tcp", Status: "open"}}}},
+		},
+		Stderr: "Scanning 256 hosts [1 ports/host]\n",
+	})
+
+	dir := t.TempDir()
+
+	m, err := masscan.New(t.Context(), masscan.WithConfig(masscan.Config{
+		Helper:   serve(t, sim, dir),
+		TempDir:  dir,
+		Ranges:   masscan.DynamicValue[[]string]{Value: []string{"10.0.0.0/24"}},
+		Ports:    masscan.DynamicValue[[]string]{Value: []string{"80"}},
+		Excludes: masscan.DynamicValue[[]string]{Value: []string{"10.0.0.5"}},
+	}))
+	require.NoError(t, err, "no error expected creating masscan")
+
+	report, err := m.Run(t.Context())
+	require.NoError(t, err, "no error expected running masscan through the helper")
+
+	assert.False(t, report.Partial, "expected report to be complete")
+	assert.Len(t, report.Results, 1, "unexpected number of hosts")
+
+	require.NotNil(t, report.Stats, "expected run stats")
+	assert.Equal(t, uint64(256), report.Stats.Hosts, "expected output to be streamed from the helper")
+
+	invocations := sim.Invocations(t)
+	require.Len(t, invocations, 1, "expected masscan to be executed once")
+
+	assert.Equal(t, "10.0.0.5\n", invocations[0].Files["--excludefile"], "unexpected excludes file contents")
+
+	for _, arg := range invocations[0].Args {
+		assert.NotContains(t, arg, dir, "expected masscan to only be given copies of the request files")
+	}
+
+	assert.NotEqual(t, dir, filepath.Dir(invocations[0].Dir), "expected masscan to run in a directory owned by the helper")
+
+	// The directory is removed once the request is handled, which may be after the client has received the results.
+	assert.Eventually(t, func() bool {
+		_, err := os.Stat(invocations[0].Dir)
+
+		return errors.Is(err, os.ErrNotExist)
+	}, time.Second, time.Millisecond, "expected the helper to remove its directory")
+}
+
+func TestHelper_Rejected(t *testing.T) {
+	t.Parallel()
+
+	sim := masscantest.New(t, masscantest.Scenario{})
+
+	m, err := masscan.New(t.Context(), masscan.WithConfig(masscan.Config{
+		Helper:   serve(t, sim, t.TempDir()),
+		TempDir:  t.TempDir(),
+		Ranges:   masscan.DynamicValue[[]string]{Value: []string{"10.0.0.0/24"}},
+		Ports:    masscan.DynamicValue[[]string]{Value: []string{"80"}},
+		Excludes: masscan.DynamicValue[[]string]{Value: []string{"10.0.0.5"}},
+	}))
+	require.NoError(t, err, "no error expected creating masscan")
+
+	_, err = m.Run(t.Context())
+	require.ErrorIs(t, err, masscan.ErrHelperRejected, "expected excludes outside of the helper dirs to be rejected")
+
+	assert.Equal(t, masscan.ReasonInvalidConfig, masscan.ErrorReason(err), "unexpected error reason")
+	assert.Empty(t, sim.Invocations(t), "expected masscan to not be executed")
+}
+
+func TestHelper_ExitFailure(t *testing.T) {
+	t.Parallel()
+
+	sim := masscantest.New(t, masscantest.Scenario{
+		Stderr:   "FAIL: could not determine default interface\n",
+		NoOutput: true,
+		ExitCode: 1,
+	})
+
+	dir := t.TempDir()
+
+	m, err := masscan.New(t.Context(), masscan.WithConfig(masscan.Config{
+		Helper:  serve(t, sim, dir),
+		TempDir: dir,
+		Ranges:  masscan.DynamicValue[[]string]{Value: []string{"10.0.0.0/24"}},
+		Ports:   masscan.DynamicValue[[]string]{Value: []string{"80"}},
+	}))
+	require.NoError(t, err, "no error expected creating masscan")
+
+	_, err = m.Run(t.Context())
+	require.ErrorIs(t, err, masscan.ErrExit, "expected exit error")
+
+	assert.ErrorContains(t, err, "could not determine default interface", "expected masscan output in error")
+}
+
+func TestHelper_Interrupt(t *testing.T) {
+	t.Parallel()
+
+	sim := masscantest.New(t, masscantest.Scenario{
+		Delay:            time.Minute,
+		PauseOnInterrupt: true,
+		PartialResults: []masscan.RawResult{
+			{IP: "10.0.0.1", Timestamp: "1745695800", Ports: []masscan.RawPort{{Port: masscan.Port{Port: 80, Proto: "tcp", Status: "open"}}}},
+		},
+	})
+
+	dir := t.TempDir()
+
+	m, err := masscan.New(t.Context(), masscan.WithConfig(masscan.Config{
+		Helper:    serve(t, sim, dir),
+		TempDir:   dir,
+		WaitDelay: 5 * time.Second,
+		Resume:    true,
+		ResumeDir: filepath.Join(dir, "resume"),
+		Ranges:    masscan.DynamicValue[[]string]{Value: []string{"10.0.0.0/24"}},
+		Ports:     masscan.DynamicValue[[]string]{Value: []string{"80"}},
+	}))
+	require.NoError(t, err, "no error expected creating masscan")
+
+	ctx, cancel := context.WithTimeout(t.Context(), 500*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+
+	report, err := m.Run(ctx)
+	require.ErrorIs(t, err, masscan.ErrTimeout, "expected timeout error")
+
+	assert.Less(t, time.Since(start), 5*time.Second, "expected masscan to be interrupted by the helper")
+	assert.True(t, report.Partial, "expected report to be partial")
+	assert.Len(t, report.Results, 1, "expected partial results to be kept")
+	assert.FileExists(t, filepath.Join(dir, "resume", "paused.conf"), "expected masscan to pause in the resume dir")
+}
+
+func TestNew_DirsRequired(t *testing.T) {
+	t.Parallel()
+
+	_, err := helper.New(t.Context())
+	require.ErrorIs(t, err, helper.ErrDirsRequired, "expected dirs to be required")
+}
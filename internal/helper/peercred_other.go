@@ -0,0 +1,14 @@
+//go:build !linux
+
+package helper
+
+import (
+	"errors"
+	"net"
+)
+
+// peerUID returns an error, the credentials of clients are only available on linux.
+// Without them the helper can not check the owner of request files, so it does not run requests.
+func peerUID(_ net.Conn) (uint32, error) {
+	return 0, errors.New("client credentials are only supported on linux")
+}
@@ -2,8 +2,11 @@ package masscan
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"io"
 	"net/http"
+	"os"
 	"reflect"
 	"slices"
 	"strings"
@@ -16,6 +19,16 @@ const (
 	DefaultBinPath   = "/usr/bin/masscan"
 	DefaultTempDir   = "/tmp"
 	DefaultWaitDelay = 20 * time.Second
+
+	// DefaultMaxRate is the rate masscan transmits at when max_rate is not set.
+	DefaultMaxRate = 100
+)
+
+var (
+	ErrBannersSourceRequired = errors.New("banners requires source_ip or source_port to be configured")
+	ErrInvalidShards         = errors.New("invalid shards")
+	ErrResumeDirRequired     = errors.New("resume requires resume_dir to be configured")
+	ErrResumeShards          = errors.New("resume is not supported with shards")
 )
 
 type Config struct {
@@ -24,11 +37,170 @@ type Config struct {
 	WaitDelay time.Duration `mapstructure:"wait_delay"`
 	MaxRate   int           `mapstructure:"max_rate"`
 
-	Ranges DynamicValue[[]string] `mapstructure:"ranges"`
-	Ports  DynamicValue[[]string] `mapstructure:"ports"`
+	// Launcher prefixes the masscan command, such as sudo or nsenter, so the exporter may run unprivileged.
+	// The launcher must forward interrupts to masscan for scans to stop gracefully.
+	Launcher []string `mapstructure:"launcher"`
+
+	// Helper is the unix socket of a privileged helper which runs masscan on behalf of the exporter.
+	// BinPath and Launcher are ignored, the helper runs its own masscan binary.
+	Helper string `mapstructure:"helper"`
+
+	// Banners enables banner grabbing, which requires a SourceIP or SourcePort
+	// that the operating system's network stack will not reset connections for.
+	Banners    bool   `mapstructure:"banners"`
+	SourceIP   string `mapstructure:"source_ip"`
+	SourcePort string `mapstructure:"source_port"`
+
+	// Network and transmit options, each is passed to masscan as the argument of the same name.
+	// They must not also be set in Config or ConfigPath.
+	Adapter        string         `mapstructure:"adapter"`
+	AdapterIP      string         `mapstructure:"adapter_ip"`
+	AdapterMAC     string         `mapstructure:"adapter_mac"`
+	RouterMAC      string         `mapstructure:"router_mac"`
+	Retries        int            `mapstructure:"retries"`
+	Wait           *time.Duration `mapstructure:"wait"`
+	TTL            int            `mapstructure:"ttl"`
+	RandomizeHosts bool           `mapstructure:"randomize_hosts"`
+	Seed           *int64         `mapstructure:"seed"`
+	PacketTrace    bool           `mapstructure:"packet_trace"`
+
+	// Ranges may include hostnames and srv: prefixed SRV names, which are resolved each run using DNS or Resolver.
+	Ranges   DynamicValue[[]string] `mapstructure:"ranges"`
+	Ports    DynamicValue[[]string] `mapstructure:"ports"`
+	Excludes DynamicValue[[]string] `mapstructure:"excludes"`
+
+	// PortGroups may be referenced within Ports, such as @web or top:100, in addition to the BuiltinPortGroups.
+	PortGroups PortGroups `mapstructure:"-"`
+
+	DNS DNSConfig `mapstructure:"dns"`
+
+	// Resolver overrides the resolver built from DNS.
+	Resolver Resolver `mapstructure:"-"`
 
 	Config     DynamicValue[string] `mapstructure:"config"`
 	ConfigPath string               `mapstructure:"config_path"`
+
+	// Shards splits the scan across multiple concurrent masscan processes using --shard.
+	// Unless set per shard, MaxRate is divided evenly across the shards.
+	Shards       int            `mapstructure:"shards"`
+	ShardOptions []ShardOptions `mapstructure:"shard_options"`
+
+	// Resume keeps the paused.conf masscan writes when a run is cancelled in ResumeDir,
+	// and continues the scan from it on the next run. ResumeDir must not be shared.
+	Resume    bool   `mapstructure:"resume"`
+	ResumeDir string `mapstructure:"resume_dir"`
+}
+
+// ShardOptions overrides options for an individual shard, matched by index.
+type ShardOptions struct {
+	Adapter string `mapstructure:"adapter"`
+	MaxRate int    `mapstructure:"max_rate"`
+}
+
+func (c Config) Validate() error {
+	if c.Banners && c.SourceIP == "" && c.SourcePort == "" {
+		return ErrBannersSourceRequired
+	}
+
+	if c.Helper != "" && len(c.Launcher) != 0 {
+		return fmt.Errorf("%w: launcher and helper must not both be set", ErrInvalidOption)
+	}
+
+	if err := c.validateNetwork(); err != nil {
+		return err
+	}
+
+	if err := c.checkStaticConfigConflicts(); err != nil {
+		return err
+	}
+
+	if err := c.DNS.validate(); err != nil {
+		return err
+	}
+
+	// Dynamic targets are validated when they are loaded at run time.
+	if c.Ranges.static() {
+		if _, err := ParseRanges(withoutNames(c.Ranges.Value)); err != nil {
+			return err
+		}
+	}
+
+	if c.Excludes.static() {
+		if _, err := ParseRanges(c.Excludes.Value); err != nil {
+			return err
+		}
+	}
+
+	if err := c.PortGroups.Validate(); err != nil {
+		return err
+	}
+
+	if c.Ports.static() {
+		ports, _, err := c.PortGroups.Expand(c.Ports.Value)
+		if err != nil {
+			return err
+		}
+
+		if _, err := ParsePorts(ports); err != nil {
+			return err
+		}
+	}
+
+	if c.Shards < 0 {
+		return fmt.Errorf("%w: shards must not be negative", ErrInvalidShards)
+	}
+
+	if len(c.ShardOptions) > c.Shards {
+		return fmt.Errorf("%w: %d shard_options provided for %d shards", ErrInvalidShards, len(c.ShardOptions), c.Shards)
+	}
+
+	if c.Resume {
+		if c.ResumeDir == "" {
+			return ErrResumeDirRequired
+		}
+
+		if c.Shards > 1 {
+			return ErrResumeShards
+		}
+	}
+
+	return nil
+}
+
+// LoadValues returns a copy of the config with the config, ranges, ports and excludes loaded into static values,
+// so the config may be run elsewhere without access to their sources.
+func (c Config) LoadValues(ctx context.Context) (Config, error) {
+	config, err := c.Config.GetValue(ctx)
+	if err != nil {
+		return c, fmt.Errorf("%w for config: %w", ErrLoadValue, err)
+	}
+
+	ranges, err := c.Ranges.GetValue(ctx)
+	if err != nil {
+		return c, fmt.Errorf("%w for ranges: %w", ErrLoadValue, err)
+	}
+
+	ports, err := c.Ports.GetValue(ctx)
+	if err != nil {
+		return c, fmt.Errorf("%w for ports: %w", ErrLoadValue, err)
+	}
+
+	excludes, err := c.Excludes.GetValue(ctx)
+	if err != nil {
+		return c, fmt.Errorf("%w for excludes: %w", ErrLoadValue, err)
+	}
+
+	c.Config = DynamicValue[string]{Value: config}
+	c.Ranges = DynamicValue[[]string]{Value: ranges}
+	c.Ports = DynamicValue[[]string]{Value: ports}
+	c.Excludes = DynamicValue[[]string]{Value: excludes}
+
+	return c, nil
+}
+
+// Dynamic reports if the config, ranges, ports or excludes are loaded from a source when run.
+func (c Config) Dynamic() bool {
+	return !c.Config.static() || !c.Ranges.static() || !c.Ports.static() || !c.Excludes.static()
 }
 
 func newConfig(opts ...Option) Config {
@@ -86,20 +258,110 @@ func WithPorts(ports ...string) Option {
 	})
 }
 
+func WithExcludes(excludes ...string) Option {
+	return optionFunc(func(cfg Config) Config {
+		cfg.Excludes.Value = append(slices.Clone(cfg.Excludes.Value), excludes...)
+
+		return cfg
+	})
+}
+
+// WithPortGroups sets the port groups which may be referenced within ports.
+func WithPortGroups(groups PortGroups) Option {
+	return optionFunc(func(cfg Config) Config {
+		cfg.PortGroups = groups
+
+		return cfg
+	})
+}
+
+// WithResolver sets the resolver used to resolve hostnames within ranges.
+func WithResolver(resolver Resolver) Option {
+	return optionFunc(func(cfg Config) Config {
+		cfg.Resolver = resolver
+
+		return cfg
+	})
+}
+
+// RunOptions configures a single scan run.
+type RunOptions struct {
+	// Progress is called with each status update while the scan is running.
+	Progress ProgressFunc
+
+	// Estimate is called with the estimate of the scan before it starts.
+	Estimate EstimateFunc
+
+	// MaxRate overrides the configured max rate when greater than 0.
+	MaxRate int
+}
+
+// NewRunOptions builds the RunOptions for the provided options.
+func NewRunOptions(opts ...RunOption) RunOptions {
+	var options RunOptions
+
+	for _, opt := range opts {
+		options = opt.applyRun(options)
+	}
+
+	return options
+}
+
+// RunOption configures a single scan run.
+type RunOption interface {
+	applyRun(RunOptions) RunOptions
+}
+
+type runOptionFunc func(RunOptions) RunOptions
+
+func (fn runOptionFunc) applyRun(opts RunOptions) RunOptions {
+	return fn(opts)
+}
+
+// WithProgress sets the function called with status updates while the scan is running.
+func WithProgress(fn ProgressFunc) RunOption {
+	return runOptionFunc(func(opts RunOptions) RunOptions {
+		opts.Progress = fn
+
+		return opts
+	})
+}
+
+// WithEstimate sets the function called with the estimate of the scan before it starts,
+// returning an error from fn stops the scan.
+func WithEstimate(fn EstimateFunc) RunOption {
+	return runOptionFunc(func(opts RunOptions) RunOptions {
+		opts.Estimate = fn
+
+		return opts
+	})
+}
+
+// WithMaxRate overrides the configured max rate for the run.
+// When scanning with shards, the rate is divided evenly and any per shard max rates are ignored.
+func WithMaxRate(rate int) RunOption {
+	return runOptionFunc(func(opts RunOptions) RunOptions {
+		opts.MaxRate = rate
+
+		return opts
+	})
+}
+
 // DynamicValue allows for a value to be dynamically loaded.
 //
 // When loaded from configuration no matter the DynamicValue T type,
-// if provided a string prefixed with env://, file://, http://, or https://.
+// if provided a string prefixed with env://, file://, exec://, http://, or https://.
 // The appropriate field is configured.
 //
 // Any other string value is considered static and will be used as is,
 // if the field supports that data type.
 type DynamicValue[T any] struct {
-	Value     T         `mapstructure:"value"`
-	Env       string    `mapstructure:"env"`
-	File      string    `mapstructure:"file"`
-	URL       string    `mapstructure:"url"`
-	URLConfig URLConfig `mapstructure:"url_config"`
+	Value     T          `mapstructure:"value"`
+	Env       string     `mapstructure:"env"`
+	File      string     `mapstructure:"file"`
+	URL       string     `mapstructure:"url"`
+	URLConfig URLConfig  `mapstructure:"url_config"`
+	Exec      ExecConfig `mapstructure:"exec"`
 
 	empty T
 }
@@ -122,7 +384,12 @@ func (v DynamicValue[T]) valueEmpty() bool {
 
 // Configured returns true if any field (except URLConfig) is configured.
 func (v DynamicValue[T]) Configured() bool {
-	return !v.valueEmpty() || v.Env != "" || v.File != "" || v.URL != ""
+	return !v.valueEmpty() || v.Env != "" || v.File != "" || v.URL != "" || v.Exec.Command != ""
+}
+
+// static reports if the value is set directly rather than loaded from a source.
+func (v DynamicValue[T]) static() bool {
+	return v.Env == "" && v.File == "" && v.URL == "" && v.Exec.Command == ""
 }
 
 // GetValue will return the static value if it is not empty.
@@ -139,6 +406,8 @@ func (v DynamicValue[T]) GetValue(ctx context.Context) (T, error) {
 		return loadFile[T](ctx, v.File)
 	case v.URL != "":
 		return loadURL[T](ctx, v.URL, v.URLConfig)
+	case v.Exec.Command != "":
+		return loadExec[T](ctx, v.Exec)
 	}
 
 	return v.empty, nil
@@ -162,6 +431,18 @@ func (v *DynamicValue[T]) UnmarshalMapstructure(input any) error {
 			case "http", "https":
 				v.URL = value
 
+				return nil
+			case "exec":
+				command := strings.Fields(remain)
+				if len(command) == 0 {
+					return fmt.Errorf("%w: exec:// requires a command", ErrInvalidOption)
+				}
+
+				v.Exec = ExecConfig{
+					Command: command[0],
+					Args:    command[1:],
+				}
+
 				return nil
 			}
 		}
@@ -170,6 +451,7 @@ func (v *DynamicValue[T]) UnmarshalMapstructure(input any) error {
 	type dynamicValue DynamicValue[T]
 
 	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		DecodeHook:  mapstructure.StringToTimeDurationHookFunc(),
 		ErrorUnused: true,
 		ZeroFields:  true,
 		Result:      (*dynamicValue)(v),
@@ -228,6 +510,32 @@ func (c URLConfig) getHeaders() map[string]string {
 	return ret
 }
 
+// ExecConfig runs a command to load the value from its stdout.
+// Env values may use the env:// or file:// prefix to load its value dynamically.
+type ExecConfig struct {
+	Command string   `mapstructure:"command"`
+	Args    []string `mapstructure:"args"`
+
+	// Env sets additional environment variables, the command inherits the exporter's environment.
+	Env map[string]string `mapstructure:"env"`
+
+	// Dir is the working directory of the command, the exporter's working directory is used when empty.
+	Dir string `mapstructure:"dir"`
+
+	// Timeout limits how long the command may run, no limit is applied when 0.
+	Timeout time.Duration `mapstructure:"timeout"`
+}
+
+func (c ExecConfig) getEnv() []string {
+	env := os.Environ()
+
+	for k, v := range c.Env {
+		env = append(env, k+"="+loadValue(v))
+	}
+
+	return env
+}
+
 // URLAuthConfig provides basic an bearer options for authorization.
 // Any value may be prefixed with env:// or file:// to dynamically load the value.
 type URLAuthConfig struct {
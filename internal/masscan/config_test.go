@@ -8,6 +8,7 @@ import (
 	"regexp"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/go-viper/mapstructure/v2"
 	"github.com/stretchr/testify/assert"
@@ -231,6 +232,46 @@ func TestDynamicValue_GetValue(t *testing.T) {
 			},
 			expectValue: []string{"env", "slice"},
 		},
+		{
+			name: "exec string",
+			stringConfig: &DynamicValue[string]{
+				Exec: ExecConfig{Command: "echo", Args: []string{"exec string"}},
+			},
+			expectValue: "exec string",
+		},
+		{
+			name: "exec slice",
+			sliceConfig: &DynamicValue[[]string]{
+				Exec: ExecConfig{
+					Command: "sh",
+					Args:    []string{"-c", `printf '%s\n' "$EXEC_VALUE"; cat test.file`},
+					Env:     map[string]string{"EXEC_VALUE": "env://" + testEnvValue(t, "exec slice", "10.0.0.0/24")},
+					Dir:     filepath.Dir(testFileValue(t, "10.1.0.0/24")),
+				},
+			},
+			expectValue: []string{"10.0.0.0/24", "10.1.0.0/24"},
+		},
+		{
+			name: "exec failure",
+			stringConfig: &DynamicValue[string]{
+				Exec: ExecConfig{Command: "sh", Args: []string{"-c", "echo partial; echo not logged in >&2; exit 3"}},
+			},
+			expectError: "exit status 3: not logged in",
+		},
+		{
+			name: "exec timeout",
+			stringConfig: &DynamicValue[string]{
+				Exec: ExecConfig{Command: "sleep", Args: []string{"5"}, Timeout: 50 * time.Millisecond},
+			},
+			expectError: "context deadline exceeded",
+		},
+		{
+			name: "exec not found",
+			stringConfig: &DynamicValue[string]{
+				Exec: ExecConfig{Command: "/not/a/command"},
+			},
+			expectError: "error running command '/not/a/command'",
+		},
 	}
 
 	for _, tc := range testCases {
@@ -266,6 +307,55 @@ func TestDynamicValue_GetValue(t *testing.T) {
 	}
 }
 
+func TestLoadExec(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name        string
+		config      ExecConfig
+		expectValue string
+		expectError string
+	}{
+		{
+			name:        "background process holds output open",
+			config:      ExecConfig{Command: "sh", Args: []string{"-c", "sleep 5 & echo value"}},
+			expectValue: "value",
+		},
+		{
+			name:        "timeout with background process",
+			config:      ExecConfig{Command: "sh", Args: []string{"-c", "sleep 5 & sleep 5"}, Timeout: 50 * time.Millisecond},
+			expectError: "context deadline exceeded",
+		},
+		{
+			name:        "output limit",
+			config:      ExecConfig{Command: "yes"},
+			expectError: errExecOutputLimit.Error(),
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			start := time.Now()
+
+			value, err := loadExec[string](t.Context(), tc.config)
+
+			assert.Less(t, time.Since(start), 3*time.Second, "expected command to return without waiting on background processes")
+
+			if tc.expectError != "" {
+				require.ErrorContains(t, err, tc.expectError, "unexpected error returned from loadExec")
+
+				return
+			}
+
+			require.NoError(t, err, "no error expected to be returned from loadExec")
+
+			assert.Equal(t, tc.expectValue, value, "unexpected value returned from loadExec")
+		})
+	}
+}
+
 func TestDynamicValue_UnmarshalMapstructure(t *testing.T) {
 	t.Parallel()
 
@@ -337,6 +427,45 @@ func TestDynamicValue_UnmarshalMapstructure(t *testing.T) {
 			},
 			"",
 		},
+		{
+			"exec string (dynamic string)",
+			"exec:///usr/local/bin/netcli ranges --zone external",
+			DynamicValue[[]string]{
+				Exec: ExecConfig{
+					Command: "/usr/local/bin/netcli",
+					Args:    []string{"ranges", "--zone", "external"},
+				},
+			},
+			"",
+		},
+		{
+			"exec without command",
+			"exec://",
+			DynamicValue[string]{},
+			"exec:// requires a command",
+		},
+		{
+			"exec with config (dynamic struct)",
+			map[string]any{
+				"exec": map[string]any{
+					"command": "pass",
+					"args":    []any{"show", "scanner/token"},
+					"env":     map[string]any{"PASSWORD_STORE_DIR": "/var/lib/pass"},
+					"dir":     "/var/lib/pass",
+					"timeout": "10s",
+				},
+			},
+			DynamicValue[string]{
+				Exec: ExecConfig{
+					Command: "pass",
+					Args:    []string{"show", "scanner/token"},
+					Env:     map[string]string{"PASSWORD_STORE_DIR": "/var/lib/pass"},
+					Dir:     "/var/lib/pass",
+					Timeout: 10 * time.Second,
+				},
+			},
+			"",
+		},
 		{
 			"env string (dynamic struct)",
 			map[string]any{
@@ -453,3 +582,164 @@ func TestDynamicValue_UnmarshalMapstructure(t *testing.T) {
 		})
 	}
 }
+
+func TestConfig_Validate(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name        string
+		config      Config
+		expectError error
+	}{
+		{
+			"empty",
+			Config{},
+			nil,
+		},
+		{
+			"banners without source",
+			Config{Banners: true},
+			ErrBannersSourceRequired,
+		},
+		{
+			"banners with source ip",
+			Config{Banners: true, SourceIP: "10.0.0.200"},
+			nil,
+		},
+		{
+			"banners with source port",
+			Config{Banners: true, SourcePort: "61000"},
+			nil,
+		},
+		{
+			"network options",
+			Config{AdapterIP: "10.0.0.200", AdapterMAC: "00-11-22-33-44-55", RouterMAC: "66:55:44:33:22:11", SourceIP: "10.0.0.200-10.0.0.203", SourcePort: "61000-61003", TTL: 64},
+			nil,
+		},
+		{
+			"invalid adapter ip",
+			Config{AdapterIP: "10.0.0"},
+			ErrInvalidOption,
+		},
+		{
+			"invalid router mac",
+			Config{RouterMAC: "66:55:44"},
+			ErrInvalidOption,
+		},
+		{
+			"invalid source ip",
+			Config{SourceIP: "10.0.0.203-10.0.0.200"},
+			ErrInvalidRange,
+		},
+		{
+			"invalid source port",
+			Config{SourcePort: "61003-61000"},
+			ErrInvalidPort,
+		},
+		{
+			"source port with protocol",
+			Config{SourcePort: "U:61000"},
+			ErrInvalidOption,
+		},
+		{
+			"source port zero",
+			Config{SourcePort: "0"},
+			ErrInvalidOption,
+		},
+		{
+			"invalid ttl",
+			Config{TTL: 256},
+			ErrInvalidOption,
+		},
+		{
+			"adapter with shard adapters",
+			Config{Adapter: "eth0", Shards: 2, ShardOptions: []ShardOptions{{MaxRate: 100}, {Adapter: "eth1"}}},
+			ErrInvalidOption,
+		},
+		{
+			"adapter with shard rates",
+			Config{Adapter: "eth0", Shards: 2, ShardOptions: []ShardOptions{{MaxRate: 100}, {MaxRate: 200}}},
+			nil,
+		},
+		{
+			"negative wait",
+			Config{Wait: ptr(-time.Second)},
+			ErrInvalidOption,
+		},
+		{
+			"config conflict",
+			Config{Adapter: "eth1", Config: DynamicValue[string]{Value: "# comment\nadapter = eth0\n"}},
+			ErrConfigConflict,
+		},
+		{
+			"config alias conflict",
+			Config{Retries: 3, Config: DynamicValue[string]{Value: "max-retries = 1\n"}},
+			ErrConfigConflict,
+		},
+		{
+			"config without conflict",
+			Config{Adapter: "eth1", Config: DynamicValue[string]{Value: "ports = 80\n"}},
+			nil,
+		},
+		{
+			"hostname ranges",
+			Config{Ranges: DynamicValue[[]string]{Value: []string{"10.0.0.0/24,scanme.example.com", "srv:_http._tcp.example.com"}}},
+			nil,
+		},
+		{
+			"invalid range with hostnames",
+			Config{Ranges: DynamicValue[[]string]{Value: []string{"scanme.example.com", "10.0.0.300"}}},
+			ErrInvalidRange,
+		},
+		{
+			"port groups",
+			Config{Ports: DynamicValue[[]string]{Value: []string{"@web,top:100", "@internal"}}, PortGroups: PortGroups{"internal": {"9090"}}},
+			nil,
+		},
+		{
+			"unknown port group",
+			Config{Ports: DynamicValue[[]string]{Value: []string{"@internal"}}},
+			ErrUnknownPortGroup,
+		},
+		{
+			"dns server",
+			Config{DNS: DNSConfig{Server: "[2001:db8::53]:5353", Network: "ip6"}},
+			nil,
+		},
+		{
+			"invalid dns server",
+			Config{DNS: DNSConfig{Server: "dns.example.com"}},
+			ErrInvalidOption,
+		},
+		{
+			"invalid dns network",
+			Config{DNS: DNSConfig{Network: "tcp"}},
+			ErrInvalidOption,
+		},
+		{
+			"config path conflict",
+			Config{SourceIP: "10.0.0.200", ConfigPath: testFileValue(t, "source-ip = 10.0.0.201\n")},
+			ErrConfigConflict,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := tc.config.Validate()
+
+			if tc.expectError != nil {
+				require.ErrorIs(t, err, tc.expectError, "unexpected error returned")
+
+				return
+			}
+
+			require.NoError(t, err, "no error expected")
+		})
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
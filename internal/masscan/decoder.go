@@ -0,0 +1,129 @@
+package masscan
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const decoderBufferSize = 64 * 1024
+
+var (
+	ErrUnexpectedCharacter = errors.New("unexpected character in results")
+	ErrUnexpectedEOF       = errors.New("unexpected end of results")
+)
+
+// resultDecoder incrementally decodes masscan json output one record at a time.
+//
+// masscan writes a json array with one object per line, however some versions
+// leave a trailing comma after the last record and the ndjson output format
+// has no surrounding array at all. Instead of relying on a strict document
+// structure, the decoder locates each top level object and decodes it on its own,
+// so only a single record is held in memory at any time.
+type resultDecoder struct {
+	r      *bufio.Reader
+	buf    []byte
+	offset int64
+	start  int64
+}
+
+func newResultDecoder(r io.Reader) *resultDecoder {
+	return &resultDecoder{
+		r: bufio.NewReaderSize(r, decoderBufferSize),
+	}
+}
+
+// Decode reads the next record into result.
+// io.EOF is returned once there are no more records.
+func (d *resultDecoder) Decode(result *RawResult) error {
+	if err := d.next(); err != nil {
+		return err
+	}
+
+	*result = RawResult{}
+
+	if err := json.Unmarshal(d.buf, result); err != nil {
+		return fmt.Errorf("failed to decode record at offset %d: %w", d.start, err)
+	}
+
+	return nil
+}
+
+// next skips any array delimiters and whitespace between records and
+// reads the following object into buf.
+func (d *resultDecoder) next() error {
+	for {
+		c, err := d.r.ReadByte()
+		if err != nil {
+			return err
+		}
+
+		d.offset++
+
+		switch c {
+		case ' ', '\t', '\r', '\n', '[', ']', ',':
+			continue
+		case '{':
+			return d.readObject()
+		default:
+			return fmt.Errorf("%w: %q at offset %d", ErrUnexpectedCharacter, c, d.offset-1)
+		}
+	}
+}
+
+// readObject reads until the closing brace of the object which has already had its
+// opening brace consumed. Braces within strings are ignored.
+func (d *resultDecoder) readObject() error {
+	d.start = d.offset - 1
+
+	d.buf = append(d.buf[:0], '{')
+
+	var (
+		depth    = 1
+		inString bool
+		escaped  bool
+	)
+
+	for depth > 0 {
+		// Read up to the next closing brace, which may or may not close the object.
+		chunk, err := d.r.ReadSlice('}')
+		if err != nil && !errors.Is(err, bufio.ErrBufferFull) {
+			if errors.Is(err, io.EOF) {
+				return fmt.Errorf("%w: record starting at offset %d is incomplete", ErrUnexpectedEOF, d.start)
+			}
+
+			return err
+		}
+
+		d.offset += int64(len(chunk))
+
+		d.buf = append(d.buf, chunk...)
+
+		for _, c := range chunk {
+			switch {
+			case escaped:
+				escaped = false
+			case inString:
+				switch c {
+				case '\\':
+					escaped = true
+				case '"':
+					inString = false
+				}
+			default:
+				switch c {
+				case '"':
+					inString = true
+				case '{':
+					depth++
+				case '}':
+					depth--
+				}
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,273 @@
+package masscan
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResultDecoder(t *testing.T) {
+	t.Parallel()
+
+	expectResults := []RawResult{
+		{
+			IP:        "10.0.0.1",
+			Timestamp: "1745695800",
+			Ports:     []RawPort{{Port: Port{Port: 80, Proto: "tcp", Status: "open", Reason: "syn-ack", TTL: 64}}},
+		},
+		{
+			IP:        "10.0.0.2",
+			Timestamp: "1745695801",
+			Ports:     []RawPort{{Port: Port{Port: 443, Proto: "tcp", Status: "open", Reason: "syn-ack", TTL: 63}}},
+		},
+	}
+
+	testCases := []struct {
+		name        string
+		data        string
+		expect      []RawResult
+		expectError string
+	}{
+		{
+			"empty",
+			``,
+			nil,
+			"",
+		},
+		{
+			"empty array",
+			"[\n]\n",
+			nil,
+			"",
+		},
+		{
+			"json array",
+			`[
+{   "ip": "10.0.0.1",   "timestamp": "1745695800", "ports": [ {"port": 80, "proto": "tcp", "status": "open", "reason": "syn-ack", "ttl": 64} ] }
+,
+{   "ip": "10.0.0.2",   "timestamp": "1745695801", "ports": [ {"port": 443, "proto": "tcp", "status": "open", "reason": "syn-ack", "ttl": 63} ] }
+]
+`,
+			expectResults,
+			"",
+		},
+		{
+			"json array with trailing comma",
+			`[
+{   "ip": "10.0.0.1",   "timestamp": "1745695800", "ports": [ {"port": 80, "proto": "tcp", "status": "open", "reason": "syn-ack", "ttl": 64} ] },
+{   "ip": "10.0.0.2",   "timestamp": "1745695801", "ports": [ {"port": 443, "proto": "tcp", "status": "open", "reason": "syn-ack", "ttl": 63} ] },
+]
+`,
+			expectResults,
+			"",
+		},
+		{
+			"ndjson",
+			`{"ip":"10.0.0.1","timestamp":"1745695800","ports":[{"port":80,"proto":"tcp","status":"open","reason":"syn-ack","ttl":64}]}
+{"ip":"10.0.0.2","timestamp":"1745695801","ports":[{"port":443,"proto":"tcp","status":"open","reason":"syn-ack","ttl":63}]}
+`,
+			expectResults,
+			"",
+		},
+		{
+			"braces in strings",
+			`[{"ip": "10.0.0.1", "timestamp": "}{\"", "ports": []}]`,
+			[]RawResult{{IP: "10.0.0.1", Timestamp: `}{"`, Ports: []RawPort{}}},
+			"",
+		},
+		{
+			"truncated record",
+			`[{"ip": "10.0.0.1", "ports": [`,
+			nil,
+			ErrUnexpectedEOF.Error(),
+		},
+		{
+			"unexpected character",
+			`[{"ip": "10.0.0.1"}, oops]`,
+			nil,
+			ErrUnexpectedCharacter.Error(),
+		},
+		{
+			"invalid record",
+			`[{"ip": 1}]`,
+			nil,
+			"failed to decode record at offset 1",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			decoder := newResultDecoder(strings.NewReader(tc.data))
+
+			var (
+				results []RawResult
+				err     error
+			)
+
+			for {
+				var result RawResult
+
+				if err = decoder.Decode(&result); err != nil {
+					break
+				}
+
+				results = append(results, result)
+			}
+
+			if tc.expectError != "" {
+				require.ErrorContains(t, err, tc.expectError, "unexpected error returned")
+
+				return
+			}
+
+			require.ErrorIs(t, err, io.EOF, "expected decoder to end with EOF")
+
+			assert.Equal(t, tc.expect, results, "unexpected results decoded")
+		})
+	}
+}
+
+func TestMasscan_generateReport(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "results.json")
+
+	err := os.WriteFile(path, []byte(`[
+{"ip": "10.0.0.1", "timestamp": "1745695800", "ports": [ {"port": 80, "proto": "tcp", "status": "open", "reason": "syn-ack", "ttl": 64} ] },
+{"ip": "10.0.0.2", "timestamp": "1745695800", "ports": [ {"port": 80, "proto": "tcp", "status": "open", "reason": "syn-ack", "ttl": 64} ] },
+{"ip": "10.0.0.1", "timestamp": "1745695801", "ports": [ {"port": 443, "proto": "tcp", "status": "open", "reason": "syn-ack", "ttl": 64} ] },
+{"ip": "10.0.0.2", "timestamp": "1745695802", "ports": [ {"port": 80, "proto": "tcp", "service": {"name": "http", "banner": "HTTP/1.0 200 OK\r\nServer: nginx"} } ] },
+{"ip": "10.0.0.2", "timestamp": "1745695802", "ports": [ {"port": 80, "proto": "tcp", "service": {"name": "title", "banner": "Welcome"} } ] },
+]`), 0644)
+	require.NoError(t, err, "no error expected writing results")
+
+	var m Masscan
+
+	report, err := m.generateReport(t.Context(), path, Report{Partial: true})
+	require.NoError(t, err, "no error expected generating report")
+
+	assert.False(t, report.Partial, "expected report to be complete")
+	assert.Equal(t, map[string]Results{
+		"10.0.0.1": {
+			IP: "10.0.0.1",
+			Ports: Ports{
+				{Port: 80, Proto: "tcp", Status: "open", Reason: "syn-ack", TTL: 64},
+				{Port: 443, Proto: "tcp", Status: "open", Reason: "syn-ack", TTL: 64},
+			},
+		},
+		"10.0.0.2": {
+			IP: "10.0.0.2",
+			Ports: Ports{
+				{
+					Port: 80, Proto: "tcp", Status: "open", Reason: "syn-ack", TTL: 64,
+					Services: []Service{
+						{Name: "http", Banner: "HTTP/1.0 200 OK\r\nServer: nginx"},
+						{Name: "title", Banner: "Welcome"},
+					},
+				},
+			},
+		},
+	}, report.Results, "unexpected report results")
+}
+
+// writeBenchmarkResults writes a masscan json output file with the provided number of records.
+func writeBenchmarkResults(b *testing.B, records int) string {
+	b.Helper()
+
+	path := filepath.Join(b.TempDir(), "results.json")
+
+	f, err := os.Create(path)
+	require.NoError(b, err, "no error expected creating results file")
+
+	w := bufio.NewWriter(f)
+
+	w.WriteString("[\n")
+
+	for i := range records {
+		fmt.Fprintf(w, `{   "ip": "10.%d.%d.%d",   "timestamp": "1745695800", "ports": [ {"port": %d, "proto": "tcp", "status": "open", "reason": "syn-ack", "ttl": 64} ] }`,
+			(i>>16)&0xff, (i>>8)&0xff, i&0xff, 80+i%4,
+		)
+
+		w.WriteString(",\n")
+	}
+
+	w.WriteString("]\n")
+
+	require.NoError(b, errors.Join(w.Flush(), f.Close()), "no error expected writing results file")
+
+	return path
+}
+
+func BenchmarkMasscan_generateReport(b *testing.B) {
+	const records = 1_000_000
+
+	path := writeBenchmarkResults(b, records)
+
+	ctx := zerolog.Nop().WithContext(b.Context())
+
+	var m Masscan
+
+	b.ReportAllocs()
+
+	for b.Loop() {
+		report, err := m.generateReport(ctx, path, Report{})
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		if len(report.Results) != records {
+			b.Fatalf("expected %d results, got %d", records, len(report.Results))
+		}
+	}
+}
+
+func BenchmarkResultDecoder(b *testing.B) {
+	const records = 1_000_000
+
+	path := writeBenchmarkResults(b, records)
+
+	b.ReportAllocs()
+
+	for b.Loop() {
+		f, err := os.Open(path)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		decoder := newResultDecoder(f)
+
+		var (
+			result RawResult
+			count  int
+		)
+
+		for {
+			if err := decoder.Decode(&result); err != nil {
+				if errors.Is(err, io.EOF) {
+					break
+				}
+
+				b.Fatal(err)
+			}
+
+			count++
+		}
+
+		f.Close()
+
+		if count != records {
+			b.Fatalf("expected %d records, got %d", records, count)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package masscan
+
+import (
+	"cmp"
+	"net/netip"
+	"slices"
+)
+
+// Changes reported by DiffReports.
+const (
+	ChangeOpened = "opened"
+	ChangeClosed = "closed"
+)
+
+// PortChange is a port whose state changed between two reports.
+type PortChange struct {
+	IP     string `json:"ip"`
+	Port   int    `json:"port"`
+	Proto  string `json:"proto"`
+	Change string `json:"change"`
+}
+
+// DiffReports returns the ports which were opened or closed between the previous and current reports.
+//
+// Ports which are no longer within the current report's targets are not reported as closed,
+// so changing the configured ranges or ports does not report every removed port as closed.
+func DiffReports(previous, current Report) []PortChange {
+	var changes []PortChange
+
+	for ip, results := range current.Results {
+		for _, port := range results.Ports {
+			if port.Status == "open" && !previous.isOpen(ip, port) {
+				changes = append(changes, PortChange{IP: ip, Port: port.Port, Proto: port.Proto, Change: ChangeOpened})
+			}
+		}
+	}
+
+	addresses := current.Targets.Addresses()
+
+	for ip, results := range previous.Results {
+		for _, port := range results.Ports {
+			if port.Status == "open" && !current.isOpen(ip, port) && current.Targets.covers(addresses, ip, port) {
+				changes = append(changes, PortChange{IP: ip, Port: port.Port, Proto: port.Proto, Change: ChangeClosed})
+			}
+		}
+	}
+
+	slices.SortFunc(changes, func(a, b PortChange) int {
+		return cmp.Or(cmp.Compare(a.IP, b.IP), cmp.Compare(a.Proto, b.Proto), cmp.Compare(a.Port, b.Port))
+	})
+
+	return changes
+}
+
+// isOpen reports if the report has the port open for the ip.
+func (r Report) isOpen(ip string, port Port) bool {
+	for _, existing := range r.Results[ip].Ports {
+		if existing.Port == port.Port && existing.Proto == port.Proto {
+			return existing.Status == "open"
+		}
+	}
+
+	return false
+}
+
+// covers reports if the port on the ip is within the targets, addresses must be the result of t.Addresses.
+// Ranges or ports which are not known, such as those set in a masscan config, are assumed to cover everything.
+func (t Targets) covers(addresses []AddrRange, ip string, port Port) bool {
+	if len(t.Ranges) != 0 {
+		addr, err := netip.ParseAddr(ip)
+		if err != nil {
+			return false
+		}
+
+		addr = addr.Unmap()
+
+		if !slices.ContainsFunc(addresses, func(r AddrRange) bool { return r.Contains(addr) }) {
+			return false
+		}
+	}
+
+	if len(t.Ports) != 0 {
+		return slices.ContainsFunc(t.Ports, func(r PortRange) bool {
+			return r.Proto == port.Proto && r.From <= port.Port && port.Port <= r.To
+		})
+	}
+
+	return true
+}
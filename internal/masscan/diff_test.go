@@ -0,0 +1,81 @@
+package masscan
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testDiffReport(t *testing.T, ranges, ports []string, open map[string][]int) Report {
+	t.Helper()
+
+	targets, err := ParseTargets(ranges, nil, ports)
+	require.NoError(t, err, "no error expected parsing targets")
+
+	report := Report{
+		Targets: targets,
+		Results: make(map[string]Results),
+	}
+
+	for ip, openPorts := range open {
+		for _, port := range openPorts {
+			report.addResult(RawResult{
+				IP:    ip,
+				Ports: []RawPort{{Port: Port{Port: port, Proto: ProtoTCP, Status: "open", Reason: "syn-ack"}}},
+			})
+		}
+	}
+
+	return report
+}
+
+func TestDiffReports(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name     string
+		previous Report
+		current  Report
+		expect   []PortChange
+	}{
+		{
+			"no changes",
+			testDiffReport(t, []string{"10.0.0.0/24"}, []string{"22,80"}, map[string][]int{"10.0.0.1": {22, 80}}),
+			testDiffReport(t, []string{"10.0.0.0/24"}, []string{"22,80"}, map[string][]int{"10.0.0.1": {80, 22}}),
+			nil,
+		},
+		{
+			"opened and closed",
+			testDiffReport(t, []string{"10.0.0.0/24"}, []string{"22,80"}, map[string][]int{"10.0.0.1": {22}, "10.0.0.2": {80}}),
+			testDiffReport(t, []string{"10.0.0.0/24"}, []string{"22,80"}, map[string][]int{"10.0.0.1": {22, 80}, "10.0.0.3": {22}}),
+			[]PortChange{
+				{IP: "10.0.0.1", Port: 80, Proto: ProtoTCP, Change: ChangeOpened},
+				{IP: "10.0.0.2", Port: 80, Proto: ProtoTCP, Change: ChangeClosed},
+				{IP: "10.0.0.3", Port: 22, Proto: ProtoTCP, Change: ChangeOpened},
+			},
+		},
+		{
+			"targets removed are not closed",
+			testDiffReport(t, []string{"10.0.0.0/24", "10.0.1.0/24"}, []string{"22,80"}, map[string][]int{"10.0.0.1": {22, 80}, "10.0.1.1": {22}}),
+			testDiffReport(t, []string{"10.0.0.0/24"}, []string{"22"}, map[string][]int{"10.0.0.1": {22}}),
+			nil,
+		},
+		{
+			"unknown targets",
+			testDiffReport(t, nil, nil, map[string][]int{"10.0.0.1": {22}}),
+			testDiffReport(t, nil, nil, nil),
+			[]PortChange{
+				{IP: "10.0.0.1", Port: 22, Proto: ProtoTCP, Change: ChangeClosed},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			assert.Equal(t, tc.expect, DiffReports(tc.previous, tc.current), "unexpected changes")
+		})
+	}
+}
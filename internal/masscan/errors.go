@@ -0,0 +1,170 @@
+package masscan
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os/exec"
+	"slices"
+	"strings"
+)
+
+// Errors returned by Run which classify the cause of a failed scan.
+var (
+	ErrBinaryNotFound   = errors.New("masscan binary not found")
+	ErrPermissionDenied = errors.New("permission denied")
+	ErrLoadValue        = errors.New("failed to load value")
+	ErrTimeout          = errors.New("scan timed out")
+	ErrCanceled         = errors.New("scan canceled")
+	ErrExit             = errors.New("masscan exited with an error")
+	ErrKilled           = errors.New("masscan was killed by a signal")
+	ErrParseReport      = errors.New("failed to parse report")
+	ErrScanRefused      = errors.New("scan refused")
+)
+
+// Reasons returned by ErrorReason.
+const (
+	ReasonBinaryNotFound   = "binary_not_found"
+	ReasonPermissionDenied = "permission_denied"
+	ReasonLoadValue        = "load_value"
+	ReasonResolve          = "resolve"
+	ReasonInvalidConfig    = "invalid_config"
+	ReasonInvalidTarget    = "invalid_target"
+	ReasonTimeout          = "timeout"
+	ReasonCanceled         = "canceled"
+	ReasonExit             = "exit"
+	ReasonKilled           = "killed"
+	ReasonParseReport      = "parse_report"
+	ReasonRefused          = "refused"
+	ReasonUnknown          = "unknown"
+)
+
+var errorReasons = []struct {
+	err    error
+	reason string
+}{
+	{ErrBinaryNotFound, ReasonBinaryNotFound},
+	{ErrPermissionDenied, ReasonPermissionDenied},
+	{ErrLoadValue, ReasonLoadValue},
+	{ErrResolve, ReasonResolve},
+	{ErrInvalidOption, ReasonInvalidConfig},
+	{ErrConfigConflict, ReasonInvalidConfig},
+	{ErrHelperRejected, ReasonInvalidConfig},
+	{ErrInvalidPortGroups, ReasonInvalidConfig},
+	{ErrPortGroupCycle, ReasonInvalidConfig},
+	{ErrInvalidRange, ReasonInvalidTarget},
+	{ErrInvalidPort, ReasonInvalidTarget},
+	{ErrUnknownPortGroup, ReasonInvalidTarget},
+	{ErrTimeout, ReasonTimeout},
+	{ErrCanceled, ReasonCanceled},
+	{ErrExit, ReasonExit},
+	{ErrKilled, ReasonKilled},
+	{ErrParseReport, ReasonParseReport},
+	{ErrScanRefused, ReasonRefused},
+}
+
+// Exit codes with a meaning beyond masscan failing.
+const (
+	// exitCodeSignaled is reported when the process was terminated by a signal, such as by the OOM killer.
+	exitCodeSignaled = -1
+
+	// exitCodeNotExecutable and exitCodeNotFound are returned by shells and launchers, such as env and sudo,
+	// when the command they were asked to run cannot be executed or does not exist.
+	exitCodeNotExecutable = 126
+	exitCodeNotFound      = 127
+)
+
+// errFatalOutput is returned when masscan exits successfully but reports a fatal error without completing the scan.
+var errFatalOutput = errors.New("masscan reported a fatal error")
+
+// permissionMessages are found in masscan's output when it is unable to open a raw socket.
+var permissionMessages = []string{
+	"permission denied",
+	"operation not permitted",
+	"need to sudo",
+}
+
+// ErrorReason returns a short label describing the cause of an error returned by Run.
+// Unclassified errors return ReasonUnknown.
+func ErrorReason(err error) string {
+	for _, r := range errorReasons {
+		if errors.Is(err, r.err) {
+			return r.reason
+		}
+	}
+
+	return ReasonUnknown
+}
+
+// ReasonError returns the error classified by the reason, so errors may be reconstructed from a reason
+// reported elsewhere. Unknown reasons return nil.
+func ReasonError(reason string) error {
+	for _, r := range errorReasons {
+		if r.reason == reason {
+			return r.err
+		}
+	}
+
+	return nil
+}
+
+// ErrorReasons returns all reasons which may be returned by ErrorReason.
+func ErrorReasons() []string {
+	reasons := make([]string, 0, len(errorReasons)+1)
+
+	for _, r := range errorReasons {
+		if !slices.Contains(reasons, r.reason) {
+			reasons = append(reasons, r.reason)
+		}
+	}
+
+	return append(reasons, ReasonUnknown)
+}
+
+// ContextError classifies an error caused by the context ending.
+// Errors unrelated to the context are returned unchanged.
+func ContextError(ctx context.Context, err error) error {
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		return fmt.Errorf("%w: %w", ErrTimeout, err)
+	case ctx.Err() != nil:
+		return fmt.Errorf("%w: %w", ErrCanceled, err)
+	}
+
+	return err
+}
+
+// classifyRunError wraps an error from running masscan with the error describing its cause.
+func classifyRunError(ctx context.Context, err error, output string) error {
+	if ctx.Err() != nil {
+		return ContextError(ctx, err)
+	}
+
+	code, exited := exitCode(err)
+
+	switch {
+	case errors.Is(err, exec.ErrNotFound), errors.Is(err, fs.ErrNotExist), exited && code == exitCodeNotFound:
+		return fmt.Errorf("%w: %w", ErrBinaryNotFound, err)
+	case errors.Is(err, fs.ErrPermission), permissionDenied(output), exited && code == exitCodeNotExecutable:
+		return fmt.Errorf("%w: %w", ErrPermissionDenied, err)
+	case exited && code == exitCodeSignaled:
+		return fmt.Errorf("%w: %w", ErrKilled, err)
+	case exited, errors.Is(err, errFatalOutput):
+		return fmt.Errorf("%w: %w", ErrExit, err)
+	}
+
+	return err
+}
+
+func permissionDenied(output string) bool {
+	output = strings.ToLower(output)
+
+	for _, msg := range permissionMessages {
+		if strings.Contains(output, msg) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,91 @@
+package masscan
+
+import (
+	"math"
+	"math/bits"
+	"time"
+)
+
+// masscanDefaultWait is the time masscan waits for responses when wait is not set.
+const masscanDefaultWait = 10 * time.Second
+
+// Estimate is the expected size and duration of a scan, calculated before the scan starts.
+type Estimate struct {
+	// Addresses is the number of addresses to scan, after excludes are removed.
+	Addresses uint64 `json:"addresses"`
+	// Ports is the number of ports scanned on each address.
+	Ports int `json:"ports"`
+	// Packets is the number of probes which will be sent, including retries.
+	Packets uint64 `json:"packets"`
+	// Rate is the combined transmit rate in packets per second.
+	Rate int `json:"rate"`
+	// Duration is the expected time to transmit all packets and wait for responses.
+	Duration time.Duration `json:"duration"`
+}
+
+// EstimateFunc is called with the estimate of a scan before it starts.
+// Returning an error stops the scan from starting, the error is returned by Run.
+// It is not called if the targets are not known, such as when they are only set in a masscan config.
+type EstimateFunc func(Estimate) error
+
+// NewEstimate estimates a scan of ports on each address, sending each probe retries additional times
+// at rate packets per second, then waiting for responses. Sizes too large to count are capped.
+func NewEstimate(addresses uint64, ports, retries, rate int, wait time.Duration) Estimate {
+	estimate := Estimate{
+		Addresses: addresses,
+		Ports:     ports,
+		Rate:      max(rate, 1),
+	}
+
+	estimate.Packets = saturatingMul(addresses, uint64(max(ports, 0)))
+	estimate.Packets = saturatingMul(estimate.Packets, uint64(max(retries, 0)+1))
+
+	seconds := float64(estimate.Packets)/float64(estimate.Rate) + max(wait, 0).Seconds()
+
+	if seconds >= float64(math.MaxInt64)/float64(time.Second) {
+		estimate.Duration = math.MaxInt64
+	} else {
+		estimate.Duration = time.Duration(seconds * float64(time.Second))
+	}
+
+	return estimate
+}
+
+// estimate returns the estimate of the prepared report's targets.
+func (m *Masscan) estimate(report Report) Estimate {
+	rate := m.cfg.MaxRate
+
+	if m.cfg.Shards > 1 {
+		rate = 0
+
+		for i := range m.cfg.Shards {
+			shardRate, _ := m.shardOptions(i)
+			if shardRate <= 0 {
+				shardRate = DefaultMaxRate
+			}
+
+			rate += shardRate
+		}
+	}
+
+	if rate <= 0 {
+		rate = DefaultMaxRate
+	}
+
+	wait := masscanDefaultWait
+
+	if m.cfg.Wait != nil {
+		wait = *m.cfg.Wait
+	}
+
+	return NewEstimate(report.AddressCount, report.Targets.PortCount(), m.cfg.Retries, rate, wait)
+}
+
+func saturatingMul(a, b uint64) uint64 {
+	hi, lo := bits.Mul64(a, b)
+	if hi != 0 {
+		return math.MaxUint64
+	}
+
+	return lo
+}
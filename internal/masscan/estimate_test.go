@@ -0,0 +1,54 @@
+package masscan
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewEstimate(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name      string
+		addresses uint64
+		ports     int
+		retries   int
+		rate      int
+		wait      time.Duration
+		expect    Estimate
+	}{
+		{
+			"single pass",
+			256, 2, 0, 100, 10 * time.Second,
+			Estimate{Addresses: 256, Ports: 2, Packets: 512, Rate: 100, Duration: 15120 * time.Millisecond},
+		},
+		{
+			"retries",
+			256, 2, 2, 1000, 0,
+			Estimate{Addresses: 256, Ports: 2, Packets: 1536, Rate: 1000, Duration: 1536 * time.Millisecond},
+		},
+		{
+			"rate not set",
+			10, 1, 0, 0, 0,
+			Estimate{Addresses: 10, Ports: 1, Packets: 10, Rate: 1, Duration: 10 * time.Second},
+		},
+		{
+			"capped",
+			math.MaxUint64, 65536, 0, 1, 0,
+			Estimate{Addresses: math.MaxUint64, Ports: 65536, Packets: math.MaxUint64, Rate: 1, Duration: math.MaxInt64},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			estimate := NewEstimate(tc.addresses, tc.ports, tc.retries, tc.rate, tc.wait)
+
+			assert.Equal(t, tc.expect, estimate, "unexpected estimate")
+		})
+	}
+}
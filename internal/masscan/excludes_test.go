@@ -0,0 +1,59 @@
+package masscan
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMasscan_Run_Excludes(t *testing.T) {
+	// Not parallel, so no other test forks while the fake masscan is open for writing, which fails its exec with ETXTBSY.
+	dir := t.TempDir()
+
+	// The fake masscan records its args and a copy of the excludefile, which is removed once the run completes.
+	script := "#!/bin/sh\n" +
+		"printf '%s\\n' \"$@\" > " + filepath.Join(dir, "args") + "\n" +
+		"while [ $# -gt 0 ]; do\n" +
+		"\tif [ \"$1\" = --excludefile ]; then cp \"$2\" " + filepath.Join(dir, "excludes") + "; fi\n" +
+		"\tshift\n" +
+		"done\n" +
+		"echo 'rate:  0.00-kpps, 100.00% done, found=0' >&2\n"
+
+	binPath := filepath.Join(dir, "masscan")
+
+	require.NoError(t, os.WriteFile(binPath, []byte(script), 0755), "no error expected writing fake masscan")
+
+	m, err := New(t.Context(), WithConfig(Config{
+		BinPath:  binPath,
+		TempDir:  filepath.Join(dir, "tmp"),
+		Ranges:   DynamicValue[[]string]{Value: []string{"10.0.0.0/24"}},
+		Ports:    DynamicValue[[]string]{Value: []string{"80"}},
+		Excludes: DynamicValue[[]string]{Value: []string{"10.0.0.5", "10.0.0.9"}},
+	}))
+	require.NoError(t, err, "no error expected creating masscan")
+
+	report, err := m.Run(t.Context())
+	require.NoError(t, err, "no error expected running masscan")
+
+	assert.Equal(t, []string{"10.0.0.5", "10.0.0.9"}, report.Excludes, "unexpected report excludes")
+
+	data, err := os.ReadFile(filepath.Join(dir, "args"))
+	require.NoError(t, err, "no error expected reading args")
+
+	args := strings.Split(strings.TrimSpace(string(data)), "\n")
+
+	i := slices.Index(args, "--excludefile")
+	require.NotEqual(t, -1, i, "expected --excludefile arg")
+	require.Less(t, i+1, len(args), "expected --excludefile to have a value")
+
+	excludes, err := os.ReadFile(filepath.Join(dir, "excludes"))
+	require.NoError(t, err, "no error expected reading excludefile")
+
+	assert.Equal(t, "10.0.0.5\n10.0.0.9\n", string(excludes), "unexpected excludefile contents")
+	assert.NoFileExists(t, args[i+1], "expected excludefile to be removed after the run")
+}
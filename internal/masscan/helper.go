@@ -0,0 +1,391 @@
+package masscan
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrHelperUnavailable = errors.New("masscan helper unavailable")
+	ErrHelperRejected    = errors.New("request rejected by masscan helper")
+)
+
+// HelperRequest asks the privileged helper to run masscan with Args.
+//
+// The helper never passes the exporter's paths to masscan. Files masscan reads are copied into a directory
+// owned by the helper, where masscan also writes its results and paused.conf, which are sent back once it exits.
+type HelperRequest struct {
+	Args []string `json:"args"`
+}
+
+// HelperMessage is streamed by the helper in response to a HelperRequest.
+// Output is sent as masscan writes it. Once masscan exits, the results it wrote are sent in chunks,
+// followed by paused.conf if it was written, then a single message which sets Done, Rejected or Error.
+//
+// Closing the write side of the connection interrupts masscan, which is killed if it has not exited after
+// the helper's wait delay. Closing the connection entirely also kills masscan.
+type HelperMessage struct {
+	Output []byte `json:"output,omitempty"`
+
+	// Results is a chunk of the file masscan wrote its results to.
+	Results []byte `json:"results,omitempty"`
+	// Paused is the paused.conf masscan wrote when it was interrupted.
+	Paused []byte `json:"paused,omitempty"`
+
+	// Done is set once masscan has exited with ExitCode.
+	Done     bool `json:"done,omitempty"`
+	ExitCode int  `json:"exit_code,omitempty"`
+
+	// Rejected is why the request failed validation, masscan was not started.
+	Rejected string `json:"rejected,omitempty"`
+	// Error is why masscan could not be run.
+	Error string `json:"error,omitempty"`
+}
+
+// HelperExitError is returned when masscan run by the helper exits with a non-zero exit code.
+type HelperExitError struct {
+	Code int
+}
+
+func (e *HelperExitError) Error() string {
+	return "exit status " + strconv.Itoa(e.Code)
+}
+
+// runHelper runs masscan through the helper listening on socket, writing its output to w.
+// The results are written to the file named by the request's --output-filename, and paused.conf to dir.
+func runHelper(ctx context.Context, socket string, waitDelay time.Duration, dir string, req HelperRequest, w io.Writer) error {
+	var results io.Writer = io.Discard
+
+	if path := argValue(req.Args, "--output-filename"); path != "" {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_TRUNC, 0)
+		if err != nil {
+			return fmt.Errorf("failed to open results file: %w", err)
+		}
+
+		defer f.Close()
+
+		results = f
+	}
+
+	var dialer net.Dialer
+
+	conn, err := dialer.DialContext(ctx, "unix", socket)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrHelperUnavailable, err)
+	}
+
+	defer conn.Close()
+
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return fmt.Errorf("%w: sending request: %w", ErrHelperUnavailable, err)
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
+			return
+		}
+
+		// Closing the write side asks the helper to interrupt masscan so it may stop gracefully.
+		conn.(*net.UnixConn).CloseWrite()
+
+		select {
+		case <-time.After(waitDelay):
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	decoder := json.NewDecoder(conn)
+
+	for {
+		var msg HelperMessage
+
+		if err := decoder.Decode(&msg); err != nil {
+			return fmt.Errorf("%w: reading response: %w", ErrHelperUnavailable, err)
+		}
+
+		if len(msg.Output) != 0 {
+			w.Write(msg.Output)
+		}
+
+		if len(msg.Results) != 0 {
+			if _, err := results.Write(msg.Results); err != nil {
+				return fmt.Errorf("failed to write results: %w", err)
+			}
+		}
+
+		if len(msg.Paused) != 0 && dir != "" {
+			if err := os.WriteFile(filepath.Join(dir, pausedConfFile), msg.Paused, 0600); err != nil {
+				return fmt.Errorf("failed to write %s: %w", pausedConfFile, err)
+			}
+		}
+
+		switch {
+		case msg.Rejected != "":
+			return fmt.Errorf("%w: %s", ErrHelperRejected, msg.Rejected)
+		case msg.Error != "":
+			return fmt.Errorf("masscan helper failed to run masscan: %s", msg.Error)
+		case msg.Done && msg.ExitCode != 0:
+			return &HelperExitError{Code: msg.ExitCode}
+		case msg.Done:
+			// Like exec.Cmd, a run which was interrupted reports the context's error even if masscan exited successfully.
+			return ctx.Err()
+		}
+	}
+}
+
+// HelperPolicy limits the requests the privileged helper accepts.
+type HelperPolicy struct {
+	// Dirs are the directories the files masscan reads must be within.
+	Dirs []string
+	// MaxRate limits the rate of each masscan process when set.
+	MaxRate int
+}
+
+// HelperFile is a file named by the args of a HelperRequest.
+type HelperFile struct {
+	// Arg is the index of the file's path within the args.
+	Arg int
+	// Config is set for masscan configs, which must be checked with CheckConfig before they are used.
+	Config bool
+	// Output is set for the file masscan writes its results to, all other files are read by masscan.
+	Output bool
+}
+
+// helperArg validates an argument accepted by the helper.
+type helperArg struct {
+	// value reports if the argument is followed by a value.
+	value bool
+
+	validate func(p HelperPolicy, value string) error
+
+	// file is set if the value is the path of a file.
+	file *HelperFile
+}
+
+var helperArgs = map[string]helperArg{
+	"--banners":         {},
+	"--randomize-hosts": {},
+	"--packet-trace":    {},
+	"--adapter":         {value: true},
+	"--adapter-ip":      {value: true},
+	"--adapter-mac":     {value: true},
+	"--router-mac":      {value: true},
+	"--source-ip":       {value: true},
+	"--source-port":     {value: true},
+	"--retries":         {value: true},
+	"--wait":            {value: true},
+	"--ttl":             {value: true},
+	"--seed":            {value: true},
+	"--max-rate":        {value: true, validate: HelperPolicy.checkRate},
+	"--shard":           {value: true, validate: HelperPolicy.checkShard},
+	"--output-format":   {value: true, validate: HelperPolicy.checkOutputFormat},
+	"--output-filename": {value: true, file: &HelperFile{Output: true}},
+	"--excludefile":     {value: true, validate: HelperPolicy.checkPath, file: &HelperFile{}},
+	"-c":                {value: true, validate: HelperPolicy.checkPath, file: &HelperFile{Config: true}},
+	"--resume":          {value: true, validate: HelperPolicy.checkPath, file: &HelperFile{Config: true}},
+}
+
+// helperConfigKeys are the masscan config keys accepted in configs run by the helper, including those masscan
+// writes to paused.conf. None of them name files other than the output, which the helper replaces with its own.
+var helperConfigKeys = []string{
+	"adapter", "adapter-ip", "adapter-mac", "adapter-port", "adapter-vlan", "arp", "banners", "capture", "exclude",
+	"max-rate", "max-retries", "min-packet", "nocapture", "noshow", "output-filename", "output-format", "ping",
+	"ports", "range", "rate", "randomize-hosts", "resume-count", "resume-index", "retries", "rotate",
+	"rotate-filesize", "rotate-offset", "router-ip", "router-mac", "seed", "shard", "show", "source-ip",
+	"source-port", "ttl", "wait",
+}
+
+// Validate returns ErrHelperRejected if the request runs masscan with arguments or files outside of the policy,
+// otherwise the files named by the arguments are returned.
+// Only the arguments built by Run are accepted, and the files masscan reads must be within Dirs and must not be symlinks.
+//
+// The files are only checked by name, so the helper must verify them again once opened.
+func (p HelperPolicy) Validate(req HelperRequest) ([]HelperFile, error) {
+	var files []HelperFile
+
+	for i := 0; i < len(req.Args); i++ {
+		arg := req.Args[i]
+
+		if opt, ok := helperArgs[arg]; ok {
+			if !opt.value {
+				continue
+			}
+
+			i++
+
+			if i == len(req.Args) {
+				return nil, fmt.Errorf("%w: %s requires a value", ErrHelperRejected, arg)
+			}
+
+			if opt.validate != nil {
+				if err := opt.validate(p, req.Args[i]); err != nil {
+					return nil, fmt.Errorf("%w: %s: %w", ErrHelperRejected, arg, err)
+				}
+			}
+
+			if opt.file != nil {
+				file := *opt.file
+				file.Arg = i
+
+				files = append(files, file)
+			}
+
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(arg, "-p"):
+			if _, err := ParsePorts([]string{strings.TrimPrefix(arg, "-p")}); err != nil {
+				return nil, fmt.Errorf("%w: %w", ErrHelperRejected, err)
+			}
+		case strings.HasPrefix(arg, "-"):
+			return nil, fmt.Errorf("%w: unsupported argument '%s'", ErrHelperRejected, arg)
+		default:
+			if _, err := ParseRanges([]string{arg}); err != nil {
+				return nil, fmt.Errorf("%w: %w", ErrHelperRejected, err)
+			}
+		}
+	}
+
+	return files, nil
+}
+
+// CheckConfig returns ErrHelperRejected if the masscan config sets keys which are not accepted by the helper,
+// or sets a rate exceeding MaxRate. Keys with empty values are ignored by masscan, so they are accepted.
+func (p HelperPolicy) CheckConfig(config string) error {
+	for key, value := range configValues(config) {
+		switch {
+		case value == "":
+		case key == "rate", key == "max-rate":
+			if err := p.checkConfigRate(value); err != nil {
+				return fmt.Errorf("%w: config key '%s': %w", ErrHelperRejected, key, err)
+			}
+		case slices.Contains(helperConfigKeys, key):
+		case key == "rotate-dir" && value == ".":
+			// masscan writes its default, the working directory, to paused.conf.
+		default:
+			return fmt.Errorf("%w: config key '%s' is not supported", ErrHelperRejected, key)
+		}
+	}
+
+	return nil
+}
+
+func (p HelperPolicy) checkRate(value string) error {
+	rate, err := strconv.Atoi(value)
+	if err != nil || rate < 1 {
+		return errors.New("must be a positive number")
+	}
+
+	if p.MaxRate > 0 && rate > p.MaxRate {
+		return fmt.Errorf("%d exceeds the helper max rate %d", rate, p.MaxRate)
+	}
+
+	return nil
+}
+
+// checkConfigRate is checkRate for rates set in configs, which masscan writes to paused.conf with decimals.
+func (p HelperPolicy) checkConfigRate(value string) error {
+	rate, err := strconv.ParseFloat(value, 64)
+	if err != nil || rate <= 0 {
+		return errors.New("must be a positive number")
+	}
+
+	if p.MaxRate > 0 && rate > float64(p.MaxRate) {
+		return fmt.Errorf("%s exceeds the helper max rate %d", value, p.MaxRate)
+	}
+
+	return nil
+}
+
+func (HelperPolicy) checkShard(value string) error {
+	shard, total, ok := strings.Cut(value, "/")
+
+	n, err := strconv.Atoi(shard)
+	if err != nil || !ok {
+		return errors.New("must be formatted as shard/total")
+	}
+
+	m, err := strconv.Atoi(total)
+	if err != nil || n < 1 || n > m {
+		return errors.New("shard must be between 1 and total")
+	}
+
+	return nil
+}
+
+func (HelperPolicy) checkOutputFormat(value string) error {
+	if value != "json" {
+		return errors.New("only json is supported")
+	}
+
+	return nil
+}
+
+// checkPath returns an error if path is not absolute, is outside of the policy's dirs or is a symlink.
+func (p HelperPolicy) checkPath(path string) error {
+	if !filepath.IsAbs(path) {
+		return fmt.Errorf("'%s' must be absolute", path)
+	}
+
+	parent, err := filepath.EvalSymlinks(filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+
+	resolved := filepath.Join(parent, filepath.Base(path))
+
+	if !p.allowed(resolved) {
+		return fmt.Errorf("'%s' is not within an allowed dir", path)
+	}
+
+	if info, err := os.Lstat(resolved); err == nil && info.Mode()&os.ModeSymlink != 0 {
+		return fmt.Errorf("'%s' must not be a symlink", path)
+	}
+
+	return nil
+}
+
+func (p HelperPolicy) allowed(path string) bool {
+	for _, dir := range p.Dirs {
+		if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+			dir = resolved
+		}
+
+		rel, err := filepath.Rel(filepath.Clean(dir), path)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// argValue returns the value following the last occurrence of flag in args.
+func argValue(args []string, flag string) string {
+	var value string
+
+	for i := 0; i < len(args)-1; i++ {
+		if args[i] == flag {
+			value = args[i+1]
+		}
+	}
+
+	return value
+}
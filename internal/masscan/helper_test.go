@@ -0,0 +1,198 @@
+package masscan_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mikemrm/masscan-exporter/internal/masscan"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHelperPolicy_Validate(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	outside := t.TempDir()
+
+	writeFile := func(name, contents string) string {
+		path := filepath.Join(dir, name)
+
+		require.NoError(t, os.WriteFile(path, []byte(contents), 0600), "no error expected writing file")
+
+		return path
+	}
+
+	conf := writeFile("masscan.conf", "rate = 100\nbanners = true\n")
+	pausedConf := writeFile("paused.conf", "resume-index = 42\noutput-filename = "+filepath.Join(dir, "old.json")+"\nrotate-dir = \n")
+	excludes := writeFile("excludes.txt", "10.0.0.5\n")
+
+	link := filepath.Join(dir, "link.conf")
+	require.NoError(t, os.Symlink(filepath.Join(outside, "target"), link), "no error expected creating symlink")
+
+	output := filepath.Join(outside, "out.json")
+
+	policy := masscan.HelperPolicy{
+		Dirs:    []string{dir},
+		MaxRate: 1000,
+	}
+
+	testCases := []struct {
+		name        string
+		req         masscan.HelperRequest
+		expectFiles []masscan.HelperFile
+		expectErr   string
+	}{
+		{
+			name: "scan",
+			req: masscan.HelperRequest{Args: []string{
+				"--adapter", "eth0", "--randomize-hosts", "-c", conf, "10.0.0.0-10.0.0.255", "-p80,U:53", "--excludefile", excludes,
+				"--max-rate", "500", "--shard", "1/2", "--output-format", "json", "--output-filename", output,
+			}},
+			expectFiles: []masscan.HelperFile{
+				{Arg: 4, Config: true},
+				{Arg: 8},
+				{Arg: 16, Output: true},
+			},
+		},
+		{
+			name: "resume",
+			req:  masscan.HelperRequest{Args: []string{"--resume", pausedConf, "--output-format", "json", "--output-filename", output}},
+			expectFiles: []masscan.HelperFile{
+				{Arg: 1, Config: true},
+				{Arg: 5, Output: true},
+			},
+		},
+		{
+			name:      "unsupported argument",
+			req:       masscan.HelperRequest{Args: []string{"--pcap", output}},
+			expectErr: "unsupported argument '--pcap'",
+		},
+		{
+			name:      "missing value",
+			req:       masscan.HelperRequest{Args: []string{"10.0.0.1", "--adapter"}},
+			expectErr: "--adapter requires a value",
+		},
+		{
+			name:      "invalid range",
+			req:       masscan.HelperRequest{Args: []string{"not-a-range"}},
+			expectErr: "not-a-range",
+		},
+		{
+			name:      "rate exceeded",
+			req:       masscan.HelperRequest{Args: []string{"--max-rate", "5000"}},
+			expectErr: "5000 exceeds the helper max rate 1000",
+		},
+		{
+			name:      "output format",
+			req:       masscan.HelperRequest{Args: []string{"--output-format", "binary"}},
+			expectErr: "only json is supported",
+		},
+		{
+			name:      "config outside dirs",
+			req:       masscan.HelperRequest{Args: []string{"-c", filepath.Join(outside, "masscan.conf")}},
+			expectErr: "is not within an allowed dir",
+		},
+		{
+			name:      "relative config",
+			req:       masscan.HelperRequest{Args: []string{"-c", "masscan.conf"}},
+			expectErr: "must be absolute",
+		},
+		{
+			name:      "traversal",
+			req:       masscan.HelperRequest{Args: []string{"--excludefile", filepath.Join(dir, "..", filepath.Base(outside), "excludes.txt")}},
+			expectErr: "is not within an allowed dir",
+		},
+		{
+			name:      "symlink",
+			req:       masscan.HelperRequest{Args: []string{"--resume", link}},
+			expectErr: "must not be a symlink",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			files, err := policy.Validate(tc.req)
+
+			if tc.expectErr == "" {
+				require.NoError(t, err, "no error expected validating request")
+
+				assert.Equal(t, tc.expectFiles, files, "unexpected files")
+
+				return
+			}
+
+			require.ErrorIs(t, err, masscan.ErrHelperRejected, "expected request to be rejected")
+			assert.ErrorContains(t, err, tc.expectErr, "unexpected rejection")
+		})
+	}
+}
+
+func TestHelperPolicy_CheckConfig(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name      string
+		config    string
+		expectErr string
+	}{
+		{
+			name:   "scan options",
+			config: "rate = 100\nbanners = true\nadapter-ip = 10.0.0.2\nports = 80,443\nrange = 10.0.0.0/24\n",
+		},
+		{
+			name:   "paused",
+			config: "# masscan\nrate = 100.00\nseed = 42\noutput-filename = /tmp/old.json\nrotate-dir = .\npcap = \nresume-index = 42\n",
+		},
+		{
+			name:      "rate exceeded",
+			config:    "rate = 10000000\n",
+			expectErr: "config key 'rate': 10000000 exceeds the helper max rate 1000",
+		},
+		{
+			name:      "max rate exceeded",
+			config:    "max-rate = 1000.50\n",
+			expectErr: "config key 'max-rate': 1000.50 exceeds the helper max rate 1000",
+		},
+		{
+			name:      "invalid rate",
+			config:    "rate = fast\n",
+			expectErr: "must be a positive number",
+		},
+		{
+			name:      "file key",
+			config:    "pcap = /etc/cron.d/masscan\n",
+			expectErr: "'pcap' is not supported",
+		},
+		{
+			name:      "unknown key",
+			config:    "hello-file[80] = /etc/shadow\n",
+			expectErr: "is not supported",
+		},
+		{
+			name:      "rotate dir",
+			config:    "rotate-dir = /etc\n",
+			expectErr: "'rotate-dir' is not supported",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := masscan.HelperPolicy{MaxRate: 1000}.CheckConfig(tc.config)
+
+			if tc.expectErr == "" {
+				assert.NoError(t, err, "no error expected checking config")
+
+				return
+			}
+
+			require.ErrorIs(t, err, masscan.ErrHelperRejected, "expected config to be rejected")
+			assert.ErrorContains(t, err, tc.expectErr, "unexpected rejection")
+		})
+	}
+}
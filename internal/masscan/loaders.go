@@ -4,12 +4,15 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"net/url"
 	"os"
+	"os/exec"
 	"strings"
+	"time"
 )
 
 func loadValue(value string) string {
@@ -110,6 +113,82 @@ func loadURL[T any](ctx context.Context, uri string, config URLConfig) (T, error
 	return decodeValue[T](ctx, "url", url.String(), data)
 }
 
+const (
+	// maxExecOutput limits the size of a value loaded from a command.
+	maxExecOutput = 4 << 20
+
+	// execWaitDelay is how long to wait for the command's output to close after it exits or is killed,
+	// such as when it starts a background process which inherits stdout.
+	execWaitDelay = time.Second
+)
+
+var errExecOutputLimit = fmt.Errorf("command output exceeds %d bytes", maxExecOutput)
+
+// limitWriter writes to w until n bytes have been written, after which writes fail.
+type limitWriter struct {
+	w        io.Writer
+	n        int
+	exceeded bool
+}
+
+func (l *limitWriter) Write(p []byte) (int, error) {
+	if len(p) > l.n {
+		l.exceeded = true
+
+		return 0, errExecOutputLimit
+	}
+
+	l.n -= len(p)
+
+	return l.w.Write(p)
+}
+
+func loadExec[T any](ctx context.Context, config ExecConfig) (T, error) {
+	var empty T
+
+	if config.Timeout > 0 {
+		var cancel context.CancelFunc
+
+		ctx, cancel = context.WithTimeout(ctx, config.Timeout)
+		defer cancel()
+	}
+
+	var (
+		output bytes.Buffer
+		stdout = &limitWriter{w: &output, n: maxExecOutput}
+		stderr = &tailBuffer{max: outputTailSize}
+	)
+
+	cmd := exec.CommandContext(ctx, config.Command, config.Args...)
+
+	cmd.Dir = config.Dir
+	cmd.Env = config.getEnv()
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	cmd.WaitDelay = execWaitDelay
+
+	err := cmd.Run()
+
+	switch {
+	case stdout.exceeded:
+		// The command is stopped by a broken pipe once its output is no longer read.
+		err = errExecOutputLimit
+	case errors.Is(err, exec.ErrWaitDelay) && ctx.Err() == nil:
+		// The command exited successfully, but a process it started kept its output open.
+		err = nil
+	}
+
+	if err != nil {
+		if ctx.Err() != nil {
+			err = fmt.Errorf("%w: %w", err, ctx.Err())
+		}
+
+		return empty, fmt.Errorf("error running command '%s': %w: %s", config.Command, err, strings.TrimSpace(stderr.String()))
+	}
+
+	return decodeValue[T](ctx, "exec", config.Command, output.Bytes())
+}
+
 func decodeValue[T any](_ context.Context, kind string, ref string, data []byte) (T, error) {
 	var empty T
 
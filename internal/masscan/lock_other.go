@@ -0,0 +1,20 @@
+//go:build !unix
+
+package masscan
+
+import (
+	"errors"
+	"os"
+)
+
+// lockFile creates the file, failing if it already exists.
+// File locks are only supported on unix, so an existing file is always reported as locked by another process,
+// and work dirs left behind by processes which did not exit cleanly are not removed.
+func lockFile(path string) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_RDWR, 0600)
+	if errors.Is(err, os.ErrExist) {
+		return nil, errLocked
+	}
+
+	return f, err
+}
@@ -1,205 +1,387 @@
 package masscan
 
 import (
-	"bytes"
 	"context"
-	"crypto/rand"
-	"encoding/json"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"io"
 	"os"
-	"os/exec"
-	"path/filepath"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/rs/zerolog"
 )
 
-var (
-	ErrTempfileExhausted = errors.New("exhausted attempts to allocate a temp file")
-)
-
 type Masscan struct {
 	cfg Config
 }
 
-func (m *Masscan) Run(ctx context.Context) (Report, error) {
-	logger := zerolog.Ctx(ctx)
+func (m *Masscan) Run(ctx context.Context, opts ...RunOption) (Report, error) {
+	options := NewRunOptions(opts...)
 
-	tmpfile, cleanup, err := tempFile(m.cfg.TempDir, "json")
-	if err != nil {
-		return Report{}, err
+	if options.MaxRate > 0 {
+		m = m.withMaxRate(options.MaxRate)
+	}
+
+	report := Report{
+		Partial: true,
+		MaxRate: m.cfg.MaxRate,
 	}
 
+	plan, cleanup, err := m.prepare(ctx, &report)
+
 	defer cleanup()
 
-	args := []string{
-		"--output-format", "json",
-		"--output-filename", tmpfile,
+	if err != nil {
+		return report, err
+	}
+
+	if options.Estimate != nil {
+		if report.AddressCount == 0 || report.Targets.PortCount() == 0 {
+			zerolog.Ctx(ctx).Debug().Msg("targets are not known, skipping scan estimate")
+		} else if err := options.Estimate(m.estimate(report)); err != nil {
+			return report, err
+		}
+	}
+
+	switch {
+	case m.cfg.Shards > 1:
+		return m.runShards(ctx, options, plan.args, report)
+	case m.cfg.Resume:
+		return m.runResumable(ctx, options, plan, report)
+	}
+
+	return m.scan(ctx, options.Progress, "", m.scanArgs(plan.args, m.cfg.MaxRate, ""), report)
+}
+
+// withMaxRate returns a copy of the scanner limited to the max rate, dividing it evenly between any shards.
+func (m *Masscan) withMaxRate(rate int) *Masscan {
+	cfg := m.cfg
+
+	cfg.MaxRate = rate
+	cfg.ShardOptions = slices.Clone(cfg.ShardOptions)
+
+	for i := range cfg.ShardOptions {
+		cfg.ShardOptions[i].MaxRate = 0
+	}
+
+	return &Masscan{
+		cfg: cfg,
+	}
+}
+
+// scanPlan holds the arguments shared by all masscan processes for a run.
+type scanPlan struct {
+	args []string
+
+	// identity describes the plan with the contents of temporary files instead of their paths,
+	// so that plans from separate runs can be compared.
+	identity []string
+}
+
+func (p *scanPlan) add(args ...string) {
+	p.args = append(p.args, args...)
+	p.identity = append(p.identity, args...)
+}
+
+func (p *scanPlan) addFile(flag, path, contents string) {
+	p.args = append(p.args, flag, path)
+	p.identity = append(p.identity, flag, contents)
+}
+
+// fingerprint returns a hash of the plan's identity.
+func (p scanPlan) fingerprint() string {
+	sum := sha256.Sum256([]byte(strings.Join(p.identity, "\x00")))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// prepare loads all dynamic values and builds the arguments shared by all masscan processes for the run.
+// The returned cleanup function removes any temporary files created and must always be called.
+func (m *Masscan) prepare(ctx context.Context, report *Report) (scanPlan, func(), error) {
+	var (
+		plan     scanPlan
+		cleanups []func()
+	)
+
+	cleanup := func() {
+		for _, fn := range cleanups {
+			fn()
+		}
 	}
 
-	if m.cfg.MaxRate > 0 {
-		args = append(args, "--max-rate", strconv.Itoa(m.cfg.MaxRate))
+	plan.add(m.cfg.networkArgs()...)
+
+	if m.cfg.Banners {
+		plan.add("--banners")
 	}
 
 	if m.cfg.ConfigPath != "" {
-		args = append(args, "-c", m.cfg.ConfigPath)
+		if err := m.cfg.checkStaticConfigConflicts(); err != nil {
+			return plan, cleanup, err
+		}
+
+		plan.add("-c", m.cfg.ConfigPath)
 	} else if m.cfg.Config.Configured() {
 		config, err := m.cfg.Config.GetValue(ctx)
 		if err != nil {
-			return Report{}, fmt.Errorf("failed to get masscan config: %w", err)
+			return plan, cleanup, fmt.Errorf("%w for config: %w", ErrLoadValue, err)
 		}
 
-		conffile, cleanup, err := tempFile(m.cfg.TempDir, "conf")
-		if err != nil {
-			return Report{}, err
+		if err := m.cfg.checkConfigConflicts("config", config); err != nil {
+			return plan, cleanup, err
 		}
 
-		defer cleanup()
-
-		if err := os.WriteFile(conffile, []byte(config), 0644); err != nil {
-			return Report{}, fmt.Errorf("failed to write config: %w", err)
+		conffile, remove, err := tempFile(m.cfg.TempDir, "conf", config)
+		if err != nil {
+			return plan, cleanup, fmt.Errorf("failed to write config: %w", err)
 		}
 
-		args = append(args, "-c", conffile)
-	}
+		cleanups = append(cleanups, remove)
 
-	report := Report{
-		Partial: true,
-		MaxRate: m.cfg.MaxRate,
+		plan.addFile("-c", conffile, config)
 	}
 
 	if m.cfg.Ranges.Configured() {
 		ranges, err := m.cfg.Ranges.GetValue(ctx)
 		if err != nil {
-			return report, fmt.Errorf("failed to get ranges: %w", err)
+			return plan, cleanup, fmt.Errorf("%w for ranges: %w", ErrLoadValue, err)
 		}
 
 		report.Ranges = ranges
 
-		args = append(args, ranges...)
+		resolved, hostnames, err := m.cfg.ResolveRanges(ctx, ranges)
+		if err != nil {
+			return plan, cleanup, err
+		}
+
+		report.Hostnames = hostnames
+
+		if report.Targets.Ranges, err = ParseRanges(resolved); err != nil {
+			return plan, cleanup, err
+		}
+
+		plan.add(rangeStrings(report.Targets.Ranges)...)
 	}
 
 	if m.cfg.Ports.Configured() {
 		ports, err := m.cfg.Ports.GetValue(ctx)
 		if err != nil {
-			return report, fmt.Errorf("failed to get ports: %w", err)
+			return plan, cleanup, fmt.Errorf("%w for ports: %w", ErrLoadValue, err)
 		}
 
 		report.Ports = ports
 
-		args = append(args, "-p"+strings.Join(ports, ","))
+		expanded, groups, err := m.cfg.PortGroups.Expand(ports)
+		if err != nil {
+			return plan, cleanup, err
+		}
+
+		report.PortGroups = groups
+
+		if report.Targets.Ports, err = ParsePorts(expanded); err != nil {
+			return plan, cleanup, err
+		}
+
+		if len(report.Targets.Ports) != 0 {
+			plan.add("-p" + strings.Join(rangeStrings(report.Targets.Ports), ","))
+		}
 	}
 
-	logger.Debug().Msgf("prepared command %s %q", m.cfg.BinPath, args)
+	if m.cfg.Excludes.Configured() {
+		excludes, err := m.cfg.Excludes.GetValue(ctx)
+		if err != nil {
+			return plan, cleanup, fmt.Errorf("%w for excludes: %w", ErrLoadValue, err)
+		}
 
-	var output bytes.Buffer
+		report.Excludes = excludes
 
-	cmd := exec.CommandContext(ctx, m.cfg.BinPath, args...)
+		if report.Targets.Excludes, err = ParseRanges(excludes); err != nil {
+			return plan, cleanup, err
+		}
 
-	cmd.WaitDelay = m.cfg.WaitDelay
-	cmd.Stdout = &output
-	cmd.Stderr = &output
+		if len(report.Targets.Excludes) != 0 {
+			contents := strings.Join(rangeStrings(report.Targets.Excludes), "\n") + "\n"
+
+			excludefile, remove, err := tempFile(m.cfg.TempDir, "exclude", contents)
+			if err != nil {
+				return plan, cleanup, fmt.Errorf("failed to write excludes: %w", err)
+			}
 
-	if err := cmd.Run(); err != nil {
-		return report, fmt.Errorf("failed to run command: %w: %s", err, output.String())
+			cleanups = append(cleanups, remove)
+
+			plan.addFile("--excludefile", excludefile, contents)
+		}
 	}
 
-	out := output.String()
+	report.AddressCount = report.Targets.AddressCount()
 
-	logger.Debug().Msgf("command output: %s", out)
+	return plan, cleanup, nil
+}
 
-	// The last line of output looks like:
-	// rate:  0.00-kpps, 100.00% done, waiting -30-secs, found=0
-	lastUpdateIndex := strings.LastIndex(out, "found=")
-	foundStr := strings.TrimSpace(out[lastUpdateIndex+6:])
+// scanArgs extends the shared arguments with the options specific to a single masscan process.
+func (m *Masscan) scanArgs(args []string, maxRate int, adapter string) []string {
+	args = slices.Clone(args)
 
-	found, err := strconv.Atoi(foundStr)
-	if err != nil {
-		logger.Debug().Err(err).Msgf("unable to parse command output for found count: '%s', attempting to read report anyways", foundStr)
-	} else if found == 0 {
-		logger.Debug().Msg("no results found")
+	if maxRate > 0 {
+		args = append(args, "--max-rate", strconv.Itoa(maxRate))
+	}
 
-		return report, nil
-	} else {
-		logger.Debug().Msgf("command reports %d ports found", found)
+	if adapter != "" {
+		args = append(args, "--adapter", adapter)
 	}
 
-	return m.generateReport(ctx, tmpfile, report)
+	return args
 }
 
-func (m *Masscan) generateReport(ctx context.Context, file string, report Report) (Report, error) {
+// scan executes a single masscan process and adds its results to the report.
+//
+// dir sets the working directory of the process, which is where masscan writes paused.conf when interrupted.
+// The process's work dir is used when dir is empty.
+// If the run is cancelled, any results masscan wrote before exiting are included in the returned report.
+func (m *Masscan) scan(ctx context.Context, progress ProgressFunc, dir string, args []string, report Report) (Report, error) {
 	logger := zerolog.Ctx(ctx)
 
-	contents, err := os.ReadFile(file)
+	if dir == "" {
+		var err error
+
+		if dir, err = getWorkDir(m.cfg.TempDir); err != nil {
+			return report, err
+		}
+	}
+
+	tmpfile, cleanup, err := tempFile(m.cfg.TempDir, "json", "")
 	if err != nil {
 		return report, err
 	}
 
-	if err := json.Unmarshal(contents, &report.RawResults); err != nil {
-		logger.Debug().Err(err).Str("report_contents", string(contents)).Msg("failed to decode raw report results")
+	defer cleanup()
+
+	// Output options are last so they take precedence over any loaded config or resume file.
+	args = append(slices.Clone(args),
+		"--output-format", "json",
+		"--output-filename", tmpfile,
+	)
+
+	logger.Debug().Msgf("prepared command %s %q", strings.Join(m.cfg.command(), " "), args)
 
-		return report, fmt.Errorf("failed to decode report results: %w", err)
+	output := &tailBuffer{max: outputTailSize}
+
+	// stdout and stderr share the same writer so output is written from a single goroutine.
+	status := &statusWriter{
+		w:        output,
+		progress: progress,
 	}
 
-	for _, entry := range report.RawResults {
-		for _, port := range entry.Ports {
-			if report.Results == nil {
-				report.Results = map[string]Results{
-					entry.IP: {
-						IP:    entry.IP,
-						Ports: []Port{port},
-					},
-				}
-			} else {
-				result, ok := report.Results[entry.IP]
-				if !ok {
-					result.IP = entry.IP
-				}
+	start := time.Now()
+
+	runErr := m.execute(ctx, dir, args, status)
+
+	status.flush()
+
+	stats := status.stats(start, time.Now(), m.cfg.Retries)
+	out := output.String()
+	final, reported := status.final()
+
+	if runErr == nil && !reported && len(status.fatal) != 0 {
+		runErr = errFatalOutput
+	}
 
-				result.Ports = append(result.Ports, port)
+	if runErr != nil {
+		// An exit code of -1 means masscan was terminated by a signal rather than exiting.
+		if code, ok := exitCode(runErr); ok {
+			logger.Debug().Int("exit_code", code).Msgf("masscan exited: %s", runErr)
+		}
 
-				report.Results[entry.IP] = result
+		err = classifyRunError(ctx, fmt.Errorf("failed to run command: %w: %s", runErr, status.failure(out)), out)
+
+		if ctx.Err() != nil {
+			// Keep whatever results were written before masscan was stopped.
+			partial, decodeErr := m.generateReport(ctx, tmpfile, report)
+			if decodeErr != nil {
+				logger.Debug().Err(decodeErr).Msg("failed to decode results of interrupted scan")
 			}
+
+			partial.Partial = true
+			partial.Stats = &stats
+
+			return partial, err
 		}
+
+		return report, err
 	}
 
-	report.Partial = false
+	logger.Debug().Msgf("command output: %s", out)
 
-	return report, nil
+	report.Stats = &stats
+
+	switch {
+	case !reported:
+		logger.Debug().Msg("masscan did not report a final status, attempting to read report anyways")
+	case final.Found == 0:
+		logger.Debug().Msg("no results found")
+
+		report.Partial = false
+
+		return report, nil
+	default:
+		logger.Debug().Msgf("command reports %d ports found", final.Found)
+	}
+
+	return m.generateReport(ctx, tmpfile, report)
 }
 
-func tempFile(dir string, ext string) (string, func(), error) {
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		return "", nil, err
+func (m *Masscan) generateReport(ctx context.Context, file string, report Report) (Report, error) {
+	logger := zerolog.Ctx(ctx)
+
+	f, err := os.Open(file)
+	if err != nil {
+		return report, fmt.Errorf("%w: %w", ErrParseReport, err)
 	}
 
-	var err error
+	defer f.Close()
 
-	for i := 0; i < 10; i++ {
-		var uniq [8]byte
+	decoder := newResultDecoder(f)
 
-		_, err = rand.Read(uniq[:])
-		if err != nil {
-			return "", nil, err
-		}
+	var (
+		entry   RawResult
+		records int
+	)
+
+	for {
+		if err := decoder.Decode(&entry); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
 
-		filename := filepath.Join(dir, fmt.Sprintf("masscan-%02x.%s", string(uniq[:]), ext))
+			logger.Debug().Err(err).Int("records_decoded", records).Msg("failed to decode raw report results")
 
-		if _, err = os.Stat(filename); err != nil && errors.Is(err, os.ErrNotExist) {
-			return filename, func() {
-				os.Remove(filename)
-			}, nil
+			return report, fmt.Errorf("%w: failed to decode report results: %w", ErrParseReport, err)
 		}
+
+		records++
+
+		report.addResult(entry)
 	}
 
-	return "", nil, fmt.Errorf("%w: %w", ErrTempfileExhausted, err)
+	logger.Debug().Msgf("decoded %d records for %d hosts", records, len(report.Results))
+
+	report.Partial = false
+
+	return report, nil
 }
 
 func New(_ context.Context, opts ...Option) (*Masscan, error) {
 	cfg := newConfig(opts...)
 
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
 	return &Masscan{
 		cfg: cfg,
 	}, nil
@@ -0,0 +1,813 @@
+package masscan_test
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mikemrm/masscan-exporter/internal/masscan"
+	"github.com/mikemrm/masscan-exporter/internal/masscan/masscantest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMain(m *testing.M) {
+	masscantest.Main(m)
+}
+
+var (
+	testRanges = masscan.DynamicValue[[]string]{Value: []string{"10.0.0.0/24"}}
+	testPorts  = masscan.DynamicValue[[]string]{Value: []string{"80"}}
+)
+
+func testResult(ip string, port int) masscan.RawResult {
+	return masscan.RawResult{
+		IP:        ip,
+		Timestamp: "1745695800",
+		Ports: []masscan.RawPort{
+			{Port: masscan.Port{Port: port, Proto: "tcp", Status: "open", Reason: "syn-ack", TTL: 64}},
+		},
+	}
+}
+
+func newTestMasscan(t *testing.T, sim *masscantest.Simulator, cfg masscan.Config) *masscan.Masscan {
+	t.Helper()
+
+	cfg.BinPath = sim.Path()
+	cfg.TempDir = t.TempDir()
+
+	m, err := masscan.New(t.Context(), masscan.WithConfig(cfg))
+	require.NoError(t, err, "no error expected creating masscan")
+
+	return m
+}
+
+func TestMasscan_Run(t *testing.T) {
+	t.Parallel()
+
+	sim := masscantest.New(t, masscantest.Scenario{
+		Results: []masscan.RawResult{
+			testResult("10.0.0.1", 80),
+			testResult("10.0.0.1", 443),
+			testResult("10.0.0.2", 80),
+		},
+		Stderr: "Starting masscan 1.3.2\nScanning 254 hosts [2 ports/host]\n",
+	})
+
+	m := newTestMasscan(t, sim, masscan.Config{
+		Retries:  1,
+		Ranges:   masscan.DynamicValue[[]string]{Value: []string{"10.0.0.0/24"}},
+		Ports:    masscan.DynamicValue[[]string]{Value: []string{"80", "443"}},
+		Excludes: masscan.DynamicValue[[]string]{Value: []string{"10.0.0.3", "10.0.0.4"}},
+	})
+
+	report, err := m.Run(t.Context())
+	require.NoError(t, err, "no error expected running masscan")
+
+	assert.False(t, report.Partial, "expected report to be complete")
+	assert.Equal(t, []string{"10.0.0.0/24"}, report.Ranges, "unexpected report ranges")
+	assert.Equal(t, []string{"80", "443"}, report.Ports, "unexpected report ports")
+	assert.Equal(t, []string{"10.0.0.3", "10.0.0.4"}, report.Excludes, "unexpected report excludes")
+	assert.Equal(t, uint64(254), report.AddressCount, "unexpected report address count")
+	require.Len(t, report.Targets.Excludes, 1, "expected excludes to be merged")
+	assert.Equal(t, "10.0.0.3-10.0.0.4", report.Targets.Excludes[0].String(), "unexpected normalized excludes")
+
+	require.Len(t, report.Results, 2, "unexpected number of hosts")
+	assert.Len(t, report.Results["10.0.0.1"].Ports, 2, "unexpected number of ports for 10.0.0.1")
+	assert.Len(t, report.Results["10.0.0.2"].Ports, 1, "unexpected number of ports for 10.0.0.2")
+
+	require.NotNil(t, report.Stats, "expected run stats")
+	assert.Equal(t, uint64(254), report.Stats.Hosts, "unexpected stats hosts")
+	assert.Equal(t, 2, report.Stats.PortsPerHost, "unexpected stats ports per host")
+	assert.Equal(t, uint64(254*2*2), report.Stats.EstimatedPackets, "expected estimated packets to include retries")
+	assert.Equal(t, 3, report.Stats.Found, "unexpected stats found")
+	assert.Positive(t, report.Stats.Duration, "expected stats duration")
+	assert.Positive(t, report.Stats.EstimatedRate, "expected stats estimated rate")
+
+	invocations := sim.Invocations(t)
+	require.Len(t, invocations, 1, "expected masscan to be executed once")
+
+	args := invocations[0].Args
+
+	assert.Contains(t, args, "10.0.0.0/24", "expected ranges to be passed")
+	assert.Contains(t, args, "-p80,443", "expected ports to be passed")
+	assert.Contains(t, args, "--excludefile", "expected excludes file to be passed")
+	assert.Equal(t, "10.0.0.3-10.0.0.4\n", invocations[0].Files["--excludefile"], "unexpected excludes file contents")
+}
+
+func TestMasscan_Run_IPv6(t *testing.T) {
+	t.Parallel()
+
+	sim := masscantest.New(t, masscantest.Scenario{
+		Results: []masscan.RawResult{
+			testResult("2001:DB8:0:0::1", 80),
+			testResult("2001:db8::1", 443),
+			testResult("::ffff:10.0.0.1", 80),
+		},
+	})
+
+	m := newTestMasscan(t, sim, masscan.Config{
+		Ranges: masscan.DynamicValue[[]string]{Value: []string{"2001:db8::/64", "10.0.0.0/24"}},
+		Ports:  masscan.DynamicValue[[]string]{Value: []string{"80", "443"}},
+	})
+
+	report, err := m.Run(t.Context())
+	require.NoError(t, err, "no error expected running masscan")
+
+	require.Len(t, report.Results, 2, "unexpected number of hosts")
+	assert.Equal(t, "2001:db8::1", report.Results["2001:db8::1"].IP, "expected canonical ipv6 address")
+	assert.Len(t, report.Results["2001:db8::1"].Ports, 2, "expected ports for the same address to be combined")
+	assert.Contains(t, report.Results, "10.0.0.1", "expected ipv4-mapped address to be reported as ipv4")
+
+	invocations := sim.Invocations(t)
+	require.Len(t, invocations, 1, "expected masscan to be executed once")
+
+	assert.Contains(t, invocations[0].Args, "2001:db8::/64", "expected ipv6 range to be passed")
+	assert.Contains(t, invocations[0].Args, "10.0.0.0/24", "expected ipv4 range to be passed")
+}
+
+// testResolver resolves hostnames from a static map, unknown hostnames are not found.
+type testResolver map[string][]netip.Addr
+
+func (r testResolver) LookupNetIP(_ context.Context, _, host string) ([]netip.Addr, error) {
+	addrs, ok := r[host]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+
+	return addrs, nil
+}
+
+func (r testResolver) LookupSRV(_ context.Context, _, _, name string) (string, []*net.SRV, error) {
+	return "", nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+}
+
+func TestMasscan_Run_Hostnames(t *testing.T) {
+	t.Parallel()
+
+	sim := masscantest.New(t, masscantest.Scenario{
+		Results: []masscan.RawResult{
+			testResult("10.0.1.5", 443),
+		},
+	})
+
+	m := newTestMasscan(t, sim, masscan.Config{
+		Ranges: masscan.DynamicValue[[]string]{Value: []string{"10.0.0.0/24", "web.example.com", "old.example.com"}},
+		Ports:  testPorts,
+		Resolver: testResolver{
+			"web.example.com": {netip.MustParseAddr("10.0.1.5"), netip.MustParseAddr("10.0.0.7")},
+		},
+	})
+
+	report, err := m.Run(t.Context())
+	require.NoError(t, err, "no error expected running masscan")
+
+	assert.Equal(t, []string{"10.0.0.0/24", "web.example.com", "old.example.com"}, report.Ranges, "expected configured ranges to be reported")
+	assert.Equal(t, "web.example.com", report.Hostnames.Label("10.0.1.5"), "expected resolved address to map to its hostname")
+	assert.Empty(t, report.Hostnames.Label("10.0.0.1"), "expected no hostname for addresses not resolved")
+	assert.Equal(t, uint64(257), report.AddressCount, "expected resolved addresses to be counted")
+
+	invocations := sim.Invocations(t)
+	require.Len(t, invocations, 1, "expected masscan to be executed once")
+
+	assert.Contains(t, invocations[0].Args, "10.0.0.0/24", "expected range to be passed")
+	assert.Contains(t, invocations[0].Args, "10.0.1.5", "expected resolved address to be passed")
+	assert.NotContains(t, invocations[0].Args, "web.example.com", "expected hostname to not be passed")
+}
+
+func TestMasscan_Run_Estimate(t *testing.T) {
+	t.Parallel()
+
+	sim := masscantest.New(t, masscantest.Scenario{})
+
+	m := newTestMasscan(t, sim, masscan.Config{
+		MaxRate:  500,
+		Shards:   2,
+		Retries:  1,
+		Wait:     new(5 * time.Second),
+		Ranges:   masscan.DynamicValue[[]string]{Value: []string{"10.0.0.0/24"}},
+		Excludes: masscan.DynamicValue[[]string]{Value: []string{"10.0.0.0/26"}},
+		Ports:    masscan.DynamicValue[[]string]{Value: []string{"80-81", "U:53"}},
+	})
+
+	var estimate masscan.Estimate
+
+	_, err := m.Run(t.Context(), masscan.WithEstimate(func(e masscan.Estimate) error {
+		estimate = e
+
+		return nil
+	}))
+	require.NoError(t, err, "no error expected running masscan")
+
+	assert.Equal(t, masscan.Estimate{
+		Addresses: 192,
+		Ports:     3,
+		Packets:   192 * 3 * 2,
+		Rate:      500,
+		Duration:  7304 * time.Millisecond,
+	}, estimate, "unexpected estimate")
+
+	_, err = m.Run(t.Context(), masscan.WithEstimate(func(masscan.Estimate) error {
+		return masscan.ErrScanRefused
+	}))
+	require.ErrorIs(t, err, masscan.ErrScanRefused, "expected estimate error to be returned")
+
+	assert.Len(t, sim.Invocations(t), 2, "expected masscan to not be executed when the estimate is refused")
+}
+
+func TestMasscan_Run_Config(t *testing.T) {
+	t.Parallel()
+
+	sim := masscantest.New(t, masscantest.Scenario{})
+
+	m := newTestMasscan(t, sim, masscan.Config{
+		Ranges: masscan.DynamicValue[[]string]{Value: []string{"10.0.0.0/24"}},
+		Config: masscan.DynamicValue[string]{Value: "ports = 80,443\n"},
+	})
+
+	_, err := m.Run(t.Context())
+	require.NoError(t, err, "no error expected running masscan")
+
+	invocations := sim.Invocations(t)
+	require.Len(t, invocations, 1, "expected masscan to be executed once")
+
+	assert.Equal(t, "ports = 80,443\n", invocations[0].Files["-c"], "unexpected config contents")
+}
+
+func TestMasscan_Run_NetworkOptions(t *testing.T) {
+	t.Parallel()
+
+	sim := masscantest.New(t, masscantest.Scenario{})
+
+	wait := 5 * time.Second
+	seed := int64(42)
+
+	m := newTestMasscan(t, sim, masscan.Config{
+		Ranges:         testRanges,
+		Ports:          testPorts,
+		Adapter:        "eth1",
+		AdapterIP:      "10.0.0.200",
+		AdapterMAC:     "00:11:22:33:44:55",
+		RouterMAC:      "66:55:44:33:22:11",
+		SourcePort:     "61000",
+		Retries:        2,
+		Wait:           &wait,
+		TTL:            64,
+		RandomizeHosts: true,
+		Seed:           &seed,
+		PacketTrace:    true,
+	})
+
+	_, err := m.Run(t.Context())
+	require.NoError(t, err, "no error expected running masscan")
+
+	invocations := sim.Invocations(t)
+	require.Len(t, invocations, 1, "expected masscan to be executed once")
+
+	expected := []string{
+		"--adapter", "eth1",
+		"--adapter-ip", "10.0.0.200",
+		"--adapter-mac", "00:11:22:33:44:55",
+		"--router-mac", "66:55:44:33:22:11",
+		"--source-port", "61000",
+		"--retries", "2",
+		"--wait", "5",
+		"--ttl", "64",
+		"--randomize-hosts",
+		"--seed", "42",
+		"--packet-trace",
+	}
+
+	assert.Equal(t, expected, invocations[0].Args[:len(expected)], "unexpected network arguments")
+}
+
+func TestMasscan_Run_Launcher(t *testing.T) {
+	t.Parallel()
+
+	sim := masscantest.New(t, masscantest.Scenario{
+		Results: []masscan.RawResult{testResult("10.0.0.1", 80)},
+	})
+
+	m := newTestMasscan(t, sim, masscan.Config{
+		Launcher: []string{"env", "MASSCAN_LAUNCHER=1"},
+		Ranges:   testRanges,
+		Ports:    testPorts,
+	})
+
+	report, err := m.Run(t.Context())
+	require.NoError(t, err, "no error expected running masscan with a launcher")
+
+	assert.Len(t, report.Results, 1, "unexpected number of hosts")
+
+	invocations := sim.Invocations(t)
+	require.Len(t, invocations, 1, "expected masscan to be executed once")
+
+	assert.Equal(t, "10.0.0.0/24", invocations[0].Args[0], "expected launcher args to not be passed to masscan")
+}
+
+func TestMasscan_Run_PortGroups(t *testing.T) {
+	t.Parallel()
+
+	sim := masscantest.New(t, masscantest.Scenario{})
+
+	m := newTestMasscan(t, sim, masscan.Config{
+		Ranges:     testRanges,
+		Ports:      masscan.DynamicValue[[]string]{Value: []string{"@web", "22"}},
+		PortGroups: masscan.PortGroups{"web": {"80", "443"}},
+	})
+
+	report, err := m.Run(t.Context())
+	require.NoError(t, err, "no error expected running masscan")
+
+	assert.Equal(t, []string{"@web", "22"}, report.Ports, "expected configured ports to be reported")
+	assert.Equal(t, map[string][]string{"web": {"80", "443"}}, report.PortGroups, "expected expanded port groups to be reported")
+
+	invocations := sim.Invocations(t)
+	require.Len(t, invocations, 1, "expected masscan to be executed once")
+
+	assert.Contains(t, invocations[0].Args, "-p22,80,443", "expected port groups to be expanded")
+}
+
+func TestMasscan_Run_ConfigConflict(t *testing.T) {
+	t.Parallel()
+
+	sim := masscantest.New(t, masscantest.Scenario{})
+
+	// Configs loaded at run time are only checked once loaded.
+	config := filepath.Join(t.TempDir(), "masscan.conf")
+
+	err := os.WriteFile(config, []byte("ports = 80\nadapter = eth0\n"), 0644)
+	require.NoError(t, err, "no error expected writing config")
+
+	m := newTestMasscan(t, sim, masscan.Config{
+		Ranges:  testRanges,
+		Adapter: "eth1",
+		Config:  masscan.DynamicValue[string]{File: config},
+	})
+
+	_, err = m.Run(t.Context())
+	require.ErrorIs(t, err, masscan.ErrConfigConflict, "expected config conflict error")
+	require.ErrorContains(t, err, "adapter is set in config", "expected conflicting option in error")
+
+	assert.Empty(t, sim.Invocations(t), "expected masscan to not be executed")
+}
+
+func TestMasscan_Run_NoneFound(t *testing.T) {
+	t.Parallel()
+
+	sim := masscantest.New(t, masscantest.Scenario{
+		NoOutput: true,
+	})
+
+	m := newTestMasscan(t, sim, masscan.Config{Ranges: testRanges, Ports: testPorts})
+
+	report, err := m.Run(t.Context())
+	require.NoError(t, err, "no error expected running masscan")
+
+	assert.Empty(t, report.Results, "expected no results")
+}
+
+func TestMasscan_Run_Progress(t *testing.T) {
+	t.Parallel()
+
+	sim := masscantest.New(t, masscantest.Scenario{
+		Status: []string{
+			"rate:  0.10-kpps, 50.00% done,   0:00:05 remaining, found=0",
+			"rate:  0.10-kpps, 100.00% done, waiting 2-secs, found=1",
+		},
+		Results: []masscan.RawResult{
+			testResult("10.0.0.1", 80),
+		},
+	})
+
+	m := newTestMasscan(t, sim, masscan.Config{Ranges: testRanges, Ports: testPorts})
+
+	var (
+		mu       sync.Mutex
+		progress []masscan.Progress
+	)
+
+	_, err := m.Run(t.Context(), masscan.WithProgress(func(p masscan.Progress) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		progress = append(progress, p)
+	}))
+	require.NoError(t, err, "no error expected running masscan")
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	require.Len(t, progress, 3, "expected a progress update for each status line")
+	assert.Equal(t, masscan.Progress{Rate: 100, Percent: 50, Remaining: 5 * time.Second}, progress[0], "unexpected first progress")
+	assert.Equal(t, 1, progress[2].Found, "unexpected final found count")
+}
+
+func TestMasscan_Run_Timeout(t *testing.T) {
+	t.Parallel()
+
+	sim := masscantest.New(t, masscantest.Scenario{
+		Delay:           time.Minute,
+		IgnoreInterrupt: true,
+	})
+
+	m := newTestMasscan(t, sim, masscan.Config{
+		WaitDelay: 100 * time.Millisecond,
+		Ranges:    testRanges,
+		Ports:     testPorts,
+	})
+
+	ctx, cancel := context.WithTimeout(t.Context(), 200*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+
+	report, err := m.Run(ctx)
+	require.ErrorIs(t, err, masscan.ErrTimeout, "expected timeout error when scan times out")
+
+	assert.Less(t, time.Since(start), 10*time.Second, "expected run to stop shortly after the timeout")
+	assert.True(t, report.Partial, "expected report to be partial")
+}
+
+func TestMasscan_Run_ExitFailure(t *testing.T) {
+	t.Parallel()
+
+	sim := masscantest.New(t, masscantest.Scenario{
+		Stderr:   "FAIL: could not determine default interface\n",
+		NoOutput: true,
+		ExitCode: 1,
+	})
+
+	m := newTestMasscan(t, sim, masscan.Config{Ranges: testRanges, Ports: testPorts})
+
+	report, err := m.Run(t.Context())
+	require.ErrorContains(t, err, "could not determine default interface", "expected masscan output in error")
+	require.ErrorIs(t, err, masscan.ErrExit, "expected exit error")
+
+	assert.True(t, report.Partial, "expected report to be partial")
+}
+
+func TestMasscan_Run_FatalOutput(t *testing.T) {
+	t.Parallel()
+
+	sim := masscantest.New(t, masscantest.Scenario{
+		Stderr:      "Starting masscan 1.3.2\n[-] FAIL: failed to detect IP of interface \"eth9\"\n",
+		FinalStatus: new(""),
+		NoOutput:    true,
+	})
+
+	m := newTestMasscan(t, sim, masscan.Config{Ranges: testRanges, Ports: testPorts})
+
+	report, err := m.Run(t.Context())
+	require.ErrorIs(t, err, masscan.ErrExit, "expected exit error when masscan reports a fatal error")
+	require.ErrorContains(t, err, `failed to detect IP of interface "eth9"`, "expected fatal message in error")
+	assert.NotContains(t, err.Error(), "Starting masscan", "expected only fatal messages in error")
+
+	assert.True(t, report.Partial, "expected report to be partial")
+}
+
+func TestMasscan_Run_NoFinalStatus(t *testing.T) {
+	t.Parallel()
+
+	sim := masscantest.New(t, masscantest.Scenario{
+		Results: []masscan.RawResult{
+			testResult("10.0.0.1", 80),
+		},
+		FinalStatus: new("waiting several seconds to exit...\n"),
+	})
+
+	m := newTestMasscan(t, sim, masscan.Config{Ranges: testRanges, Ports: testPorts})
+
+	report, err := m.Run(t.Context())
+	require.NoError(t, err, "no error expected when the final status is missing")
+
+	assert.False(t, report.Partial, "expected report to be complete")
+	assert.Len(t, report.Results["10.0.0.1"].Ports, 1, "expected results to be read without a final status")
+}
+
+func TestMasscan_Run_ParseFailure(t *testing.T) {
+	t.Parallel()
+
+	sim := masscantest.New(t, masscantest.Scenario{
+		Results: []masscan.RawResult{
+			testResult("10.0.0.1", 80),
+		},
+		RawOutput: `[{"ip": "10.0.0.1", "ports": [{"port": "eighty"}]}]`,
+	})
+
+	m := newTestMasscan(t, sim, masscan.Config{Ranges: testRanges, Ports: testPorts})
+
+	report, err := m.Run(t.Context())
+	require.ErrorContains(t, err, "failed to decode report results", "expected decode error")
+	require.ErrorIs(t, err, masscan.ErrParseReport, "expected parse report error")
+
+	assert.True(t, report.Partial, "expected report to be partial")
+}
+
+func TestMasscan_Run_Shards(t *testing.T) {
+	t.Parallel()
+
+	sim := masscantest.New(t, masscantest.Scenario{
+		Shards: map[int]masscantest.Scenario{
+			1: {Results: []masscan.RawResult{testResult("10.0.0.1", 80)}},
+			2: {Results: []masscan.RawResult{testResult("10.0.0.1", 443), testResult("10.0.0.2", 80)}},
+			3: {Stderr: "FAIL: shard failure\n", NoOutput: true, ExitCode: 1},
+		},
+	})
+
+	m := newTestMasscan(t, sim, masscan.Config{
+		MaxRate:      300,
+		Shards:       3,
+		ShardOptions: []masscan.ShardOptions{{Adapter: "eth1", MaxRate: 50}},
+		Ranges:       testRanges,
+		Ports:        testPorts,
+	})
+
+	report, err := m.Run(t.Context())
+	require.NoError(t, err, "no error expected when some shards succeed")
+
+	assert.True(t, report.Partial, "expected report to be partial when a shard fails")
+	assert.Len(t, report.Results["10.0.0.1"].Ports, 2, "expected results from shards to be merged")
+	assert.Len(t, report.Results["10.0.0.2"].Ports, 1, "expected results from shards to be merged")
+
+	require.Len(t, report.Shards, 3, "expected a report for each shard")
+	assert.True(t, report.Shards[0].Success, "expected shard 1 to succeed")
+	assert.True(t, report.Shards[1].Success, "expected shard 2 to succeed")
+	assert.False(t, report.Shards[2].Success, "expected shard 3 to fail")
+	assert.Contains(t, report.Shards[2].Error, "shard failure", "expected shard error")
+
+	require.NotNil(t, report.Stats, "expected run stats")
+	assert.Equal(t, 3, report.Stats.Found, "expected found to be combined across successful shards")
+
+	invocations := sim.Invocations(t)
+	require.Len(t, invocations, 3, "expected a masscan process for each shard")
+
+	shardArgs := make(map[string][]string)
+
+	for _, invocation := range invocations {
+		for i, arg := range invocation.Args {
+			if arg == "--shard" {
+				shardArgs[invocation.Args[i+1]] = invocation.Args
+			}
+		}
+	}
+
+	require.Len(t, shardArgs, 3, "expected each shard to be passed")
+	assert.Subset(t, shardArgs["1/3"], []string{"--adapter", "eth1", "--max-rate", "50"}, "expected shard options for shard 1")
+	assert.Subset(t, shardArgs["2/3"], []string{"--max-rate", "100"}, "expected max rate to be divided for shard 2")
+	assert.NotContains(t, shardArgs["2/3"], "--adapter", "expected no adapter for shard 2")
+}
+
+func TestMasscan_Run_MaxRate(t *testing.T) {
+	t.Parallel()
+
+	sim := masscantest.New(t, masscantest.Scenario{})
+
+	m := newTestMasscan(t, sim, masscan.Config{
+		MaxRate:      300,
+		Shards:       2,
+		ShardOptions: []masscan.ShardOptions{{Adapter: "eth1", MaxRate: 250}},
+		Ranges:       testRanges,
+		Ports:        testPorts,
+	})
+
+	report, err := m.Run(t.Context(), masscan.WithMaxRate(100))
+	require.NoError(t, err, "no error expected running masscan")
+
+	assert.Equal(t, 100, report.MaxRate, "expected overridden max rate to be reported")
+
+	invocations := sim.Invocations(t)
+	require.Len(t, invocations, 2, "expected a masscan process for each shard")
+
+	for _, invocation := range invocations {
+		assert.Subset(t, invocation.Args, []string{"--max-rate", "50"}, "expected overridden max rate to be divided between shards")
+	}
+}
+
+func TestMasscan_Run_ShardsAllFailed(t *testing.T) {
+	t.Parallel()
+
+	sim := masscantest.New(t, masscantest.Scenario{
+		NoOutput: true,
+		ExitCode: 1,
+	})
+
+	m := newTestMasscan(t, sim, masscan.Config{
+		Shards: 2,
+		Ranges: testRanges,
+		Ports:  testPorts,
+	})
+
+	report, err := m.Run(t.Context())
+	require.ErrorIs(t, err, masscan.ErrAllShardsFailed, "expected error when all shards fail")
+
+	assert.Len(t, report.Shards, 2, "expected a report for each shard")
+}
+
+func TestMasscan_Run_Resume(t *testing.T) {
+	t.Parallel()
+
+	sim := masscantest.New(t, masscantest.Scenario{
+		Delay:            time.Minute,
+		PauseOnInterrupt: true,
+		PartialResults:   []masscan.RawResult{testResult("10.0.0.1", 80)},
+		Resumed: &masscantest.Scenario{
+			Results: []masscan.RawResult{testResult("10.0.0.2", 80)},
+		},
+	})
+
+	cfg := masscan.Config{
+		Resume:    true,
+		ResumeDir: t.TempDir(),
+		Ranges:    testRanges,
+		Ports:     testPorts,
+	}
+
+	m := newTestMasscan(t, sim, cfg)
+
+	ctx, cancel := context.WithTimeout(t.Context(), 500*time.Millisecond)
+	defer cancel()
+
+	report, err := m.Run(ctx)
+	require.Error(t, err, "expected error when scan is interrupted")
+
+	assert.True(t, report.Partial, "expected interrupted report to be partial")
+	assert.Contains(t, report.Results, "10.0.0.1", "expected interrupted report to include partial results")
+	assert.FileExists(t, filepath.Join(cfg.ResumeDir, "paused.conf"), "expected paused.conf to be kept")
+
+	report, err = m.Run(t.Context())
+	require.NoError(t, err, "no error expected resuming scan")
+
+	assert.False(t, report.Partial, "expected resumed report to be complete")
+	assert.Equal(t, 1, report.ResumedRuns, "expected one resumed run")
+	assert.Contains(t, report.Results, "10.0.0.1", "expected results from the interrupted run")
+	assert.Contains(t, report.Results, "10.0.0.2", "expected results from the resumed run")
+	assert.NoFileExists(t, filepath.Join(cfg.ResumeDir, "paused.conf"), "expected paused.conf to be removed")
+
+	invocations := sim.Invocations(t)
+	require.Len(t, invocations, 2, "expected masscan to be executed twice")
+
+	assert.NotContains(t, invocations[0].Args, "--resume", "expected first run to not resume")
+	assert.Equal(t, "resume-index = 42\n", invocations[1].Files["--resume"], "expected second run to resume from paused.conf")
+	assert.NotContains(t, invocations[1].Args, "10.0.0.0/24", "expected ranges to come from paused.conf when resuming")
+
+	ctx, cancel = context.WithTimeout(t.Context(), 500*time.Millisecond)
+	defer cancel()
+
+	report, err = m.Run(ctx)
+	require.Error(t, err, "expected error when scan is interrupted")
+
+	assert.Equal(t, 0, report.ResumedRuns, "expected a new scan after completion")
+	assert.NotContains(t, sim.Invocations(t)[2].Args, "--resume", "expected a new scan after completion")
+}
+
+func TestMasscan_Run_ResumeConfigChanged(t *testing.T) {
+	t.Parallel()
+
+	sim := masscantest.New(t, masscantest.Scenario{
+		Delay:            time.Minute,
+		PauseOnInterrupt: true,
+	})
+
+	resumeDir := t.TempDir()
+
+	m := newTestMasscan(t, sim, masscan.Config{Resume: true, ResumeDir: resumeDir, Ranges: testRanges, Ports: testPorts})
+
+	ctx, cancel := context.WithTimeout(t.Context(), 500*time.Millisecond)
+	defer cancel()
+
+	_, err := m.Run(ctx)
+	require.Error(t, err, "expected error when scan is interrupted")
+
+	m = newTestMasscan(t, sim, masscan.Config{
+		Resume:    true,
+		ResumeDir: resumeDir,
+		Ranges:    masscan.DynamicValue[[]string]{Value: []string{"10.1.0.0/24"}},
+		Ports:     testPorts,
+	})
+
+	ctx, cancel = context.WithTimeout(t.Context(), 500*time.Millisecond)
+	defer cancel()
+
+	_, err = m.Run(ctx)
+	require.Error(t, err, "expected error when scan is interrupted")
+
+	invocations := sim.Invocations(t)
+	require.Len(t, invocations, 2, "expected masscan to be executed twice")
+
+	assert.NotContains(t, invocations[1].Args, "--resume", "expected scan to not resume when config changed")
+	assert.Contains(t, invocations[1].Args, "10.1.0.0/24", "expected new ranges to be scanned")
+}
+
+func TestMasscan_Run_ErrorReason(t *testing.T) {
+	t.Parallel()
+
+	invalidRanges := filepath.Join(t.TempDir(), "ranges.txt")
+
+	err := os.WriteFile(invalidRanges, []byte("10.0.0.0/24\n10.0.1.0/42\n"), 0644)
+	require.NoError(t, err, "no error expected writing ranges")
+
+	notExecutable := filepath.Join(t.TempDir(), "masscan")
+
+	err = os.WriteFile(notExecutable, nil, 0644)
+	require.NoError(t, err, "no error expected writing binary")
+
+	testCases := []struct {
+		name     string
+		scenario masscantest.Scenario
+		binPath  string
+		launcher []string
+		ranges   masscan.DynamicValue[[]string]
+		expected string
+	}{
+		{
+			name:     "binary not found",
+			binPath:  "/nonexistent/masscan",
+			ranges:   testRanges,
+			expected: masscan.ReasonBinaryNotFound,
+		},
+		{
+			name: "permission denied",
+			scenario: masscantest.Scenario{
+				Stderr:   "FAIL: permission denied\n [hint] need to sudo or run as root or something\n",
+				NoOutput: true,
+				ExitCode: 1,
+			},
+			ranges:   testRanges,
+			expected: masscan.ReasonPermissionDenied,
+		},
+		{
+			name:     "load value",
+			ranges:   masscan.DynamicValue[[]string]{File: "/nonexistent/ranges.txt"},
+			expected: masscan.ReasonLoadValue,
+		},
+		{
+			name:     "invalid target",
+			ranges:   masscan.DynamicValue[[]string]{File: invalidRanges},
+			expected: masscan.ReasonInvalidTarget,
+		},
+		{
+			name: "exit",
+			scenario: masscantest.Scenario{
+				Stderr:   "FAIL: could not determine default interface\n",
+				NoOutput: true,
+				ExitCode: 1,
+			},
+			ranges:   testRanges,
+			expected: masscan.ReasonExit,
+		},
+		{
+			name:     "binary not found by launcher",
+			binPath:  "/nonexistent/masscan",
+			launcher: []string{"env"},
+			ranges:   testRanges,
+			expected: masscan.ReasonBinaryNotFound,
+		},
+		{
+			name:     "binary not executable by launcher",
+			binPath:  notExecutable,
+			launcher: []string{"env"},
+			ranges:   testRanges,
+			expected: masscan.ReasonPermissionDenied,
+		},
+		{
+			name:     "killed",
+			launcher: []string{"sh", "-c", "kill -KILL $$"},
+			ranges:   testRanges,
+			expected: masscan.ReasonKilled,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			sim := masscantest.New(t, tc.scenario)
+
+			cfg := masscan.Config{
+				BinPath:  tc.binPath,
+				Launcher: tc.launcher,
+				TempDir:  t.TempDir(),
+				Ranges:   tc.ranges,
+				Ports:    testPorts,
+			}
+
+			if cfg.BinPath == "" {
+				cfg.BinPath = sim.Path()
+			}
+
+			m, err := masscan.New(t.Context(), masscan.WithConfig(cfg))
+			require.NoError(t, err, "no error expected creating masscan")
+
+			_, err = m.Run(t.Context())
+			require.Error(t, err, "expected error running masscan")
+
+			assert.Equal(t, tc.expected, masscan.ErrorReason(err), "unexpected error reason")
+		})
+	}
+}
@@ -0,0 +1,385 @@
+// Package masscantest provides a fake masscan executable for tests.
+//
+// The fake is the test binary itself. Test packages using the simulator must
+// call Main from their TestMain, which runs the fake instead of the tests when
+// the test binary is executed through a Simulator's Path.
+//
+//	func TestMain(m *testing.M) {
+//		masscantest.Main(m)
+//	}
+package masscantest
+
+import (
+	"bufio"
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/mikemrm/masscan-exporter/internal/masscan"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	binName        = "masscan"
+	defaultVersion = "1.3.2"
+	scenarioSuffix = ".scenario.json"
+	argsSuffix     = ".args.jsonl"
+)
+
+// fileFlags are flags whose file contents are recorded with each invocation.
+var fileFlags = []string{"-c", "--excludefile", "--resume"}
+
+// Scenario configures how the fake masscan behaves when executed.
+type Scenario struct {
+	// Results are written to the output file as a json array.
+	Results []masscan.RawResult `json:"results"`
+	// RawOutput, if set, is written to the output file instead of Results.
+	RawOutput string `json:"raw_output"`
+	// NoOutput skips writing the output file.
+	NoOutput bool `json:"no_output"`
+
+	// Status lines are written to stderr before the final status line.
+	Status []string `json:"status"`
+	// StatusInterval is the delay between each status line.
+	StatusInterval time.Duration `json:"status_interval"`
+	// FinalStatus replaces the final status line which reports the number of ports found.
+	FinalStatus *string `json:"final_status"`
+
+	// Stdout and Stderr are written before any status lines.
+	Stdout string `json:"stdout"`
+	Stderr string `json:"stderr"`
+
+	// Delay is how long to wait before writing results and exiting.
+	Delay time.Duration `json:"delay"`
+	// IgnoreInterrupt ignores SIGINT and SIGTERM, requiring the process to be killed.
+	IgnoreInterrupt bool `json:"ignore_interrupt"`
+	// ExitCode is the exit code of the process.
+	ExitCode int `json:"exit_code"`
+
+	// PauseOnInterrupt writes PartialResults and a paused.conf to the working directory when interrupted,
+	// mimicking masscan's behavior when it receives SIGINT.
+	PauseOnInterrupt bool                `json:"pause_on_interrupt"`
+	PartialResults   []masscan.RawResult `json:"partial_results"`
+
+	// Resumed overrides the scenario for an invocation with --resume.
+	Resumed *Scenario `json:"resumed"`
+
+	// Shards overrides the scenario for an invocation with --shard, keyed by shard number.
+	Shards map[int]Scenario `json:"shards"`
+
+	// Version is reported with --version, defaults to defaultVersion.
+	Version string `json:"version"`
+	// SelftestExitCode is the exit code of an invocation with --selftest.
+	SelftestExitCode int `json:"selftest_exit_code"`
+}
+
+// Invocation is a single execution of the simulator.
+type Invocation struct {
+	Args []string `json:"args"`
+	// Files contains the contents of files passed with flags such as -c and --excludefile, keyed by flag.
+	Files map[string]string `json:"files"`
+	// Modes contains the permissions of the files passed with flags, including --output-filename, keyed by flag.
+	Modes map[string]os.FileMode `json:"modes"`
+	// Dir is the working directory masscan was executed in.
+	Dir string `json:"dir"`
+}
+
+// Simulator is a fake masscan executable configured with a Scenario.
+type Simulator struct {
+	path string
+}
+
+// Path returns the path to the fake masscan executable, to be used as masscan.Config.BinPath.
+func (s *Simulator) Path() string {
+	return s.path
+}
+
+// Invocations returns each execution of the simulator.
+func (s *Simulator) Invocations(t testing.TB) []Invocation {
+	t.Helper()
+
+	f, err := os.Open(s.path + argsSuffix)
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	require.NoError(t, err, "no error expected opening simulator args")
+
+	defer f.Close()
+
+	var invocations []Invocation
+
+	scanner := bufio.NewScanner(f)
+
+	for scanner.Scan() {
+		var invocation Invocation
+
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &invocation), "no error expected decoding simulator invocation")
+
+		invocations = append(invocations, invocation)
+	}
+
+	require.NoError(t, scanner.Err(), "no error expected reading simulator args")
+
+	return invocations
+}
+
+// New creates a new simulator in a temporary directory for the provided scenario.
+func New(t testing.TB, scenario Scenario) *Simulator {
+	t.Helper()
+
+	exe, err := os.Executable()
+	require.NoError(t, err, "no error expected getting test executable")
+
+	path := filepath.Join(t.TempDir(), binName)
+
+	require.NoError(t, os.Symlink(exe, path), "no error expected linking simulator")
+
+	data, err := json.Marshal(scenario)
+	require.NoError(t, err, "no error expected encoding scenario")
+
+	require.NoError(t, os.WriteFile(path+scenarioSuffix, data, 0600), "no error expected writing scenario")
+
+	return &Simulator{
+		path: path,
+	}
+}
+
+// Main runs the fake masscan when executed by a simulator, otherwise it runs the tests.
+func Main(m *testing.M) {
+	if _, err := os.Stat(os.Args[0] + scenarioSuffix); err == nil {
+		os.Exit(run(os.Args[0], os.Args[1:]))
+	}
+
+	os.Exit(m.Run())
+}
+
+func run(path string, args []string) int {
+	data, err := os.ReadFile(path + scenarioSuffix)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "FAIL: reading scenario: %s\n", err)
+
+		return 1
+	}
+
+	var scenario Scenario
+
+	if err := json.Unmarshal(data, &scenario); err != nil {
+		fmt.Fprintf(os.Stderr, "FAIL: decoding scenario: %s\n", err)
+
+		return 1
+	}
+
+	if shard, _, ok := strings.Cut(argValue(args, "--shard"), "/"); ok {
+		n, _ := strconv.Atoi(shard)
+
+		if shardScenario, ok := scenario.Shards[n]; ok {
+			scenario = shardScenario
+		}
+	}
+
+	if scenario.Resumed != nil && argValue(args, "--resume") != "" {
+		scenario = *scenario.Resumed
+	}
+
+	if err := recordArgs(path, args); err != nil {
+		fmt.Fprintf(os.Stderr, "FAIL: recording args: %s\n", err)
+
+		return 1
+	}
+
+	switch {
+	case slices.Contains(args, "--version"):
+		fmt.Fprintf(os.Stdout, "\nMasscan version %s ( https://github.com/robertdavidgraham/masscan )\n", cmp.Or(scenario.Version, defaultVersion))
+
+		return 0
+	case slices.Contains(args, "--selftest"):
+		if scenario.SelftestExitCode != 0 {
+			fmt.Fprint(os.Stderr, "selftest: failed\n")
+		} else {
+			fmt.Fprint(os.Stdout, "selftest: success!\n")
+		}
+
+		return scenario.SelftestExitCode
+	}
+
+	if scenario.IgnoreInterrupt {
+		signal.Ignore(syscall.SIGINT, syscall.SIGTERM)
+	}
+
+	interrupted := make(chan os.Signal, 1)
+
+	if scenario.PauseOnInterrupt {
+		signal.Notify(interrupted, syscall.SIGINT)
+	}
+
+	fmt.Fprint(os.Stdout, scenario.Stdout)
+	fmt.Fprint(os.Stderr, scenario.Stderr)
+
+	for _, line := range scenario.Status {
+		fmt.Fprint(os.Stderr, line+"\r")
+
+		time.Sleep(scenario.StatusInterval)
+	}
+
+	select {
+	case <-time.After(scenario.Delay):
+	case <-interrupted:
+		return pause(args, scenario)
+	}
+
+	var found int
+
+	for _, result := range scenario.Results {
+		found += len(result.Ports)
+	}
+
+	if !scenario.NoOutput {
+		if output := argValue(args, "--output-filename"); output != "" {
+			if err := writeOutput(output, scenario); err != nil {
+				fmt.Fprintf(os.Stderr, "FAIL: writing output: %s\n", err)
+
+				return 1
+			}
+		}
+	}
+
+	if scenario.FinalStatus != nil {
+		fmt.Fprint(os.Stderr, *scenario.FinalStatus)
+	} else {
+		fmt.Fprintf(os.Stderr, "rate:  0.00-kpps, 100.00%% done, waiting -1-secs, found=%d       \r\n", found)
+	}
+
+	return scenario.ExitCode
+}
+
+func pause(args []string, scenario Scenario) int {
+	if output := argValue(args, "--output-filename"); output != "" {
+		if err := writeOutput(output, Scenario{Results: scenario.PartialResults}); err != nil {
+			fmt.Fprintf(os.Stderr, "FAIL: writing output: %s\n", err)
+
+			return 1
+		}
+	}
+
+	if err := os.WriteFile("paused.conf", []byte("resume-index = 42\n"), 0600); err != nil {
+		fmt.Fprintf(os.Stderr, "FAIL: writing paused.conf: %s\n", err)
+
+		return 1
+	}
+
+	fmt.Fprint(os.Stderr, "\nwaiting several seconds to exit...\n")
+
+	return 0
+}
+
+func recordArgs(path string, args []string) error {
+	invocation := Invocation{
+		Args:  args,
+		Files: make(map[string]string),
+		Modes: make(map[string]os.FileMode),
+	}
+
+	var err error
+
+	if invocation.Dir, err = os.Getwd(); err != nil {
+		return err
+	}
+
+	for _, flag := range fileFlags {
+		if file := argValue(args, flag); file != "" {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				return err
+			}
+
+			invocation.Files[flag] = string(data)
+		}
+	}
+
+	for _, flag := range append(slices.Clone(fileFlags), "--output-filename") {
+		if file := argValue(args, flag); file != "" {
+			info, err := os.Stat(file)
+			if err != nil {
+				return err
+			}
+
+			invocation.Modes[flag] = info.Mode().Perm()
+		}
+	}
+
+	line, err := json.Marshal(invocation)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(path+argsSuffix, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+
+		return err
+	}
+
+	return f.Close()
+}
+
+func writeOutput(path string, scenario Scenario) error {
+	if scenario.RawOutput != "" {
+		return os.WriteFile(path, []byte(scenario.RawOutput), 0600)
+	}
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	w := bufio.NewWriter(f)
+
+	w.WriteString("[\n")
+
+	for _, result := range scenario.Results {
+		line, err := json.Marshal(result)
+		if err != nil {
+			f.Close()
+
+			return err
+		}
+
+		w.Write(line)
+		w.WriteString(",\n")
+	}
+
+	w.WriteString("]\n")
+
+	if err := w.Flush(); err != nil {
+		f.Close()
+
+		return err
+	}
+
+	return f.Close()
+}
+
+// argValue returns the value following the named flag.
+func argValue(args []string, name string) string {
+	for i, arg := range args {
+		if arg == name && i+1 < len(args) {
+			return args[i+1]
+		}
+	}
+
+	return ""
+}
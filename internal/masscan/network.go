@@ -0,0 +1,295 @@
+package masscan
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrInvalidOption  = errors.New("invalid option")
+	ErrConfigConflict = errors.New("option conflicts with masscan config")
+)
+
+// networkOption maps a typed Config field to its masscan argument.
+type networkOption struct {
+	// name is the config key of the option.
+	name string
+
+	// flag is the masscan argument, it is also the key used in masscan config files.
+	flag string
+
+	// aliases are alternate keys masscan accepts in config files.
+	aliases []string
+
+	// value returns the argument value and if the option is set.
+	// Options which are flags only return an empty value.
+	value func(Config) (string, bool)
+}
+
+var networkOptions = []networkOption{
+	{
+		name: "adapter",
+		flag: "--adapter",
+		value: func(c Config) (string, bool) {
+			return c.Adapter, c.Adapter != ""
+		},
+	},
+	{
+		name: "adapter_ip",
+		flag: "--adapter-ip",
+		value: func(c Config) (string, bool) {
+			return c.AdapterIP, c.AdapterIP != ""
+		},
+	},
+	{
+		name: "adapter_mac",
+		flag: "--adapter-mac",
+		value: func(c Config) (string, bool) {
+			return c.AdapterMAC, c.AdapterMAC != ""
+		},
+	},
+	{
+		name: "router_mac",
+		flag: "--router-mac",
+		value: func(c Config) (string, bool) {
+			return c.RouterMAC, c.RouterMAC != ""
+		},
+	},
+	{
+		name: "source_ip",
+		flag: "--source-ip",
+		value: func(c Config) (string, bool) {
+			return c.SourceIP, c.SourceIP != ""
+		},
+	},
+	{
+		name: "source_port",
+		flag: "--source-port",
+		value: func(c Config) (string, bool) {
+			return c.SourcePort, c.SourcePort != ""
+		},
+	},
+	{
+		name:    "retries",
+		flag:    "--retries",
+		aliases: []string{"max-retries"},
+		value: func(c Config) (string, bool) {
+			return strconv.Itoa(c.Retries), c.Retries != 0
+		},
+	},
+	{
+		name: "wait",
+		flag: "--wait",
+		value: func(c Config) (string, bool) {
+			if c.Wait == nil {
+				return "", false
+			}
+
+			// masscan only supports whole seconds.
+			return strconv.Itoa(int(math.Ceil(c.Wait.Seconds()))), true
+		},
+	},
+	{
+		name: "ttl",
+		flag: "--ttl",
+		value: func(c Config) (string, bool) {
+			return strconv.Itoa(c.TTL), c.TTL != 0
+		},
+	},
+	{
+		name: "randomize_hosts",
+		flag: "--randomize-hosts",
+		value: func(c Config) (string, bool) {
+			return "", c.RandomizeHosts
+		},
+	},
+	{
+		name: "seed",
+		flag: "--seed",
+		value: func(c Config) (string, bool) {
+			if c.Seed == nil {
+				return "", false
+			}
+
+			return strconv.FormatInt(*c.Seed, 10), true
+		},
+	},
+	{
+		name:    "packet_trace",
+		flag:    "--packet-trace",
+		aliases: []string{"trace-packet"},
+		value: func(c Config) (string, bool) {
+			return "", c.PacketTrace
+		},
+	},
+}
+
+// networkArgs returns the masscan arguments for the typed network options.
+func (c Config) networkArgs() []string {
+	var args []string
+
+	for _, opt := range networkOptions {
+		value, ok := opt.value(c)
+		if !ok {
+			continue
+		}
+
+		args = append(args, opt.flag)
+
+		if value != "" {
+			args = append(args, value)
+		}
+	}
+
+	return args
+}
+
+// validateNetwork validates the typed network options.
+func (c Config) validateNetwork() error {
+	if c.AdapterIP != "" {
+		if _, err := parseRange(c.AdapterIP); err != nil {
+			return fmt.Errorf("%w adapter_ip: %w", ErrInvalidOption, err)
+		}
+	}
+
+	if c.SourceIP != "" {
+		if _, err := parseRange(c.SourceIP); err != nil {
+			return fmt.Errorf("%w source_ip: %w", ErrInvalidOption, err)
+		}
+	}
+
+	if c.AdapterMAC != "" {
+		if _, err := net.ParseMAC(c.AdapterMAC); err != nil {
+			return fmt.Errorf("%w adapter_mac '%s': %w", ErrInvalidOption, c.AdapterMAC, err)
+		}
+	}
+
+	if c.RouterMAC != "" {
+		if _, err := net.ParseMAC(c.RouterMAC); err != nil {
+			return fmt.Errorf("%w router_mac '%s': %w", ErrInvalidOption, c.RouterMAC, err)
+		}
+	}
+
+	if c.SourcePort != "" {
+		// Source ports are sent with every protocol, so they may not be prefixed with one.
+		if strings.Contains(c.SourcePort, ":") {
+			return fmt.Errorf("%w source_port '%s': must not have a protocol prefix", ErrInvalidOption, c.SourcePort)
+		}
+
+		r, err := parsePort(c.SourcePort)
+		if err != nil {
+			return fmt.Errorf("%w source_port: %w", ErrInvalidOption, err)
+		}
+
+		if r.From == 0 {
+			return fmt.Errorf("%w source_port '%s': port must be between 1 and 65535", ErrInvalidOption, c.SourcePort)
+		}
+	}
+
+	if c.Retries < 0 {
+		return fmt.Errorf("%w retries: must not be negative", ErrInvalidOption)
+	}
+
+	if c.Wait != nil && *c.Wait < 0 {
+		return fmt.Errorf("%w wait: must not be negative", ErrInvalidOption)
+	}
+
+	if c.TTL < 0 || c.TTL > 255 {
+		return fmt.Errorf("%w ttl: must be between 1 and 255, or 0 for masscan's default", ErrInvalidOption)
+	}
+
+	// Each shard's adapter is passed after the shared arguments, so it can not also be set for all shards.
+	if c.Adapter != "" {
+		for i, opts := range c.ShardOptions {
+			if opts.Adapter != "" {
+				return fmt.Errorf("%w shard_options[%d].adapter: conflicts with adapter '%s'", ErrInvalidOption, i, c.Adapter)
+			}
+		}
+	}
+
+	return nil
+}
+
+// checkConfigConflicts returns an error if the masscan config sets an option which is also set by a typed field.
+// source describes where the config was loaded from.
+func (c Config) checkConfigConflicts(source, config string) error {
+	keys := configKeys(config)
+
+	for _, opt := range networkOptions {
+		if _, ok := opt.value(c); !ok {
+			continue
+		}
+
+		names := append([]string{strings.TrimPrefix(opt.flag, "--")}, opt.aliases...)
+
+		for _, name := range names {
+			if keys[name] {
+				return fmt.Errorf("%w: %s is set in %s and as '%s'", ErrConfigConflict, opt.name, source, name)
+			}
+		}
+	}
+
+	return nil
+}
+
+// checkStaticConfigConflicts checks for conflicts with the masscan config when it is known before running.
+// Configs loaded from other sources are checked when they are loaded at run time.
+func (c Config) checkStaticConfigConflicts() error {
+	if c.ConfigPath != "" {
+		// A missing config is reported by masscan when it runs.
+		data, err := os.ReadFile(c.ConfigPath)
+		if err != nil {
+			return nil
+		}
+
+		return c.checkConfigConflicts("config_path", string(data))
+	}
+
+	if c.Config.static() && c.Config.Value != "" {
+		return c.checkConfigConflicts("config", c.Config.Value)
+	}
+
+	return nil
+}
+
+// configKeys returns the keys set in a masscan config file.
+func configKeys(config string) map[string]bool {
+	keys := make(map[string]bool)
+
+	for key := range configValues(config) {
+		keys[key] = true
+	}
+
+	return keys
+}
+
+// configValues returns the value of each key set in a masscan config file.
+// Keys are normalized to lower case with dashes, as masscan accepts either.
+func configValues(config string) map[string]string {
+	values := make(map[string]string)
+
+	scanner := bufio.NewScanner(strings.NewReader(config))
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		key, value, _ := strings.Cut(line, "=")
+
+		key = strings.ToLower(strings.TrimSpace(key))
+		key = strings.ReplaceAll(key, "_", "-")
+
+		values[key] = strings.TrimSpace(value)
+	}
+
+	return values
+}
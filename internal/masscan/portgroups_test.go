@@ -0,0 +1,140 @@
+package masscan
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuiltinPortGroups(t *testing.T) {
+	t.Parallel()
+
+	require.NoError(t, PortGroups(nil).Validate(), "no error expected for built-in groups")
+
+	for name, count := range map[string]int{"top-100": 100, "top-1000": 1000} {
+		ports, err := ParsePorts(BuiltinPortGroups[name])
+		require.NoError(t, err, "no error expected parsing %s", name)
+
+		total := 0
+
+		for _, r := range ports {
+			assert.Equal(t, ProtoTCP, r.Proto, "expected %s to only contain tcp ports", name)
+
+			total += r.Count()
+		}
+
+		assert.Equal(t, count, total, "unexpected number of ports in %s", name)
+	}
+
+	for name, ports := range BuiltinPortGroups {
+		_, err := ParsePorts(ports)
+		require.NoError(t, err, "no error expected parsing %s", name)
+	}
+}
+
+func TestPortGroups_Expand(t *testing.T) {
+	t.Parallel()
+
+	groups := PortGroups{
+		"web":      {"8081"},
+		"internal": {"@web", "9090,U:161"},
+		"top-3":    {"22,80,443"},
+	}
+
+	testCases := []struct {
+		name         string
+		ports        []string
+		expect       []string
+		expectGroups map[string][]string
+		expectError  error
+	}{
+		{
+			"no groups",
+			[]string{"80", "443,8443"},
+			[]string{"80", "443", "8443"},
+			nil,
+			nil,
+		},
+		{
+			"configured group replaces built-in",
+			[]string{"22", "@web"},
+			[]string{"22", "8081"},
+			map[string][]string{"web": {"8081"}},
+			nil,
+		},
+		{
+			"nested groups",
+			[]string{"@Internal"},
+			[]string{"8081", "9090", "U:161"},
+			map[string][]string{"internal": {"8081", "9090", "U:161"}},
+			nil,
+		},
+		{
+			"top ports",
+			[]string{"top:3,8080"},
+			[]string{"22", "80", "443", "8080"},
+			map[string][]string{"top-3": {"22", "80", "443"}},
+			nil,
+		},
+		{
+			"built-in group",
+			[]string{"@remote-admin"},
+			[]string{"22-23", "512-514", "623", "2222", "3389", "5800", "5900-5903", "5985-5986", "10000"},
+			map[string][]string{"remote-admin": {"22-23", "512-514", "623", "2222", "3389", "5800", "5900-5903", "5985-5986", "10000"}},
+			nil,
+		},
+		{
+			"unknown group",
+			[]string{"@missing"},
+			nil,
+			nil,
+			ErrUnknownPortGroup,
+		},
+		{
+			"unknown top ports",
+			[]string{"top:5"},
+			nil,
+			nil,
+			ErrUnknownPortGroup,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ports, used, err := groups.Expand(tc.ports)
+
+			if tc.expectError != nil {
+				require.ErrorIs(t, err, tc.expectError, "expected error expanding ports")
+
+				return
+			}
+
+			require.NoError(t, err, "no error expected expanding ports")
+
+			assert.Equal(t, tc.expect, ports, "unexpected expanded ports")
+			assert.Equal(t, tc.expectGroups, used, "unexpected groups")
+		})
+	}
+}
+
+func TestPortGroups_Validate(t *testing.T) {
+	t.Parallel()
+
+	require.NoError(t, PortGroups{"web": {"80", "@databases"}}.Validate(), "no error expected for valid groups")
+
+	err := PortGroups{"a": {"@b"}, "b": {"@a"}}.Validate()
+	require.ErrorIs(t, err, ErrPortGroupCycle, "expected cycle error")
+
+	assert.Equal(t, ReasonInvalidConfig, ErrorReason(err), "unexpected error reason")
+
+	err = PortGroups{"web": {"@missing"}}.Validate()
+	require.ErrorIs(t, err, ErrUnknownPortGroup, "expected unknown group error")
+
+	assert.Equal(t, ReasonInvalidConfig, ErrorReason(err), "unexpected error reason")
+
+	require.ErrorIs(t, PortGroups{"web": {"http"}}.Validate(), ErrInvalidPort, "expected invalid port error")
+	require.ErrorIs(t, PortGroups{"web,db": {"80"}}.Validate(), ErrInvalidPortGroups, "expected invalid name error")
+}
@@ -0,0 +1,154 @@
+package masscan
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+var (
+	ErrUnknownVersion = errors.New("unable to determine masscan version")
+	ErrSelftest       = errors.New("masscan selftest failed")
+)
+
+const (
+	// DefaultProbeTimeout limits each command run while probing masscan.
+	DefaultProbeTimeout = 30 * time.Second
+
+	// probeTarget is within TEST-NET-1 (RFC 5737), which is reserved for documentation,
+	// so the packet check never reaches a real host.
+	probeTarget = "192.0.2.1"
+	probePort   = "9"
+)
+
+// versionPattern matches the version masscan reports with --version, such as:
+// Masscan version 1.3.2 ( https://github.com/robertdavidgraham/masscan )
+var versionPattern = regexp.MustCompile(`(?i)masscan version (\S+)`)
+
+// ProbeConfig configures how masscan binaries are probed on start.
+type ProbeConfig struct {
+	// Disabled skips probing masscan entirely.
+	Disabled bool `mapstructure:"disabled"`
+	// SkipSelftest skips running masscan's selftest.
+	SkipSelftest bool `mapstructure:"skip_selftest"`
+	// SkipPacketCheck skips sending a single packet to check masscan is able to open a raw socket.
+	SkipPacketCheck bool `mapstructure:"skip_packet_check"`
+	// Timeout limits each command run while probing, defaults to DefaultProbeTimeout.
+	Timeout time.Duration `mapstructure:"timeout"`
+}
+
+// Capabilities describes a probed masscan binary.
+type Capabilities struct {
+	BinPath  string
+	Launcher []string
+	Version  string
+
+	// PacketChecked reports if a packet check was attempted.
+	PacketChecked bool
+	// PacketErr is why masscan was unable to send a packet, nil if the packet check succeeded or was skipped.
+	PacketErr error
+}
+
+// Command returns the launcher and binary which were probed.
+func (c Capabilities) Command() string {
+	return strings.Join(append(slices.Clone(c.Launcher), c.BinPath), " ")
+}
+
+// Probe checks the masscan binary run by the config's BinPath and Launcher is usable, returning its version and capabilities.
+//
+// An error is returned if the binary does not exist, cannot be executed, fails its selftest or lacks
+// permission to open a raw socket. Any other failure to send a packet is reported by Capabilities.PacketErr,
+// as it may be caused by network options which are only set for scans, such as the adapter.
+func Probe(ctx context.Context, masscanCfg Config, cfg ProbeConfig) (Capabilities, error) {
+	logger := zerolog.Ctx(ctx)
+
+	if masscanCfg.BinPath == "" {
+		masscanCfg.BinPath = DefaultBinPath
+	}
+
+	binPath := masscanCfg.BinPath
+
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultProbeTimeout
+	}
+
+	caps := Capabilities{
+		BinPath:  binPath,
+		Launcher: masscanCfg.Launcher,
+	}
+
+	// Some builds of masscan exit with an error after printing their version, so the output is checked first.
+	out, err := probeCommand(ctx, cfg.Timeout, masscanCfg, "--version")
+
+	match := versionPattern.FindStringSubmatch(out)
+	if match == nil {
+		if err != nil {
+			return caps, err
+		}
+
+		return caps, fmt.Errorf("%w: %s: %s", ErrUnknownVersion, binPath, strings.TrimSpace(out))
+	}
+
+	caps.Version = match[1]
+
+	logger.Debug().Str("bin_path", binPath).Str("version", caps.Version).Msg("masscan version detected")
+
+	if !cfg.SkipSelftest {
+		if _, err := probeCommand(ctx, cfg.Timeout, masscanCfg, "--selftest"); err != nil {
+			return caps, fmt.Errorf("%w: %w", ErrSelftest, err)
+		}
+	}
+
+	if !cfg.SkipPacketCheck {
+		caps.PacketChecked = true
+
+		_, err := probeCommand(ctx, cfg.Timeout, masscanCfg, probeTarget, "-p", probePort, "--max-rate", "1", "--wait", "0")
+
+		switch {
+		case errors.Is(err, ErrPermissionDenied), ctx.Err() != nil:
+			return caps, err
+		case err != nil:
+			caps.PacketErr = err
+		}
+	}
+
+	return caps, nil
+}
+
+// probeCommand runs masscan with the provided args, returning its combined output.
+func probeCommand(ctx context.Context, timeout time.Duration, masscanCfg Config, args ...string) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	output := &tailBuffer{max: outputTailSize}
+
+	status := &statusWriter{
+		w: output,
+	}
+
+	cmd := masscanCfg.execCommand(ctx, args)
+	cmd.Stdout = status
+	cmd.Stderr = status
+
+	err := cmd.Run()
+
+	status.flush()
+
+	out := output.String()
+
+	if err == nil && len(status.fatal) != 0 {
+		err = errFatalOutput
+	}
+
+	if err != nil {
+		return out, classifyRunError(ctx, fmt.Errorf("failed to run %s: %w: %s", strings.Join(append(masscanCfg.command(), args...), " "), err, status.failure(out)), out)
+	}
+
+	return out, nil
+}
@@ -0,0 +1,100 @@
+package masscan_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/mikemrm/masscan-exporter/internal/masscan"
+	"github.com/mikemrm/masscan-exporter/internal/masscan/masscantest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProbe(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name     string
+		scenario masscantest.Scenario
+		config   masscan.ProbeConfig
+
+		expectVersion     string
+		expectErr         error
+		expectPacketErr   error
+		expectInvocations int
+	}{
+		{
+			name:              "usable",
+			scenario:          masscantest.Scenario{Version: "1.3.9"},
+			expectVersion:     "1.3.9",
+			expectInvocations: 3,
+		},
+		{
+			name:              "skip checks",
+			scenario:          masscantest.Scenario{Stderr: "FAIL: permission denied\n", ExitCode: 1},
+			config:            masscan.ProbeConfig{SkipSelftest: true, SkipPacketCheck: true},
+			expectVersion:     "1.3.2",
+			expectInvocations: 1,
+		},
+		{
+			name:              "selftest failure",
+			scenario:          masscantest.Scenario{SelftestExitCode: 1},
+			expectVersion:     "1.3.2",
+			expectErr:         masscan.ErrSelftest,
+			expectInvocations: 2,
+		},
+		{
+			name:              "permission denied",
+			scenario:          masscantest.Scenario{Stderr: "FAIL: permission denied\n", ExitCode: 1},
+			expectVersion:     "1.3.2",
+			expectErr:         masscan.ErrPermissionDenied,
+			expectInvocations: 3,
+		},
+		{
+			name:              "packet check failure",
+			scenario:          masscantest.Scenario{Stderr: "FAIL: could not determine default interface\n", ExitCode: 1},
+			expectVersion:     "1.3.2",
+			expectPacketErr:   masscan.ErrExit,
+			expectInvocations: 3,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			sim := masscantest.New(t, tc.scenario)
+
+			caps, err := masscan.Probe(context.Background(), masscan.Config{BinPath: sim.Path()}, tc.config)
+
+			if tc.expectErr != nil {
+				require.ErrorIs(t, err, tc.expectErr, "unexpected error probing masscan")
+			} else {
+				require.NoError(t, err, "no error expected probing masscan")
+			}
+
+			assert.Equal(t, sim.Path(), caps.BinPath, "unexpected bin path")
+			assert.Equal(t, tc.expectVersion, caps.Version, "unexpected version")
+
+			if tc.expectPacketErr != nil {
+				assert.ErrorIs(t, caps.PacketErr, tc.expectPacketErr, "unexpected packet check error")
+			} else {
+				assert.NoError(t, caps.PacketErr, "no packet check error expected")
+			}
+
+			invocations := sim.Invocations(t)
+
+			require.Len(t, invocations, tc.expectInvocations, "unexpected number of invocations")
+			assert.Equal(t, []string{"--version"}, invocations[0].Args, "version expected to be probed first")
+		})
+	}
+}
+
+func TestProbe_BinaryNotFound(t *testing.T) {
+	t.Parallel()
+
+	_, err := masscan.Probe(context.Background(), masscan.Config{BinPath: filepath.Join(t.TempDir(), "masscan")}, masscan.ProbeConfig{})
+
+	require.ErrorIs(t, err, masscan.ErrBinaryNotFound, "binary not found error expected")
+}
@@ -1,13 +1,108 @@
 package masscan
 
+import (
+	"net/netip"
+	"slices"
+)
+
 type Report struct {
-	Ranges  []string `json:"ranges"`
-	Ports   []string `json:"ports"`
-	MaxRate int      `json:"max_rate"`
+	Ranges   []string `json:"ranges"`
+	Ports    []string `json:"ports"`
+	Excludes []string `json:"excludes"`
+	MaxRate  int      `json:"max_rate"`
+
+	// PortGroups contains the expanded ports of each port group referenced within Ports.
+	PortGroups map[string][]string `json:"port_groups,omitempty"`
+
+	// Targets is the normalized set of ranges, excludes and ports which were scanned.
+	// Targets set only in a masscan config are not included.
+	Targets Targets `json:"targets"`
+
+	// AddressCount is the number of addresses in Targets, excluding any excluded addresses.
+	AddressCount uint64 `json:"address_count"`
+
+	// Vantage is the name of the agent which ran the scan, empty for local scans.
+	Vantage string `json:"vantage,omitempty"`
+
+	// Hostnames maps the ips resolved from hostnames within the ranges to their hostnames.
+	Hostnames Hostnames `json:"hostnames,omitempty"`
+
+	Results map[string]Results `json:"results"`
+	Partial bool               `json:"partial"`
+
+	// ResumedRuns is the number of previously interrupted runs whose results are included in the report.
+	ResumedRuns int `json:"resumed_runs,omitempty"`
+
+	// Stats summarizes the masscan process, combined across shards. It is only set if masscan completed or was interrupted.
+	Stats *RunStats `json:"stats,omitempty"`
+
+	// Shards reports the outcome of each shard when the scan is split across multiple masscan processes.
+	Shards []ShardReport `json:"shards,omitempty"`
+}
+
+// ShardReport is the outcome of a single shard of a scan.
+type ShardReport struct {
+	Shard   int    `json:"shard"`
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+}
+
+// addResult merges the ports of a decoded record into the results for its ip.
+func (r *Report) addResult(entry RawResult) {
+	if len(entry.Ports) == 0 {
+		return
+	}
+
+	if r.Results == nil {
+		r.Results = make(map[string]Results)
+	}
+
+	ip := CanonicalIP(entry.IP)
+
+	result, ok := r.Results[ip]
+	if !ok {
+		result.IP = ip
+	}
+
+	for _, raw := range entry.Ports {
+		port := raw.Port
+
+		if raw.Service != nil {
+			port.Services = []Service{*raw.Service}
+		}
+
+		result.Ports = result.Ports.merge(port)
+	}
+
+	r.Results[ip] = result
+}
+
+// merge adds the results of another report into the report.
+func (r *Report) merge(other Report) {
+	for ip, results := range other.Results {
+		if r.Results == nil {
+			r.Results = make(map[string]Results, len(other.Results))
+		}
+
+		ip = CanonicalIP(ip)
+
+		result, ok := r.Results[ip]
+		if !ok {
+			result.IP = ip
+		}
 
-	Results    map[string]Results `json:"results"`
-	RawResults RawResults         `json:"raw_results"`
-	Partial    bool               `json:"partial"`
+		for _, port := range results.Ports {
+			result.Ports = result.Ports.merge(port)
+		}
+
+		r.Results[ip] = result
+	}
+
+	for ip, names := range other.Hostnames {
+		for _, name := range names {
+			r.Hostnames.add(ip, name)
+		}
+	}
 }
 
 type Results struct {
@@ -15,20 +110,94 @@ type Results struct {
 	Ports Ports  `json:"ports"`
 }
 
-type RawResults []RawResult
-
 type RawResult struct {
-	IP        string `json:"ip"`
-	Timestamp string `json:"timestamp"`
-	Ports     Ports  `json:"ports"`
+	IP        string    `json:"ip"`
+	Timestamp string    `json:"timestamp"`
+	Ports     []RawPort `json:"ports"`
+}
+
+// RawPort is a port entry as written by masscan.
+// When grabbing banners, masscan writes an additional entry for each service detected,
+// which only includes the port, proto and service.
+type RawPort struct {
+	Port
+
+	Service *Service `json:"service,omitempty"`
 }
 
 type Ports []Port
 
+// merge adds the port to the list, combining it with an existing entry for the same port and protocol.
+func (p Ports) merge(port Port) Ports {
+	i := slices.IndexFunc(p, func(existing Port) bool {
+		return existing.Port == port.Port && existing.Proto == port.Proto
+	})
+
+	if i == -1 {
+		p = append(p, Port{
+			Port:  port.Port,
+			Proto: port.Proto,
+		})
+
+		i = len(p) - 1
+	}
+
+	existing := &p[i]
+
+	if port.Status != "" {
+		existing.Status = port.Status
+		existing.Reason = port.Reason
+		existing.TTL = port.TTL
+	}
+
+	existing.Services = append(existing.Services, port.Services...)
+
+	return p
+}
+
 type Port struct {
 	Port   int    `json:"port"`
 	Proto  string `json:"proto"`
 	Status string `json:"status"`
 	Reason string `json:"reason"`
 	TTL    int    `json:"ttl"`
+
+	Services []Service `json:"services,omitempty"`
+}
+
+// Service is a service detected while grabbing banners.
+type Service struct {
+	Name   string `json:"name"`
+	Banner string `json:"banner"`
+}
+
+// Address families returned by IPFamily.
+const (
+	FamilyIPv4 = "ipv4"
+	FamilyIPv6 = "ipv6"
+)
+
+// CanonicalIP returns the canonical form of the ip address, so the same address is always reported the same way.
+// IPv4-mapped IPv6 addresses are returned as IPv4. Values which are not ip addresses are returned unchanged.
+func CanonicalIP(ip string) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ip
+	}
+
+	return addr.Unmap().String()
+}
+
+// IPFamily returns the address family of the ip address, or an empty string if it is not an ip address.
+func IPFamily(ip string) string {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return ""
+	}
+
+	if addr.Unmap().Is4() {
+		return FamilyIPv4
+	}
+
+	return FamilyIPv6
 }
@@ -0,0 +1,291 @@
+package masscan
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+var ErrResolve = errors.New("failed to resolve hostname")
+
+// srvPrefix marks a range as an SRV name, whose targets are resolved and scanned.
+const srvPrefix = "srv:"
+
+// Resolver looks up the addresses of hostnames and the targets of SRV names.
+// It is satisfied by *net.Resolver.
+type Resolver interface {
+	LookupNetIP(ctx context.Context, network, host string) ([]netip.Addr, error)
+	LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+}
+
+// DNSConfig configures how hostnames within ranges are resolved.
+type DNSConfig struct {
+	// Server is the address of the dns server to query, the port defaults to 53.
+	// The system resolver is used when empty.
+	Server string `mapstructure:"server"`
+	// Timeout limits each lookup.
+	Timeout time.Duration `mapstructure:"timeout"`
+	// Network limits the addresses resolved to ip4 or ip6, both are resolved by default.
+	Network string `mapstructure:"network"`
+}
+
+func (c DNSConfig) validate() error {
+	switch c.Network {
+	case "", "ip", "ip4", "ip6":
+	default:
+		return fmt.Errorf("%w: dns network must be ip, ip4 or ip6, got '%s'", ErrInvalidOption, c.Network)
+	}
+
+	if c.Server != "" {
+		if _, err := netip.ParseAddrPort(c.Server); err != nil {
+			if _, err := netip.ParseAddr(c.Server); err != nil {
+				return fmt.Errorf("%w: dns server '%s' must be an ip address with an optional port", ErrInvalidOption, c.Server)
+			}
+		}
+	}
+
+	if c.Timeout < 0 {
+		return fmt.Errorf("%w: dns timeout must not be negative", ErrInvalidOption)
+	}
+
+	return nil
+}
+
+// resolver returns a resolver which queries the configured server.
+func (c DNSConfig) resolver() Resolver {
+	if c.Server == "" {
+		return net.DefaultResolver
+	}
+
+	server := c.Server
+
+	if _, err := netip.ParseAddrPort(server); err != nil {
+		server = net.JoinHostPort(server, "53")
+	}
+
+	var dialer net.Dialer
+
+	return &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, network, server)
+		},
+	}
+}
+
+func (c DNSConfig) network() string {
+	if c.Network == "" {
+		return "ip"
+	}
+
+	return c.Network
+}
+
+// Hostnames maps ips to the hostnames which resolved to them.
+type Hostnames map[string][]string
+
+func (h *Hostnames) add(ip, name string) {
+	if *h == nil {
+		*h = make(Hostnames)
+	}
+
+	ip = CanonicalIP(ip)
+
+	names := (*h)[ip]
+
+	if !slices.Contains(names, name) {
+		names = append(names, name)
+
+		slices.Sort(names)
+	}
+
+	(*h)[ip] = names
+}
+
+// Label returns the comma separated hostnames for the ip, or an empty string if it was not resolved from a hostname.
+func (h Hostnames) Label(ip string) string {
+	return strings.Join(h[CanonicalIP(ip)], ",")
+}
+
+// ResolveRanges replaces any hostnames or srv: prefixed SRV names within the ranges with the addresses
+// they resolve to, returning the resolved ranges and the hostnames for each resolved address.
+// Names which do not exist are skipped with a warning, any other lookup failure returns ErrResolve.
+func (c Config) ResolveRanges(ctx context.Context, values []string) ([]string, Hostnames, error) {
+	logger := zerolog.Ctx(ctx)
+
+	var (
+		ranges    []string
+		hostnames Hostnames
+	)
+
+	resolver := c.Resolver
+	if resolver == nil {
+		resolver = c.DNS.resolver()
+	}
+
+	for _, list := range values {
+		for value := range strings.SplitSeq(list, ",") {
+			value = strings.TrimSpace(value)
+
+			name, srv := rangeName(value)
+			if name == "" {
+				ranges = append(ranges, value)
+
+				continue
+			}
+
+			hosts := []string{name}
+
+			if srv {
+				var err error
+
+				hosts, err = c.lookupSRV(ctx, resolver, name)
+				if err != nil {
+					if notFound(err) {
+						logger.Warn().Err(err).Str("name", name).Msg("srv name not found, skipping")
+
+						continue
+					}
+
+					return nil, nil, fmt.Errorf("%w '%s': %w", ErrResolve, name, err)
+				}
+			}
+
+			for _, host := range hosts {
+				addrs, err := c.lookupHost(ctx, resolver, host)
+				if err != nil {
+					if notFound(err) {
+						logger.Warn().Err(err).Str("hostname", host).Msg("hostname not found, skipping")
+
+						continue
+					}
+
+					return nil, nil, fmt.Errorf("%w '%s': %w", ErrResolve, host, err)
+				}
+
+				for _, addr := range addrs {
+					ip := addr.Unmap().WithZone("").String()
+
+					ranges = append(ranges, ip)
+
+					hostnames.add(ip, host)
+				}
+			}
+		}
+	}
+
+	return ranges, hostnames, nil
+}
+
+func (c Config) lookupHost(ctx context.Context, resolver Resolver, host string) ([]netip.Addr, error) {
+	if c.DNS.Timeout > 0 {
+		var cancel context.CancelFunc
+
+		ctx, cancel = context.WithTimeout(ctx, c.DNS.Timeout)
+		defer cancel()
+	}
+
+	return resolver.LookupNetIP(ctx, c.DNS.network(), host)
+}
+
+// lookupSRV returns the target hostnames of the SRV name.
+func (c Config) lookupSRV(ctx context.Context, resolver Resolver, name string) ([]string, error) {
+	if c.DNS.Timeout > 0 {
+		var cancel context.CancelFunc
+
+		ctx, cancel = context.WithTimeout(ctx, c.DNS.Timeout)
+		defer cancel()
+	}
+
+	_, records, err := resolver.LookupSRV(ctx, "", "", name)
+	if err != nil {
+		return nil, err
+	}
+
+	var hosts []string
+
+	for _, record := range records {
+		target := strings.TrimSuffix(record.Target, ".")
+
+		// A target of "." means the service is not available.
+		if target != "" && !slices.Contains(hosts, target) {
+			hosts = append(hosts, target)
+		}
+	}
+
+	return hosts, nil
+}
+
+// rangeName returns the name to resolve if the range is a hostname or SRV name, otherwise an empty string.
+func rangeName(value string) (string, bool) {
+	if len(value) > len(srvPrefix) && strings.EqualFold(value[:len(srvPrefix)], srvPrefix) {
+		return strings.TrimSuffix(strings.TrimSpace(value[len(srvPrefix):]), "."), true
+	}
+
+	if _, err := parseRange(value); err == nil || !isHostname(value) {
+		return "", false
+	}
+
+	return strings.TrimSuffix(value, "."), false
+}
+
+// withoutNames returns the ranges with any hostnames and SRV names removed.
+func withoutNames(values []string) []string {
+	var ranges []string
+
+	for _, list := range values {
+		for value := range strings.SplitSeq(list, ",") {
+			value = strings.TrimSpace(value)
+
+			if name, _ := rangeName(value); name == "" {
+				ranges = append(ranges, value)
+			}
+		}
+	}
+
+	return ranges
+}
+
+// isHostname reports if the value is a valid hostname.
+// The last label must not be numeric, so malformed ip addresses are not treated as hostnames.
+func isHostname(value string) bool {
+	value = strings.TrimSuffix(value, ".")
+
+	if value == "" || len(value) > 253 {
+		return false
+	}
+
+	labels := strings.Split(value, ".")
+
+	for _, label := range labels {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+
+		for _, r := range label {
+			switch {
+			case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_':
+			default:
+				return false
+			}
+		}
+	}
+
+	_, err := strconv.Atoi(labels[len(labels)-1])
+
+	return err != nil
+}
+
+func notFound(err error) bool {
+	var dnsErr *net.DNSError
+
+	return errors.As(err, &dnsErr) && dnsErr.IsNotFound
+}
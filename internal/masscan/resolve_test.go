@@ -0,0 +1,214 @@
+package masscan
+
+import (
+	"context"
+	"net"
+	"net/netip"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubResolver resolves names from static records, unknown names are not found.
+type stubResolver struct {
+	hosts map[string][]netip.Addr
+	srv   map[string][]*net.SRV
+	err   error
+}
+
+func (r stubResolver) LookupNetIP(_ context.Context, network, host string) ([]netip.Addr, error) {
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	addrs, ok := r.hosts[host]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+
+	var filtered []netip.Addr
+
+	for _, addr := range addrs {
+		if network == "ip" || (network == "ip4") == addr.Is4() {
+			filtered = append(filtered, addr)
+		}
+	}
+
+	return filtered, nil
+}
+
+func (r stubResolver) LookupSRV(_ context.Context, _, _, name string) (string, []*net.SRV, error) {
+	if r.err != nil {
+		return "", nil, r.err
+	}
+
+	records, ok := r.srv[name]
+	if !ok {
+		return "", nil, &net.DNSError{Err: "no such host", Name: name, IsNotFound: true}
+	}
+
+	return name, records, nil
+}
+
+func TestConfig_ResolveRanges(t *testing.T) {
+	t.Parallel()
+
+	resolver := stubResolver{
+		hosts: map[string][]netip.Addr{
+			"web.example.com":   {netip.MustParseAddr("10.0.0.5"), netip.MustParseAddr("2001:db8::5")},
+			"www.example.com":   {netip.MustParseAddr("10.0.0.5")},
+			"ldap1.example.com": {netip.MustParseAddr("10.0.1.1")},
+			"ldap2.example.com": {netip.MustParseAddr("10.0.1.2")},
+		},
+		srv: map[string][]*net.SRV{
+			"_ldap._tcp.example.com": {
+				{Target: "ldap1.example.com.", Port: 389},
+				{Target: "ldap2.example.com.", Port: 389},
+				{Target: "ldap1.example.com.", Port: 636},
+			},
+		},
+	}
+
+	testCases := []struct {
+		name            string
+		dns             DNSConfig
+		resolver        Resolver
+		ranges          []string
+		expectRanges    []string
+		expectHostnames Hostnames
+		expectError     error
+	}{
+		{
+			"addresses unchanged",
+			DNSConfig{},
+			resolver,
+			[]string{"10.0.0.0/24", "10.0.1.1-10.0.1.5"},
+			[]string{"10.0.0.0/24", "10.0.1.1-10.0.1.5"},
+			nil,
+			nil,
+		},
+		{
+			"hostnames",
+			DNSConfig{},
+			resolver,
+			[]string{"10.0.2.0/24,web.example.com", "www.example.com."},
+			[]string{"10.0.2.0/24", "10.0.0.5", "2001:db8::5", "10.0.0.5"},
+			Hostnames{"10.0.0.5": {"web.example.com", "www.example.com"}, "2001:db8::5": {"web.example.com"}},
+			nil,
+		},
+		{
+			"network",
+			DNSConfig{Network: "ip4"},
+			resolver,
+			[]string{"web.example.com"},
+			[]string{"10.0.0.5"},
+			Hostnames{"10.0.0.5": {"web.example.com"}},
+			nil,
+		},
+		{
+			"srv",
+			DNSConfig{},
+			resolver,
+			[]string{"SRV:_ldap._tcp.example.com"},
+			[]string{"10.0.1.1", "10.0.1.2"},
+			Hostnames{"10.0.1.1": {"ldap1.example.com"}, "10.0.1.2": {"ldap2.example.com"}},
+			nil,
+		},
+		{
+			"not found skipped",
+			DNSConfig{},
+			resolver,
+			[]string{"missing.example.com", "srv:_missing._tcp.example.com", "10.0.0.1"},
+			[]string{"10.0.0.1"},
+			nil,
+			nil,
+		},
+		{
+			"lookup failure",
+			DNSConfig{},
+			stubResolver{err: &net.DNSError{Err: "server misbehaving", IsTemporary: true}},
+			[]string{"web.example.com"},
+			nil,
+			nil,
+			ErrResolve,
+		},
+		{
+			"invalid ranges left for parsing",
+			DNSConfig{},
+			resolver,
+			[]string{"10.0.0.300", "10.0.0.0/33"},
+			[]string{"10.0.0.300", "10.0.0.0/33"},
+			nil,
+			nil,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			cfg := Config{DNS: tc.dns, Resolver: tc.resolver}
+
+			ranges, hostnames, err := cfg.ResolveRanges(t.Context(), tc.ranges)
+
+			if tc.expectError != nil {
+				require.ErrorIs(t, err, tc.expectError, "unexpected error returned")
+
+				return
+			}
+
+			require.NoError(t, err, "no error expected resolving ranges")
+
+			assert.Equal(t, tc.expectRanges, ranges, "unexpected ranges")
+			assert.Equal(t, tc.expectHostnames, hostnames, "unexpected hostnames")
+		})
+	}
+}
+
+func TestConfig_ResolveRanges_Timeout(t *testing.T) {
+	t.Parallel()
+
+	cfg := Config{
+		DNS:      DNSConfig{Timeout: 10 * time.Millisecond},
+		Resolver: blockingResolver{},
+	}
+
+	_, _, err := cfg.ResolveRanges(t.Context(), []string{"web.example.com"})
+	require.ErrorIs(t, err, ErrResolve, "expected resolve error")
+	require.ErrorIs(t, err, context.DeadlineExceeded, "expected lookup to time out")
+}
+
+// blockingResolver blocks each lookup until the context is done.
+type blockingResolver struct{}
+
+func (blockingResolver) LookupNetIP(ctx context.Context, _, _ string) ([]netip.Addr, error) {
+	<-ctx.Done()
+
+	return nil, ctx.Err()
+}
+
+func (blockingResolver) LookupSRV(ctx context.Context, _, _, _ string) (string, []*net.SRV, error) {
+	<-ctx.Done()
+
+	return "", nil, ctx.Err()
+}
+
+func TestIsHostname(t *testing.T) {
+	t.Parallel()
+
+	for value, expect := range map[string]bool{
+		"example.com":          true,
+		"my-host.example.com.": true,
+		"localhost":            true,
+		"_ldap._tcp.example":   true,
+		"10.0.0.300":           false,
+		"-bad.example.com":     false,
+		"bad..example.com":     false,
+		"10.0.0.0/24":          false,
+		"host name.example":    false,
+	} {
+		assert.Equal(t, expect, isHostname(value), "unexpected result for %q", value)
+	}
+}
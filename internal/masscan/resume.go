@@ -0,0 +1,155 @@
+package masscan
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/rs/zerolog"
+)
+
+const (
+	pausedConfFile  = "paused.conf"
+	resumeStateFile = "resume.json"
+)
+
+// resumeState is stored alongside paused.conf to track the results of interrupted runs.
+type resumeState struct {
+	// Fingerprint identifies the configuration the paused scan was started with.
+	// A scan is only resumed if the current configuration matches.
+	Fingerprint string `json:"fingerprint"`
+	Runs        int    `json:"runs"`
+	Report      Report `json:"report"`
+}
+
+// runResumable runs masscan in ResumeDir, resuming from a previously interrupted run if one exists.
+//
+// When the run is cancelled, masscan is interrupted and writes paused.conf, the results
+// collected so far are saved with it so the next run can continue the scan and report
+// the combined results once it completes.
+func (m *Masscan) runResumable(ctx context.Context, options RunOptions, plan scanPlan, report Report) (Report, error) {
+	logger := zerolog.Ctx(ctx)
+
+	if err := os.MkdirAll(m.cfg.ResumeDir, 0700); err != nil {
+		return report, fmt.Errorf("failed to create resume dir: %w", err)
+	}
+
+	pausedConf := filepath.Join(m.cfg.ResumeDir, pausedConfFile)
+	fingerprint := plan.fingerprint()
+
+	state, err := m.loadResumeState()
+	if err != nil {
+		logger.Warn().Err(err).Msg("failed to load resume state, starting a new scan")
+	}
+
+	args := plan.args
+
+	switch {
+	case state == nil:
+	case state.Fingerprint != fingerprint:
+		logger.Info().Msg("scan config has changed since the scan was paused, starting a new scan")
+
+		state = nil
+	case !fileExists(pausedConf):
+		logger.Warn().Msgf("%s is missing, starting a new scan", pausedConf)
+
+		state = nil
+	default:
+		logger.Info().Msgf("resuming scan interrupted %d time(s)", state.Runs)
+
+		args = []string{"--resume", pausedConf}
+	}
+
+	if state == nil {
+		// Ensure a stale paused.conf is not picked up by masscan or a later run.
+		if err := m.clearResumeState(); err != nil {
+			return report, err
+		}
+
+		state = &resumeState{
+			Fingerprint: fingerprint,
+		}
+	}
+
+	result, err := m.scan(ctx, options.Progress, m.cfg.ResumeDir, m.scanArgs(args, m.cfg.MaxRate, ""), report)
+
+	// Combine the results of this run with the results of the previously interrupted runs.
+	result.merge(state.Report)
+	result.ResumedRuns = state.Runs
+
+	if err == nil {
+		if err := m.clearResumeState(); err != nil {
+			logger.Warn().Err(err).Msg("failed to clear resume state")
+		}
+
+		return result, nil
+	}
+
+	if ctx.Err() == nil || !fileExists(pausedConf) {
+		return result, err
+	}
+
+	state.Runs++
+	state.Report = result
+
+	if saveErr := m.saveResumeState(*state); saveErr != nil {
+		logger.Warn().Err(saveErr).Msg("failed to save resume state")
+	} else {
+		logger.Info().Msg("scan interrupted, it will be resumed on the next run")
+	}
+
+	return result, err
+}
+
+func (m *Masscan) loadResumeState() (*resumeState, error) {
+	data, err := os.ReadFile(filepath.Join(m.cfg.ResumeDir, resumeStateFile))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	var state resumeState
+
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to decode resume state: %w", err)
+	}
+
+	return &state, nil
+}
+
+func (m *Masscan) saveResumeState(state resumeState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(m.cfg.ResumeDir, resumeStateFile)
+
+	if err := os.WriteFile(path+".tmp", data, 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(path+".tmp", path)
+}
+
+func (m *Masscan) clearResumeState() error {
+	for _, name := range []string{pausedConfFile, resumeStateFile} {
+		if err := os.Remove(filepath.Join(m.cfg.ResumeDir, name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to remove %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+
+	return err == nil
+}
@@ -0,0 +1,62 @@
+package masscan
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"os/exec"
+	"slices"
+)
+
+// command returns the launcher followed by the masscan binary, which prefix the arguments of each masscan process.
+func (c Config) command() []string {
+	return append(slices.Clone(c.Launcher), c.BinPath)
+}
+
+// execCommand builds a masscan process for args, prefixed by the launcher when configured.
+func (c Config) execCommand(ctx context.Context, args []string) *exec.Cmd {
+	command := c.command()
+
+	return exec.CommandContext(ctx, command[0], append(command[1:], args...)...)
+}
+
+// execute runs a single masscan process in dir, writing its combined output to w.
+// The process is run by the helper when configured, otherwise it is started directly.
+func (m *Masscan) execute(ctx context.Context, dir string, args []string, w io.Writer) error {
+	if m.cfg.Helper != "" {
+		return runHelper(ctx, m.cfg.Helper, m.cfg.WaitDelay, dir, HelperRequest{Args: args}, w)
+	}
+
+	cmd := m.cfg.execCommand(ctx, args)
+
+	// Interrupt masscan so it may stop gracefully, it is killed if it has not exited after WaitDelay.
+	// A launcher must forward the interrupt to masscan for it to stop gracefully.
+	cmd.Cancel = func() error {
+		return cmd.Process.Signal(os.Interrupt)
+	}
+
+	cmd.Dir = dir
+	cmd.WaitDelay = m.cfg.WaitDelay
+	cmd.Stdout = w
+	cmd.Stderr = w
+
+	return cmd.Run()
+}
+
+// exitCode returns the exit code of a masscan process which exited with an error.
+func exitCode(err error) (int, bool) {
+	var (
+		exitErr   *exec.ExitError
+		helperErr *HelperExitError
+	)
+
+	switch {
+	case errors.As(err, &exitErr):
+		return exitErr.ExitCode(), true
+	case errors.As(err, &helperErr):
+		return helperErr.Code, true
+	}
+
+	return 0, false
+}
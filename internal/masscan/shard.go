@@ -0,0 +1,141 @@
+package masscan
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+
+	"github.com/rs/zerolog"
+)
+
+var (
+	ErrAllShardsFailed = errors.New("all shards failed")
+)
+
+// runShards runs a masscan process for each shard concurrently and merges the results.
+// If some shards fail, the report is marked partial but the results of the successful shards are kept.
+// An error is only returned if every shard fails.
+func (m *Masscan) runShards(ctx context.Context, options RunOptions, args []string, report Report) (Report, error) {
+	logger := zerolog.Ctx(ctx)
+
+	tracker := &shardProgress{
+		progress: options.Progress,
+		shards:   make([]Progress, m.cfg.Shards),
+	}
+
+	var (
+		wg      sync.WaitGroup
+		reports = make([]Report, m.cfg.Shards)
+		errs    = make([]error, m.cfg.Shards)
+	)
+
+	for i := range m.cfg.Shards {
+		shard := i + 1
+
+		maxRate, adapter := m.shardOptions(i)
+
+		shardArgs := append(m.scanArgs(args, maxRate, adapter), "--shard", strconv.Itoa(shard)+"/"+strconv.Itoa(m.cfg.Shards))
+
+		shardLogger := logger.With().Int("shard", shard).Logger()
+
+		var progress ProgressFunc
+
+		if options.Progress != nil {
+			progress = func(p Progress) {
+				tracker.update(i, p)
+			}
+		}
+
+		wg.Go(func() {
+			reports[i], errs[i] = m.scan(shardLogger.WithContext(ctx), progress, "", shardArgs, Report{Partial: true})
+		})
+	}
+
+	wg.Wait()
+
+	var failed []error
+
+	for i, shardReport := range reports {
+		result := ShardReport{
+			Shard:   i + 1,
+			Success: errs[i] == nil,
+		}
+
+		if errs[i] != nil {
+			result.Error = errs[i].Error()
+
+			failed = append(failed, fmt.Errorf("shard %d: %w", i+1, errs[i]))
+
+			logger.Warn().Err(errs[i]).Int("shard", i+1).Msg("masscan shard failed")
+		} else {
+			report.merge(shardReport)
+
+			if shardReport.Stats != nil {
+				if report.Stats == nil {
+					report.Stats = &RunStats{}
+				}
+
+				report.Stats.add(*shardReport.Stats)
+			}
+		}
+
+		report.Shards = append(report.Shards, result)
+	}
+
+	if len(failed) == len(reports) {
+		return report, fmt.Errorf("%w: %w", ErrAllShardsFailed, errors.Join(failed...))
+	}
+
+	report.Partial = len(failed) != 0
+
+	return report, nil
+}
+
+// shardOptions returns the max rate and adapter for the shard index.
+func (m *Masscan) shardOptions(i int) (int, string) {
+	var opts ShardOptions
+
+	if i < len(m.cfg.ShardOptions) {
+		opts = m.cfg.ShardOptions[i]
+	}
+
+	maxRate := opts.MaxRate
+
+	if maxRate <= 0 && m.cfg.MaxRate > 0 {
+		maxRate = max(m.cfg.MaxRate/m.cfg.Shards, 1)
+	}
+
+	return maxRate, opts.Adapter
+}
+
+// shardProgress combines the progress of each shard into a single update.
+type shardProgress struct {
+	mu       sync.Mutex
+	progress ProgressFunc
+	shards   []Progress
+}
+
+// update records the progress of the shard and reports the combined progress.
+// The lock is held while reporting so concurrent updates are reported in the order they were combined.
+func (s *shardProgress) update(shard int, progress Progress) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.shards[shard] = progress
+
+	combined := Progress{
+		Waiting: true,
+	}
+
+	for _, p := range s.shards {
+		combined.Rate += p.Rate
+		combined.Percent += p.Percent / float64(len(s.shards))
+		combined.Found += p.Found
+		combined.Remaining = max(combined.Remaining, p.Remaining)
+		combined.Waiting = combined.Waiting && p.Waiting
+	}
+
+	s.progress(combined)
+}
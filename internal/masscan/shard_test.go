@@ -0,0 +1,36 @@
+package masscan
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShardProgress_update(t *testing.T) {
+	t.Parallel()
+
+	var reported []float64
+
+	tracker := &shardProgress{
+		progress: func(p Progress) {
+			reported = append(reported, p.Percent)
+		},
+		shards: make([]Progress, 2),
+	}
+
+	var wg sync.WaitGroup
+
+	for shard := range 2 {
+		wg.Go(func() {
+			for percent := range 1000 {
+				tracker.update(shard, Progress{Percent: float64(percent) / 10})
+			}
+		})
+	}
+
+	wg.Wait()
+
+	assert.Len(t, reported, 2000, "expected every update to be reported")
+	assert.IsNonDecreasing(t, reported, "expected combined progress to never move backwards")
+}
@@ -0,0 +1,344 @@
+package masscan
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Progress is the state of a running scan as reported by masscan's status line.
+type Progress struct {
+	// Rate is the current transmit rate in packets per second.
+	Rate float64 `json:"rate"`
+	// Percent is the percentage of the scan which has been transmitted.
+	Percent float64 `json:"percent"`
+	// Remaining is the estimated time until the scan completes.
+	// Once all packets are transmitted, this is the time remaining to wait for responses.
+	Remaining time.Duration `json:"remaining"`
+	// Waiting is true once all packets have been transmitted and masscan is waiting for responses.
+	Waiting bool `json:"waiting"`
+	// Found is the number of open ports found so far.
+	Found int `json:"found"`
+}
+
+// ProgressFunc is called with each status update while a scan is running.
+type ProgressFunc func(Progress)
+
+// parseStatusLine parses a masscan status line.
+// The line looks like one of the following:
+//
+//	rate:  0.10-kpps, 11.59% done,   0:00:42 remaining, found=0
+//	rate:  0.00-kpps, 100.00% done, waiting -30-secs, found=0
+//
+// Additional fields such as the tcb count when grabbing banners are ignored.
+func parseStatusLine(line string) (Progress, bool) {
+	line = strings.TrimSpace(line)
+
+	if !strings.HasPrefix(line, "rate:") {
+		return Progress{}, false
+	}
+
+	var (
+		progress Progress
+		parsed   int
+	)
+
+	for field := range strings.SplitSeq(line, ",") {
+		field = strings.TrimSpace(field)
+
+		switch {
+		case strings.HasPrefix(field, "rate:"):
+			value := strings.TrimSpace(strings.TrimSuffix(strings.TrimPrefix(field, "rate:"), "-kpps"))
+
+			kpps, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return Progress{}, false
+			}
+
+			progress.Rate = kpps * 1000
+			parsed++
+		case strings.HasSuffix(field, "% done"):
+			percent, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(field, "% done")), 64)
+			if err != nil {
+				return Progress{}, false
+			}
+
+			progress.Percent = percent
+			parsed++
+		case strings.HasSuffix(field, " remaining"):
+			remaining, ok := parseClock(strings.TrimSpace(strings.TrimSuffix(field, " remaining")))
+			if !ok {
+				return Progress{}, false
+			}
+
+			progress.Remaining = remaining
+		case strings.HasPrefix(field, "waiting "):
+			secs, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(field, "waiting "), "-secs"))
+			if err != nil {
+				return Progress{}, false
+			}
+
+			// masscan counts down to a negative value while waiting.
+			progress.Remaining = time.Duration(max(secs, 0)) * time.Second
+			progress.Waiting = true
+		case strings.HasPrefix(field, "found="):
+			found, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(field, "found=")))
+			if err != nil {
+				return Progress{}, false
+			}
+
+			progress.Found = found
+			parsed++
+		}
+	}
+
+	// rate, percent done and found are always included.
+	if parsed != 3 {
+		return Progress{}, false
+	}
+
+	return progress, true
+}
+
+// parseClock parses durations formatted as h:mm:ss.
+func parseClock(s string) (time.Duration, bool) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 3 {
+		return 0, false
+	}
+
+	var total time.Duration
+
+	for i, unit := range []time.Duration{time.Hour, time.Minute, time.Second} {
+		n, err := strconv.Atoi(parts[i])
+		if err != nil || n < 0 {
+			return 0, false
+		}
+
+		total += time.Duration(n) * unit
+	}
+
+	return total, true
+}
+
+// RunStats summarizes a completed masscan process, as reported by its output.
+type RunStats struct {
+	// Hosts and PortsPerHost are reported by masscan when the scan starts.
+	Hosts        uint64 `json:"hosts"`
+	PortsPerHost int    `json:"ports_per_host"`
+	// EstimatedPackets is the number of probes the scan was expected to send, including retries.
+	// It is calculated from the reported size of the scan, as masscan does not report the number of packets sent.
+	EstimatedPackets uint64 `json:"estimated_packets"`
+	// Duration is how long the process ran for.
+	Duration time.Duration `json:"duration"`
+	// Found is the number of open ports reported by the final status line.
+	Found int `json:"found"`
+	// EstimatedRate is the average transmit rate in packets per second, derived from EstimatedPackets.
+	EstimatedRate float64 `json:"estimated_rate"`
+}
+
+// add combines the stats of a process run concurrently, such as another shard.
+func (s *RunStats) add(other RunStats) {
+	s.Hosts += other.Hosts
+	s.PortsPerHost = max(s.PortsPerHost, other.PortsPerHost)
+	s.EstimatedPackets += other.EstimatedPackets
+	s.Duration = max(s.Duration, other.Duration)
+	s.Found += other.Found
+	s.EstimatedRate += other.EstimatedRate
+}
+
+// fatalPrefixes start lines masscan writes before exiting due to an error.
+var fatalPrefixes = []string{
+	"FAIL:",
+	"FAILED:",
+	"ERROR:",
+}
+
+// fatalMessages are errors masscan reports without a fatal prefix or after a hint.
+var fatalMessages = []string{
+	"could not determine default interface",
+	"failed to detect ip of interface",
+	"failed to detect router",
+	"target ip address list empty",
+	"no ports were specified",
+}
+
+// isFatal reports if the line is an error which stops masscan.
+func isFatal(line string) bool {
+	line = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), "[-]"))
+
+	for _, prefix := range fatalPrefixes {
+		if strings.HasPrefix(line, prefix) {
+			return true
+		}
+	}
+
+	line = strings.ToLower(line)
+
+	for _, msg := range fatalMessages {
+		if strings.Contains(line, msg) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// outputTailSize is the amount of masscan's output kept for logging and errors.
+const outputTailSize = 64 << 10
+
+// tailBuffer keeps the last max bytes written to it.
+type tailBuffer struct {
+	max int
+	buf []byte
+}
+
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.buf = append(b.buf, p...)
+
+	if over := len(b.buf) - b.max; over > 0 {
+		b.buf = b.buf[over:]
+	}
+
+	return len(p), nil
+}
+
+func (b *tailBuffer) String() string {
+	return string(b.buf)
+}
+
+// statusWriter passes all output through to the underlying writer while
+// parsing status lines, the scan summary and fatal errors as they are written.
+//
+// masscan terminates status lines with a carriage return so they overwrite each other
+// on a terminal, so both carriage returns and new lines are treated as line endings.
+type statusWriter struct {
+	w        io.Writer
+	progress ProgressFunc
+
+	line []byte
+
+	// last is the most recently parsed status line, valid once seen is true.
+	last Progress
+	seen bool
+
+	// transmitted is when masscan first reported it is waiting for responses.
+	transmitted time.Time
+
+	hosts        uint64
+	portsPerHost int
+
+	fatal []string
+}
+
+func (s *statusWriter) Write(p []byte) (int, error) {
+	n, err := s.w.Write(p)
+
+	s.line = append(s.line, p...)
+
+	for {
+		i := bytes.IndexAny(s.line, "\r\n")
+		if i == -1 {
+			break
+		}
+
+		s.parseLine(string(s.line[:i]))
+
+		s.line = s.line[i+1:]
+	}
+
+	// Avoid holding on to unbounded output without line endings.
+	if len(s.line) > 4096 {
+		s.line = s.line[:0]
+	}
+
+	return n, err
+}
+
+// flush parses any remaining output which was not terminated by a line ending.
+func (s *statusWriter) flush() {
+	if len(s.line) != 0 {
+		s.parseLine(string(s.line))
+
+		s.line = s.line[:0]
+	}
+}
+
+func (s *statusWriter) parseLine(line string) {
+	if progress, ok := parseStatusLine(line); ok {
+		if progress.Waiting && s.transmitted.IsZero() {
+			s.transmitted = time.Now()
+		}
+
+		s.last = progress
+		s.seen = true
+
+		if s.progress != nil {
+			s.progress(progress)
+		}
+
+		return
+	}
+
+	var (
+		hosts uint64
+		ports int
+	)
+
+	// masscan reports the size of the scan before it starts, such as:
+	// Scanning 256 hosts [2 ports/host]
+	if _, err := fmt.Sscanf(strings.TrimSpace(line), "Scanning %d hosts [%d ports/host]", &hosts, &ports); err == nil {
+		s.hosts, s.portsPerHost = hosts, ports
+
+		return
+	}
+
+	if isFatal(line) {
+		s.fatal = append(s.fatal, strings.TrimSpace(line))
+	}
+}
+
+// final returns the last status reported by masscan.
+// ok is false if masscan never reported its status.
+func (s *statusWriter) final() (Progress, bool) {
+	return s.last, s.seen
+}
+
+// stats summarizes the process which ran from start to end and sent each probe retries additional times.
+func (s *statusWriter) stats(start, end time.Time, retries int) RunStats {
+	duration := end.Sub(start)
+
+	stats := RunStats{
+		Hosts:        s.hosts,
+		PortsPerHost: s.portsPerHost,
+		Duration:     duration,
+		Found:        s.last.Found,
+
+		EstimatedPackets: s.hosts * uint64(s.portsPerHost) * uint64(max(retries, 0)+1),
+	}
+
+	// Probes are not sent while waiting, so the rate is averaged over the time spent transmitting when known.
+	transmitting := duration
+
+	if s.transmitted.After(start) && s.transmitted.Before(end) {
+		transmitting = s.transmitted.Sub(start)
+	}
+
+	if transmitting > 0 {
+		stats.EstimatedRate = float64(stats.EstimatedPackets) / transmitting.Seconds()
+	}
+
+	return stats
+}
+
+// failure describes why masscan failed, preferring any fatal errors reported over the raw output.
+func (s *statusWriter) failure(output string) string {
+	if len(s.fatal) != 0 {
+		return strings.Join(s.fatal, "; ")
+	}
+
+	return strings.TrimSpace(output)
+}
@@ -0,0 +1,162 @@
+package masscan
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseStatusLine(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name     string
+		line     string
+		expect   Progress
+		expectOk bool
+	}{
+		{
+			"remaining",
+			"rate:  0.10-kpps, 11.59% done,   0:01:42 remaining, found=3       ",
+			Progress{Rate: 100, Percent: 11.59, Remaining: time.Minute + 42*time.Second, Found: 3},
+			true,
+		},
+		{
+			"waiting",
+			"rate:  0.00-kpps, 100.00% done, waiting 8-secs, found=12",
+			Progress{Rate: 0, Percent: 100, Remaining: 8 * time.Second, Waiting: true, Found: 12},
+			true,
+		},
+		{
+			"waiting negative",
+			"rate:  0.00-kpps, 100.00% done, waiting -30-secs, found=0",
+			Progress{Rate: 0, Percent: 100, Waiting: true},
+			true,
+		},
+		{
+			"banner fields",
+			"rate:  1.50-kpps, 50.00% done,   1:00:00 remaining, found=1, tcb=2",
+			Progress{Rate: 1500, Percent: 50, Remaining: time.Hour, Found: 1},
+			true,
+		},
+		{
+			"not status",
+			"Scanning 256 hosts [2 ports/host]",
+			Progress{},
+			false,
+		},
+		{
+			"missing found",
+			"rate:  0.10-kpps, 11.59% done,   0:01:42 remaining",
+			Progress{},
+			false,
+		},
+		{
+			"invalid found",
+			"rate:  0.10-kpps, 11.59% done,   0:01:42 remaining, found=",
+			Progress{},
+			false,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			progress, ok := parseStatusLine(tc.line)
+
+			require.Equal(t, tc.expectOk, ok, "unexpected parse result")
+
+			assert.Equal(t, tc.expect, progress, "unexpected progress")
+		})
+	}
+}
+
+func TestStatusWriter(t *testing.T) {
+	t.Parallel()
+
+	var (
+		output  bytes.Buffer
+		updates []Progress
+	)
+
+	w := &statusWriter{
+		w: &output,
+		progress: func(p Progress) {
+			updates = append(updates, p)
+		},
+	}
+
+	chunks := []string{
+		"Starting masscan 1.3.2\nScanning 256 hosts [2 ports/host]\n",
+		"rate:  0.10-kpps, 10.00% done,   0:00:09 remaining, found=0       \r",
+		"rate:  0.10-kpps, 20.00",
+		"% done,   0:00:08 remaining, found=1       \r",
+		"rate:  0.00-kpps, 100.00% done, waiting 5-secs, found=2       \r",
+	}
+
+	for _, chunk := range chunks {
+		_, err := w.Write([]byte(chunk))
+		require.NoError(t, err, "no error expected writing")
+	}
+
+	assert.Equal(t, []Progress{
+		{Rate: 100, Percent: 10, Remaining: 9 * time.Second},
+		{Rate: 100, Percent: 20, Remaining: 8 * time.Second, Found: 1},
+		{Rate: 0, Percent: 100, Remaining: 5 * time.Second, Waiting: true, Found: 2},
+	}, updates, "unexpected progress updates")
+
+	expectOutput := ""
+	for _, chunk := range chunks {
+		expectOutput += chunk
+	}
+
+	assert.Equal(t, expectOutput, output.String(), "expected output to be passed through")
+
+	final, ok := w.final()
+	require.True(t, ok, "expected final status")
+	assert.Equal(t, 2, final.Found, "unexpected final found")
+
+	stats := w.stats(time.Now().Add(-2*time.Second), time.Now(), 0)
+	assert.Equal(t, uint64(256), stats.Hosts, "unexpected hosts")
+	assert.Equal(t, 2, stats.PortsPerHost, "unexpected ports per host")
+	assert.Equal(t, uint64(512), stats.EstimatedPackets, "unexpected estimated packets")
+	assert.Equal(t, 2, stats.Found, "unexpected found")
+}
+
+func TestStatusWriter_Fatal(t *testing.T) {
+	t.Parallel()
+
+	w := &statusWriter{w: io.Discard}
+
+	_, err := w.Write([]byte("Starting masscan 1.3.2\nFAIL: could not determine default interface\n [hint] try \"--interface ethX\"\nERROR: no ports were specified"))
+	require.NoError(t, err, "no error expected writing")
+
+	w.flush()
+
+	_, ok := w.final()
+	assert.False(t, ok, "expected no final status")
+	assert.Equal(t, []string{
+		"FAIL: could not determine default interface",
+		"ERROR: no ports were specified",
+	}, w.fatal, "unexpected fatal messages")
+	assert.Equal(t, "FAIL: could not determine default interface; ERROR: no ports were specified", w.failure("output"), "expected fatal messages to describe failure")
+}
+
+func TestTailBuffer(t *testing.T) {
+	t.Parallel()
+
+	b := &tailBuffer{max: 8}
+
+	for _, chunk := range []string{"abc", "defgh", "ijklmnopqrstuv", "wx"} {
+		n, err := b.Write([]byte(chunk))
+		require.NoError(t, err, "no error expected writing")
+		assert.Equal(t, len(chunk), n, "expected all bytes to be written")
+	}
+
+	assert.Equal(t, "qrstuvwx", b.String(), "expected only the tail to be kept")
+}
@@ -0,0 +1,491 @@
+package masscan
+
+import (
+	"cmp"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net/netip"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrInvalidRange = errors.New("invalid range")
+	ErrInvalidPort  = errors.New("invalid port")
+)
+
+// Port protocols as reported by masscan.
+const (
+	ProtoTCP  = "tcp"
+	ProtoUDP  = "udp"
+	ProtoSCTP = "sctp"
+)
+
+// portPrefixes maps the masscan port prefixes to their protocol.
+var portPrefixes = map[string]string{
+	"T": ProtoTCP,
+	"U": ProtoUDP,
+	"S": ProtoSCTP,
+}
+
+// Targets is a normalized set of addresses and ports to scan.
+type Targets struct {
+	Ranges   []AddrRange `json:"ranges"`
+	Excludes []AddrRange `json:"excludes,omitempty"`
+	Ports    []PortRange `json:"ports"`
+}
+
+// ParseTargets parses and normalizes the ranges, excludes and ports.
+func ParseTargets(ranges, excludes, ports []string) (Targets, error) {
+	var (
+		targets Targets
+		err     error
+	)
+
+	if targets.Ranges, err = ParseRanges(ranges); err != nil {
+		return targets, err
+	}
+
+	if targets.Excludes, err = ParseRanges(excludes); err != nil {
+		return targets, err
+	}
+
+	if targets.Ports, err = ParsePorts(ports); err != nil {
+		return targets, err
+	}
+
+	return targets, nil
+}
+
+// Addresses returns the ranges with all excluded addresses removed.
+func (t Targets) Addresses() []AddrRange {
+	return SubtractRanges(t.Ranges, t.Excludes)
+}
+
+// AddressCount returns the number of addresses which will be scanned.
+// The count is capped at the maximum uint64.
+func (t Targets) AddressCount() uint64 {
+	var total uint64
+
+	for _, r := range t.Addresses() {
+		count := r.Count()
+
+		if total > math.MaxUint64-count {
+			return math.MaxUint64
+		}
+
+		total += count
+	}
+
+	return total
+}
+
+// PortCount returns the number of ports which will be scanned on each address.
+func (t Targets) PortCount() int {
+	var total int
+
+	for _, r := range t.Ports {
+		total += r.Count()
+	}
+
+	return total
+}
+
+// AddrRange is an inclusive range of addresses.
+type AddrRange struct {
+	From netip.Addr
+	To   netip.Addr
+}
+
+// Contains reports if the address is within the range.
+func (r AddrRange) Contains(addr netip.Addr) bool {
+	return r.From.Compare(addr) <= 0 && addr.Compare(r.To) <= 0
+}
+
+// Count returns the number of addresses in the range, capped at the maximum uint64.
+func (r AddrRange) Count() uint64 {
+	from, to := r.From.As16(), r.To.As16()
+
+	fromHi, fromLo := binary.BigEndian.Uint64(from[:8]), binary.BigEndian.Uint64(from[8:])
+	toHi, toLo := binary.BigEndian.Uint64(to[:8]), binary.BigEndian.Uint64(to[8:])
+
+	diffLo := toLo - fromLo
+	diffHi := toHi - fromHi
+
+	if toLo < fromLo {
+		diffHi--
+	}
+
+	if diffHi != 0 || diffLo == math.MaxUint64 {
+		return math.MaxUint64
+	}
+
+	return diffLo + 1
+}
+
+// String returns the range as a single address, a cidr if the range is exactly a prefix,
+// or a dash separated range.
+func (r AddrRange) String() string {
+	if r.From == r.To {
+		return r.From.String()
+	}
+
+	for bits := 0; bits <= r.From.BitLen(); bits++ {
+		prefix := netip.PrefixFrom(r.From, bits)
+
+		if prefix.Masked().Addr() == r.From && lastAddr(prefix) == r.To {
+			return prefix.String()
+		}
+	}
+
+	return r.From.String() + "-" + r.To.String()
+}
+
+func (r AddrRange) MarshalText() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+func (r *AddrRange) UnmarshalText(text []byte) error {
+	parsed, err := parseRange(string(text))
+	if err != nil {
+		return err
+	}
+
+	*r = parsed
+
+	return nil
+}
+
+// ParseRanges parses ip addresses, cidrs and dash separated ranges.
+// Values may contain multiple comma separated ranges.
+// The returned ranges are sorted with overlapping and adjacent ranges merged.
+func ParseRanges(values []string) ([]AddrRange, error) {
+	var ranges []AddrRange
+
+	for _, list := range values {
+		for value := range strings.SplitSeq(list, ",") {
+			value = strings.TrimSpace(value)
+
+			if value == "" {
+				continue
+			}
+
+			r, err := parseRange(value)
+			if err != nil {
+				return nil, err
+			}
+
+			ranges = append(ranges, r)
+		}
+	}
+
+	return MergeRanges(ranges), nil
+}
+
+func parseRange(value string) (AddrRange, error) {
+	var r AddrRange
+
+	switch {
+	case strings.Contains(value, "/"):
+		prefix, err := netip.ParsePrefix(value)
+		if err != nil {
+			return r, fmt.Errorf("%w '%s': %w", ErrInvalidRange, value, err)
+		}
+
+		prefix = prefix.Masked()
+
+		r.From = prefix.Addr()
+		r.To = lastAddr(prefix)
+	case strings.Contains(value, "-"):
+		fromStr, toStr, _ := strings.Cut(value, "-")
+
+		from, err := parseAddr(strings.TrimSpace(fromStr))
+		if err != nil {
+			return r, fmt.Errorf("%w '%s': %w", ErrInvalidRange, value, err)
+		}
+
+		to, err := parseAddr(strings.TrimSpace(toStr))
+		if err != nil {
+			return r, fmt.Errorf("%w '%s': %w", ErrInvalidRange, value, err)
+		}
+
+		if from.BitLen() != to.BitLen() {
+			return r, fmt.Errorf("%w '%s': start and end must be the same address family", ErrInvalidRange, value)
+		}
+
+		if to.Less(from) {
+			return r, fmt.Errorf("%w '%s': end is before start", ErrInvalidRange, value)
+		}
+
+		r.From, r.To = from, to
+	default:
+		addr, err := parseAddr(value)
+		if err != nil {
+			return r, fmt.Errorf("%w '%s': %w", ErrInvalidRange, value, err)
+		}
+
+		r.From, r.To = addr, addr
+	}
+
+	return r, nil
+}
+
+// parseAddr parses an ipv4 or ipv6 address, ipv4-mapped ipv6 addresses are converted to ipv4.
+// Zones are not supported as masscan does not accept them.
+func parseAddr(value string) (netip.Addr, error) {
+	addr, err := netip.ParseAddr(value)
+	if err != nil {
+		return addr, err
+	}
+
+	if addr.Zone() != "" {
+		return addr, errors.New("zones are not supported")
+	}
+
+	return addr.Unmap(), nil
+}
+
+// MergeRanges sorts the ranges and merges any which overlap or are adjacent.
+func MergeRanges(ranges []AddrRange) []AddrRange {
+	if len(ranges) == 0 {
+		return nil
+	}
+
+	sorted := slices.Clone(ranges)
+
+	slices.SortFunc(sorted, func(a, b AddrRange) int {
+		return cmp.Or(a.From.Compare(b.From), a.To.Compare(b.To))
+	})
+
+	merged := sorted[:1]
+
+	for _, r := range sorted[1:] {
+		last := &merged[len(merged)-1]
+
+		if last.From.BitLen() == r.From.BitLen() {
+			next := last.To.Next()
+
+			if r.From.Compare(last.To) <= 0 || r.From == next {
+				if last.To.Less(r.To) {
+					last.To = r.To
+				}
+
+				continue
+			}
+		}
+
+		merged = append(merged, r)
+	}
+
+	return merged
+}
+
+// SubtractRanges returns the ranges with the addresses of excludes removed.
+func SubtractRanges(ranges, excludes []AddrRange) []AddrRange {
+	ranges = MergeRanges(ranges)
+	excludes = MergeRanges(excludes)
+
+	var result []AddrRange
+
+	for _, r := range ranges {
+		from := r.From
+
+		for _, exclude := range excludes {
+			if !from.IsValid() {
+				break
+			}
+
+			if exclude.From.BitLen() != r.From.BitLen() || exclude.To.Less(from) {
+				continue
+			}
+
+			if r.To.Less(exclude.From) {
+				break
+			}
+
+			if from.Less(exclude.From) {
+				result = append(result, AddrRange{From: from, To: exclude.From.Prev()})
+			}
+
+			if r.To.Compare(exclude.To) <= 0 {
+				from = netip.Addr{}
+
+				break
+			}
+
+			from = exclude.To.Next()
+		}
+
+		if from.IsValid() {
+			result = append(result, AddrRange{From: from, To: r.To})
+		}
+	}
+
+	return result
+}
+
+// lastAddr returns the last address within the prefix.
+func lastAddr(prefix netip.Prefix) netip.Addr {
+	addr := prefix.Addr().AsSlice()
+
+	for i := prefix.Bits(); i < len(addr)*8; i++ {
+		addr[i/8] |= 1 << (7 - i%8)
+	}
+
+	last, _ := netip.AddrFromSlice(addr)
+
+	return last
+}
+
+// PortRange is an inclusive range of ports for a protocol.
+type PortRange struct {
+	Proto string
+	From  int
+	To    int
+}
+
+// Count returns the number of ports in the range.
+func (r PortRange) Count() int {
+	return r.To - r.From + 1
+}
+
+// String returns the range in masscan's port syntax, tcp ports are not prefixed.
+func (r PortRange) String() string {
+	var prefix string
+
+	switch r.Proto {
+	case ProtoUDP:
+		prefix = "U:"
+	case ProtoSCTP:
+		prefix = "S:"
+	}
+
+	if r.From == r.To {
+		return prefix + strconv.Itoa(r.From)
+	}
+
+	return prefix + strconv.Itoa(r.From) + "-" + strconv.Itoa(r.To)
+}
+
+func (r PortRange) MarshalText() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+func (r *PortRange) UnmarshalText(text []byte) error {
+	parsed, err := parsePort(string(text))
+	if err != nil {
+		return err
+	}
+
+	*r = parsed
+
+	return nil
+}
+
+// ParsePorts parses ports and port ranges, optionally prefixed with T:, U: or S:
+// for tcp, udp or sctp. Values may contain multiple comma separated ports.
+// The returned ranges are sorted by protocol and port with overlapping and adjacent ranges merged.
+func ParsePorts(values []string) ([]PortRange, error) {
+	var ports []PortRange
+
+	for _, list := range values {
+		for value := range strings.SplitSeq(list, ",") {
+			value = strings.TrimSpace(value)
+
+			if value == "" {
+				continue
+			}
+
+			r, err := parsePort(value)
+			if err != nil {
+				return nil, err
+			}
+
+			ports = append(ports, r)
+		}
+	}
+
+	return MergePorts(ports), nil
+}
+
+func parsePort(value string) (PortRange, error) {
+	r := PortRange{Proto: ProtoTCP}
+
+	ports := value
+
+	if prefix, remain, found := strings.Cut(value, ":"); found {
+		proto, ok := portPrefixes[strings.ToUpper(strings.TrimSpace(prefix))]
+		if !ok {
+			return r, fmt.Errorf("%w '%s': unknown protocol '%s'", ErrInvalidPort, value, prefix)
+		}
+
+		r.Proto = proto
+		ports = remain
+	}
+
+	fromStr, toStr, isRange := strings.Cut(ports, "-")
+	if !isRange {
+		toStr = fromStr
+	}
+
+	from, err := strconv.Atoi(strings.TrimSpace(fromStr))
+	if err != nil || from < 0 || from > 65535 {
+		return r, fmt.Errorf("%w '%s': port must be between 0 and 65535", ErrInvalidPort, value)
+	}
+
+	to, err := strconv.Atoi(strings.TrimSpace(toStr))
+	if err != nil || to < 0 || to > 65535 {
+		return r, fmt.Errorf("%w '%s': port must be between 0 and 65535", ErrInvalidPort, value)
+	}
+
+	if to < from {
+		return r, fmt.Errorf("%w '%s': end is before start", ErrInvalidPort, value)
+	}
+
+	r.From, r.To = from, to
+
+	return r, nil
+}
+
+// MergePorts sorts the port ranges and merges any of the same protocol which overlap or are adjacent.
+func MergePorts(ports []PortRange) []PortRange {
+	if len(ports) == 0 {
+		return nil
+	}
+
+	sorted := slices.Clone(ports)
+
+	slices.SortFunc(sorted, func(a, b PortRange) int {
+		return cmp.Or(cmp.Compare(a.Proto, b.Proto), cmp.Compare(a.From, b.From), cmp.Compare(a.To, b.To))
+	})
+
+	merged := sorted[:1]
+
+	for _, r := range sorted[1:] {
+		last := &merged[len(merged)-1]
+
+		if last.Proto == r.Proto && r.From <= last.To+1 {
+			last.To = max(last.To, r.To)
+
+			continue
+		}
+
+		merged = append(merged, r)
+	}
+
+	return merged
+}
+
+// rangeStrings returns the string form of each range.
+func rangeStrings[T fmt.Stringer](ranges []T) []string {
+	values := make([]string, len(ranges))
+
+	for i, r := range ranges {
+		values[i] = r.String()
+	}
+
+	return values
+}
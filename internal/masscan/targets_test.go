@@ -0,0 +1,249 @@
+package masscan
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRanges(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name        string
+		ranges      []string
+		expect      []string
+		expectError error
+	}{
+		{
+			"single addresses",
+			[]string{"10.0.0.1", " 10.0.0.5 "},
+			[]string{"10.0.0.1", "10.0.0.5"},
+			nil,
+		},
+		{
+			"cidr is masked",
+			[]string{"10.0.1.7/24"},
+			[]string{"10.0.1.0/24"},
+			nil,
+		},
+		{
+			"dash range",
+			[]string{"10.0.2.1-10.0.2.5"},
+			[]string{"10.0.2.1-10.0.2.5"},
+			nil,
+		},
+		{
+			"dash range matching a cidr",
+			[]string{"10.0.2.0 - 10.0.2.255"},
+			[]string{"10.0.2.0/24"},
+			nil,
+		},
+		{
+			"comma separated",
+			[]string{"10.0.0.1,10.0.0.3"},
+			[]string{"10.0.0.1", "10.0.0.3"},
+			nil,
+		},
+		{
+			"overlapping and adjacent merged",
+			[]string{"10.0.0.128/25", "10.0.0.0/25", "10.0.0.10-10.0.0.20", "10.0.1.0", "10.0.3.0/24"},
+			[]string{"10.0.0.0-10.0.1.0", "10.0.3.0/24"},
+			nil,
+		},
+		{
+			"ipv6",
+			[]string{"2001:DB8::1-2001:db8::3", "2001:db8:0:1::/64", "2001:db8::4"},
+			[]string{"2001:db8::1-2001:db8::4", "2001:db8:0:1::/64"},
+			nil,
+		},
+		{
+			"ipv4-mapped ipv6",
+			[]string{"::ffff:10.0.0.1"},
+			[]string{"10.0.0.1"},
+			nil,
+		},
+		{
+			"mixed families",
+			[]string{"10.0.0.0/24", "2001:db8::/126", "10.0.1.0/24"},
+			[]string{"10.0.0.0/23", "2001:db8::/126"},
+			nil,
+		},
+		{
+			"mixed family range",
+			[]string{"10.0.0.1-2001:db8::1"},
+			nil,
+			ErrInvalidRange,
+		},
+		{
+			"ipv6 zone",
+			[]string{"fe80::1%eth0"},
+			nil,
+			ErrInvalidRange,
+		},
+		{
+			"invalid address",
+			[]string{"10.0.0.300"},
+			nil,
+			ErrInvalidRange,
+		},
+		{
+			"invalid cidr",
+			[]string{"10.0.0.0/33"},
+			nil,
+			ErrInvalidRange,
+		},
+		{
+			"end before start",
+			[]string{"10.0.0.5-10.0.0.1"},
+			nil,
+			ErrInvalidRange,
+		},
+		{
+			"hostname",
+			[]string{"scanme.example.com"},
+			nil,
+			ErrInvalidRange,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ranges, err := ParseRanges(tc.ranges)
+
+			if tc.expectError != nil {
+				require.ErrorIs(t, err, tc.expectError, "unexpected error returned")
+
+				return
+			}
+
+			require.NoError(t, err, "no error expected parsing ranges")
+
+			assert.Equal(t, tc.expect, rangeStrings(ranges), "unexpected ranges")
+		})
+	}
+}
+
+func TestParsePorts(t *testing.T) {
+	t.Parallel()
+
+	testCases := []struct {
+		name        string
+		ports       []string
+		expect      []string
+		expectError error
+	}{
+		{
+			"ports and ranges",
+			[]string{"80,443", "8000-8002"},
+			[]string{"80", "443", "8000-8002"},
+			nil,
+		},
+		{
+			"protocol prefixes",
+			[]string{"T:22", "u:53", "S:2905", "U:161-162"},
+			[]string{"S:2905", "22", "U:53", "U:161-162"},
+			nil,
+		},
+		{
+			"overlapping and adjacent merged",
+			[]string{"80", "79-81", "82", "U:80"},
+			[]string{"79-82", "U:80"},
+			nil,
+		},
+		{
+			"port too large",
+			[]string{"70000"},
+			nil,
+			ErrInvalidPort,
+		},
+		{
+			"end before start",
+			[]string{"90-80"},
+			nil,
+			ErrInvalidPort,
+		},
+		{
+			"unknown protocol",
+			[]string{"X:80"},
+			nil,
+			ErrInvalidPort,
+		},
+		{
+			"not a number",
+			[]string{"http"},
+			nil,
+			ErrInvalidPort,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			ports, err := ParsePorts(tc.ports)
+
+			if tc.expectError != nil {
+				require.ErrorIs(t, err, tc.expectError, "unexpected error returned")
+
+				return
+			}
+
+			require.NoError(t, err, "no error expected parsing ports")
+
+			assert.Equal(t, tc.expect, rangeStrings(ports), "unexpected ports")
+		})
+	}
+}
+
+func TestTargets_AddressCount(t *testing.T) {
+	t.Parallel()
+
+	targets, err := ParseTargets(
+		[]string{"10.0.0.0/24", "10.0.2.0/24", "10.0.1.1"},
+		[]string{"10.0.0.0-10.0.0.9", "10.0.0.255", "10.0.2.0/25", "10.0.9.0/24"},
+		[]string{"80"},
+	)
+	require.NoError(t, err, "no error expected parsing targets")
+
+	assert.Equal(t, []string{"10.0.0.10-10.0.0.254", "10.0.1.1", "10.0.2.128/25"}, rangeStrings(targets.Addresses()), "unexpected addresses")
+	assert.Equal(t, uint64(245+1+128), targets.AddressCount(), "unexpected address count")
+}
+
+func TestTargets_AddressCount_IPv6(t *testing.T) {
+	t.Parallel()
+
+	targets, err := ParseTargets([]string{"2001:db8::/120", "10.0.0.0/24"}, []string{"2001:db8::ff"}, nil)
+	require.NoError(t, err, "no error expected parsing targets")
+
+	assert.Equal(t, uint64(256+255), targets.AddressCount(), "unexpected address count")
+
+	targets, err = ParseTargets([]string{"2001:db8::/64", "2001:db8:1::/64"}, nil, nil)
+	require.NoError(t, err, "no error expected parsing targets")
+
+	assert.Equal(t, uint64(math.MaxUint64), targets.AddressCount(), "expected address count to be capped")
+}
+
+func TestTargets_JSON(t *testing.T) {
+	t.Parallel()
+
+	targets, err := ParseTargets([]string{"10.0.0.0/24"}, []string{"10.0.0.1"}, []string{"80-81", "U:53"})
+	require.NoError(t, err, "no error expected parsing targets")
+
+	data, err := json.Marshal(targets)
+	require.NoError(t, err, "no error expected encoding targets")
+
+	assert.JSONEq(t, `{"ranges":["10.0.0.0/24"],"excludes":["10.0.0.1"],"ports":["80-81","U:53"]}`, string(data), "unexpected json")
+
+	var decoded Targets
+
+	err = json.Unmarshal(data, &decoded)
+	require.NoError(t, err, "no error expected decoding targets")
+
+	assert.Equal(t, targets, decoded, "expected decoded targets to match")
+}
@@ -0,0 +1,205 @@
+package masscan
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+const (
+	// workDirPrefix prefixes the work directory each process creates within a temp dir.
+	workDirPrefix = "masscan-exporter-"
+
+	// workDirLock is held for the lifetime of the process which created the work directory.
+	workDirLock = ".lock"
+
+	// workDirGrace is how long a work directory without a lock file is assumed to be in the process of being created.
+	workDirGrace = time.Minute
+)
+
+// errLocked is returned by lockFile when another process holds the lock.
+var errLocked = errors.New("file is locked by another process")
+
+// legacyTempFile matches the temp files previous versions created directly within the temp dir.
+var legacyTempFile = regexp.MustCompile(`^masscan-[0-9a-f]{16}\.(json|conf|exclude)$`)
+
+type workDir struct {
+	path string
+	lock *os.File
+}
+
+var workDirs = struct {
+	sync.Mutex
+	dirs map[string]*workDir
+}{
+	dirs: make(map[string]*workDir),
+}
+
+// getWorkDir returns the work directory of the process within tempDir, creating it on first use.
+//
+// The directory is only accessible by the process's user, and is locked so CleanTempDir
+// does not remove it while the process is running.
+func getWorkDir(tempDir string) (string, error) {
+	workDirs.Lock()
+	defer workDirs.Unlock()
+
+	if dir, ok := workDirs.dirs[tempDir]; ok {
+		return dir.path, nil
+	}
+
+	if err := os.MkdirAll(tempDir, 0755); err != nil {
+		return "", err
+	}
+
+	path, err := os.MkdirTemp(tempDir, workDirPrefix)
+	if err != nil {
+		return "", fmt.Errorf("failed to create work dir: %w", err)
+	}
+
+	lock, err := lockFile(filepath.Join(path, workDirLock))
+	if err != nil {
+		os.RemoveAll(path)
+
+		return "", fmt.Errorf("failed to lock work dir: %w", err)
+	}
+
+	workDirs.dirs[tempDir] = &workDir{
+		path: path,
+		lock: lock,
+	}
+
+	return path, nil
+}
+
+// RemoveWorkDirs removes the work directories created by the process, it should be called before exiting.
+func RemoveWorkDirs() error {
+	workDirs.Lock()
+	defer workDirs.Unlock()
+
+	var errs []error
+
+	for tempDir, dir := range workDirs.dirs {
+		errs = append(errs, os.RemoveAll(dir.path), dir.lock.Close())
+
+		delete(workDirs.dirs, tempDir)
+	}
+
+	return errors.Join(errs...)
+}
+
+// CleanTempDir removes files left within tempDir by processes which did not exit cleanly.
+//
+// Work directories are removed once the process which created them is no longer running,
+// along with any temp files created directly within tempDir by previous versions.
+func CleanTempDir(ctx context.Context, tempDir string) error {
+	logger := zerolog.Ctx(ctx)
+
+	entries, err := os.ReadDir(tempDir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+
+		return err
+	}
+
+	var errs []error
+
+	for _, entry := range entries {
+		path := filepath.Join(tempDir, entry.Name())
+
+		switch {
+		case entry.Type().IsRegular() && legacyTempFile.MatchString(entry.Name()):
+			if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+				errs = append(errs, err)
+
+				continue
+			}
+
+			logger.Info().Msgf("removed stale temp file %s", path)
+		case entry.IsDir() && strings.HasPrefix(entry.Name(), workDirPrefix):
+			removed, err := removeStaleWorkDir(path)
+			if err != nil {
+				errs = append(errs, err)
+
+				continue
+			}
+
+			if removed {
+				logger.Info().Msgf("removed stale work dir %s", path)
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// removeStaleWorkDir removes the work directory if the process which created it is no longer running.
+func removeStaleWorkDir(path string) (bool, error) {
+	lockPath := filepath.Join(path, workDirLock)
+
+	if _, err := os.Stat(lockPath); errors.Is(err, os.ErrNotExist) {
+		// The directory may have just been created by a process which has not yet locked it.
+		info, err := os.Stat(path)
+		if err != nil || time.Since(info.ModTime()) < workDirGrace {
+			return false, nil
+		}
+	} else {
+		lock, err := lockFile(lockPath)
+
+		switch {
+		case errors.Is(err, errLocked):
+			return false, nil
+		case err != nil:
+			return false, fmt.Errorf("failed to lock work dir %s: %w", path, err)
+		}
+
+		defer lock.Close()
+	}
+
+	if err := os.RemoveAll(path); err != nil {
+		return false, fmt.Errorf("failed to remove work dir %s: %w", path, err)
+	}
+
+	return true, nil
+}
+
+// tempFile atomically creates a file with contents in the process's work dir within tempDir.
+// The file is only readable by the process's user. The returned function removes the file.
+func tempFile(tempDir, ext, contents string) (string, func(), error) {
+	dir, err := getWorkDir(tempDir)
+	if err != nil {
+		return "", nil, err
+	}
+
+	f, err := os.CreateTemp(dir, "masscan-*."+ext)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create temp file: %w", err)
+	}
+
+	remove := func() {
+		os.Remove(f.Name())
+	}
+
+	_, err = f.WriteString(contents)
+
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		remove()
+
+		return "", nil, fmt.Errorf("failed to write temp file: %w", err)
+	}
+
+	return f.Name(), remove, nil
+}
@@ -0,0 +1,127 @@
+package masscan_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mikemrm/masscan-exporter/internal/masscan"
+	"github.com/mikemrm/masscan-exporter/internal/masscan/masscantest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// workDirs returns the work dirs created within tempDir.
+func workDirs(t *testing.T, tempDir string) []string {
+	t.Helper()
+
+	entries, err := os.ReadDir(tempDir)
+	require.NoError(t, err, "no error expected reading temp dir")
+
+	var dirs []string
+
+	for _, entry := range entries {
+		if entry.IsDir() && strings.HasPrefix(entry.Name(), "masscan-exporter-") {
+			dirs = append(dirs, filepath.Join(tempDir, entry.Name()))
+		}
+	}
+
+	return dirs
+}
+
+func TestMasscan_Run_TempFiles(t *testing.T) {
+	t.Parallel()
+
+	sim := masscantest.New(t, masscantest.Scenario{
+		Results: []masscan.RawResult{testResult("10.0.0.1", 80)},
+	})
+
+	tempDir := t.TempDir()
+
+	m, err := masscan.New(t.Context(), masscan.WithConfig(masscan.Config{
+		BinPath:  sim.Path(),
+		TempDir:  tempDir,
+		Config:   masscan.DynamicValue[string]{Value: "rate = 100\n"},
+		Ranges:   testRanges,
+		Ports:    testPorts,
+		Excludes: masscan.DynamicValue[[]string]{Value: []string{"10.0.0.5"}},
+	}))
+	require.NoError(t, err, "no error expected creating masscan")
+
+	_, err = m.Run(t.Context())
+	require.NoError(t, err, "no error expected running masscan")
+
+	dirs := workDirs(t, tempDir)
+	require.Len(t, dirs, 1, "expected a single work dir to be created")
+
+	info, err := os.Stat(dirs[0])
+	require.NoError(t, err, "no error expected reading work dir")
+
+	assert.Equal(t, os.FileMode(0700), info.Mode().Perm(), "expected work dir to only be accessible by the user")
+
+	invocations := sim.Invocations(t)
+	require.Len(t, invocations, 1, "expected masscan to be executed once")
+
+	assert.Equal(t, dirs[0], invocations[0].Dir, "expected masscan to run in the work dir")
+
+	for _, flag := range []string{"-c", "--excludefile", "--output-filename"} {
+		assert.Equal(t, os.FileMode(0600), invocations[0].Modes[flag], "expected %s file to only be readable by the user", flag)
+	}
+
+	entries, err := os.ReadDir(dirs[0])
+	require.NoError(t, err, "no error expected reading work dir")
+
+	for _, entry := range entries {
+		assert.Equal(t, ".lock", entry.Name(), "expected temp files to be removed after the run")
+	}
+
+	require.NoError(t, masscan.CleanTempDir(t.Context(), tempDir), "no error expected cleaning temp dir")
+
+	assert.DirExists(t, dirs[0], "expected the work dir of a running process to be kept")
+}
+
+func TestCleanTempDir(t *testing.T) {
+	t.Parallel()
+
+	tempDir := t.TempDir()
+
+	write := func(path string) string {
+		path = filepath.Join(tempDir, path)
+
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0700), "no error expected creating dir")
+		require.NoError(t, os.WriteFile(path, nil, 0600), "no error expected writing file")
+
+		return path
+	}
+
+	staleDir := filepath.Join(tempDir, "masscan-exporter-1")
+	staleFile := write("masscan-exporter-1/masscan-123.json")
+	write("masscan-exporter-1/.lock")
+
+	abandonedDir := filepath.Join(tempDir, "masscan-exporter-2")
+	write("masscan-exporter-2/masscan-456.conf")
+
+	old := time.Now().Add(-time.Hour)
+	require.NoError(t, os.Chtimes(abandonedDir, old, old), "no error expected changing dir times")
+
+	creatingDir := filepath.Join(tempDir, "masscan-exporter-3")
+	require.NoError(t, os.Mkdir(creatingDir, 0700), "no error expected creating dir")
+
+	legacyFile := write("masscan-0123456789abcdef.json")
+	resumeFile := write("masscan-resume/test/paused.conf")
+	otherFile := write("masscan-other.json")
+
+	require.NoError(t, masscan.CleanTempDir(t.Context(), tempDir), "no error expected cleaning temp dir")
+
+	assert.NoFileExists(t, staleFile, "expected files in stale work dir to be removed")
+	assert.NoDirExists(t, staleDir, "expected unlocked work dir to be removed")
+	assert.NoDirExists(t, abandonedDir, "expected old work dir without a lock to be removed")
+	assert.DirExists(t, creatingDir, "expected new work dir without a lock to be kept")
+	assert.NoFileExists(t, legacyFile, "expected temp file from previous versions to be removed")
+	assert.FileExists(t, resumeFile, "expected resume dir to be kept")
+	assert.FileExists(t, otherFile, "expected unrelated file to be kept")
+
+	require.NoError(t, masscan.CleanTempDir(t.Context(), filepath.Join(tempDir, "missing")), "no error expected for missing temp dir")
+}
@@ -0,0 +1,42 @@
+package scheduler
+
+type Config struct {
+	// MaxConcurrent is the number of scans which may run at the same time, the scheduler is disabled when 0.
+	MaxConcurrent int `mapstructure:"max_concurrent"`
+}
+
+func newConfig(opts ...Option) Config {
+	var cfg Config
+
+	for _, opt := range opts {
+		cfg = opt.apply(cfg)
+	}
+
+	return cfg
+}
+
+type Option interface {
+	apply(Config) Config
+}
+
+type optionFunc func(Config) Config
+
+func (fn optionFunc) apply(cfg Config) Config {
+	return fn(cfg)
+}
+
+// WithConfig replaces the existing Config.
+func WithConfig(cfg Config) Option {
+	return optionFunc(func(_ Config) Config {
+		return cfg
+	})
+}
+
+// WithMaxConcurrent sets the number of scans which may run at the same time.
+func WithMaxConcurrent(n int) Option {
+	return optionFunc(func(cfg Config) Config {
+		cfg.MaxConcurrent = n
+
+		return cfg
+	})
+}
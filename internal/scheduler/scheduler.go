@@ -0,0 +1,166 @@
+// Package scheduler limits the number of scans running at the same time across collectors.
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"sync"
+)
+
+var ErrMaxConcurrentRequired = errors.New("scheduler max concurrent required")
+
+// Scheduler runs up to a maximum number of scans concurrently, queueing the rest.
+//
+// Queued scans are started by priority, highest first. Scans of the same priority are started
+// in order of when their collector last started a scan, so a collector which scans often
+// can not starve others, and then in the order they were queued.
+type Scheduler struct {
+	cfg Config
+
+	mu        sync.Mutex
+	running   int
+	queue     []*request
+	starts    uint64
+	lastStart map[string]uint64
+}
+
+type request struct {
+	name     string
+	priority int
+	ready    chan struct{}
+}
+
+// Slot is a running scan, it must be released once the scan completes.
+type Slot struct {
+	scheduler *Scheduler
+	once      sync.Once
+}
+
+// Release frees the slot, starting the next queued scan.
+func (s *Slot) Release() {
+	s.once.Do(func() {
+		s.scheduler.mu.Lock()
+		defer s.scheduler.mu.Unlock()
+
+		s.scheduler.release()
+	})
+}
+
+// MaxConcurrent returns the number of scans which may run at the same time.
+func (s *Scheduler) MaxConcurrent() int {
+	return s.cfg.MaxConcurrent
+}
+
+// Running returns the number of scans running.
+func (s *Scheduler) Running() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.running
+}
+
+// Queued returns the number of scans waiting to start.
+func (s *Scheduler) Queued() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.queue)
+}
+
+// Acquire waits until the collector's scan may start.
+// If ctx is done before the scan starts, it is removed from the queue and ctx's error is returned.
+func (s *Scheduler) Acquire(ctx context.Context, name string, priority int) (*Slot, error) {
+	s.mu.Lock()
+
+	if len(s.queue) == 0 && s.running < s.cfg.MaxConcurrent {
+		s.start(name)
+
+		s.mu.Unlock()
+
+		return &Slot{scheduler: s}, nil
+	}
+
+	r := &request{
+		name:     name,
+		priority: priority,
+		ready:    make(chan struct{}),
+	}
+
+	s.queue = append(s.queue, r)
+
+	s.mu.Unlock()
+
+	select {
+	case <-r.ready:
+		return &Slot{scheduler: s}, nil
+	case <-ctx.Done():
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if i := slices.Index(s.queue, r); i != -1 {
+		s.queue = slices.Delete(s.queue, i, i+1)
+	} else {
+		// The scan was started after ctx was done.
+		s.release()
+	}
+
+	return nil, ctx.Err()
+}
+
+// start records a scan starting for the collector, s.mu must be held.
+func (s *Scheduler) start(name string) {
+	s.running++
+	s.starts++
+	s.lastStart[name] = s.starts
+}
+
+// release frees a running slot and starts queued scans, s.mu must be held.
+func (s *Scheduler) release() {
+	s.running--
+
+	for len(s.queue) != 0 && s.running < s.cfg.MaxConcurrent {
+		i := s.next()
+
+		r := s.queue[i]
+
+		s.queue = slices.Delete(s.queue, i, i+1)
+
+		s.start(r.name)
+
+		close(r.ready)
+	}
+}
+
+// next returns the index of the queued scan to start next, s.mu must be held.
+func (s *Scheduler) next() int {
+	best := 0
+
+	for i, r := range s.queue {
+		current := s.queue[best]
+
+		switch {
+		case r.priority > current.priority:
+			best = i
+		case r.priority == current.priority && s.lastStart[r.name] < s.lastStart[current.name]:
+			best = i
+		}
+	}
+
+	return best
+}
+
+func New(_ context.Context, opts ...Option) (*Scheduler, error) {
+	cfg := newConfig(opts...)
+
+	if cfg.MaxConcurrent <= 0 {
+		return nil, ErrMaxConcurrentRequired
+	}
+
+	return &Scheduler{
+		cfg:       cfg,
+		lastStart: make(map[string]uint64),
+	}, nil
+}
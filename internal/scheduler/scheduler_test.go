@@ -0,0 +1,103 @@
+package scheduler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// queue starts a goroutine acquiring a slot for the collector, sending its name once started.
+func queue(t *testing.T, s *Scheduler, started chan<- string, name string, priority int) {
+	t.Helper()
+
+	queued := s.Queued()
+
+	go func() {
+		slot, err := s.Acquire(context.Background(), name, priority)
+		assert.NoError(t, err, "no error expected acquiring slot")
+
+		started <- name
+
+		slot.Release()
+	}()
+
+	require.Eventually(t, func() bool { return s.Queued() == queued+1 }, time.Second, time.Millisecond, "expected scan to be queued")
+}
+
+func TestScheduler_Acquire(t *testing.T) {
+	t.Parallel()
+
+	s, err := New(t.Context(), WithMaxConcurrent(2))
+	require.NoError(t, err, "no error expected creating scheduler")
+
+	first, err := s.Acquire(t.Context(), "a", 0)
+	require.NoError(t, err, "no error expected acquiring slot")
+
+	second, err := s.Acquire(t.Context(), "b", 0)
+	require.NoError(t, err, "no error expected acquiring slot")
+
+	assert.Equal(t, 2, s.Running(), "expected two scans running")
+
+	ctx, cancel := context.WithTimeout(t.Context(), 20*time.Millisecond)
+	defer cancel()
+
+	_, err = s.Acquire(ctx, "c", 0)
+	require.ErrorIs(t, err, context.DeadlineExceeded, "expected scan to queue while the limit is reached")
+
+	assert.Equal(t, 0, s.Queued(), "expected cancelled scan to be removed from the queue")
+
+	first.Release()
+	first.Release()
+
+	assert.Equal(t, 1, s.Running(), "expected released slot to be freed once")
+
+	second.Release()
+
+	assert.Equal(t, 0, s.Running(), "expected no scans running")
+}
+
+func TestScheduler_Acquire_Order(t *testing.T) {
+	t.Parallel()
+
+	s, err := New(t.Context(), WithMaxConcurrent(1))
+	require.NoError(t, err, "no error expected creating scheduler")
+
+	// "frequent" has started a scan more recently than "rare".
+	for _, name := range []string{"rare", "frequent"} {
+		slot, err := s.Acquire(t.Context(), name, 0)
+		require.NoError(t, err, "no error expected acquiring slot")
+
+		slot.Release()
+	}
+
+	held, err := s.Acquire(t.Context(), "holder", 0)
+	require.NoError(t, err, "no error expected acquiring slot")
+
+	started := make(chan string, 4)
+
+	queue(t, s, started, "frequent", 0)
+	queue(t, s, started, "rare", 0)
+	queue(t, s, started, "new", 0)
+	queue(t, s, started, "important", 10)
+
+	held.Release()
+
+	var order []string
+
+	for range 4 {
+		order = append(order, <-started)
+	}
+
+	assert.Equal(t, []string{"important", "new", "rare", "frequent"}, order,
+		"expected higher priorities first, then collectors which started least recently")
+}
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+
+	_, err := New(t.Context())
+	require.ErrorIs(t, err, ErrMaxConcurrentRequired, "expected max concurrent to be required")
+}
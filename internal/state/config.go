@@ -0,0 +1,58 @@
+package state
+
+import "time"
+
+const (
+	DefaultRetention = 5
+)
+
+type Config struct {
+	// Dir is the directory reports are saved to, saving reports is disabled when empty.
+	Dir string `mapstructure:"dir"`
+
+	// Retention is the number of reports kept for each collector.
+	Retention int `mapstructure:"retention"`
+
+	// MaxAge removes reports older than the duration, the latest report is always kept.
+	MaxAge time.Duration `mapstructure:"max_age"`
+}
+
+func newConfig(opts ...Option) Config {
+	var cfg Config
+
+	for _, opt := range opts {
+		cfg = opt.apply(cfg)
+	}
+
+	if cfg.Retention <= 0 {
+		cfg.Retention = DefaultRetention
+	}
+
+	return cfg
+}
+
+type Option interface {
+	apply(Config) Config
+}
+
+type optionFunc func(Config) Config
+
+func (fn optionFunc) apply(cfg Config) Config {
+	return fn(cfg)
+}
+
+// WithConfig replaces the existing Config.
+func WithConfig(cfg Config) Option {
+	return optionFunc(func(_ Config) Config {
+		return cfg
+	})
+}
+
+// WithDir sets the directory reports are saved to.
+func WithDir(dir string) Option {
+	return optionFunc(func(cfg Config) Config {
+		cfg.Dir = dir
+
+		return cfg
+	})
+}
@@ -0,0 +1,185 @@
+// Package state persists completed scan reports so collectors can restore their metrics after a restart.
+package state
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mikemrm/masscan-exporter/internal/masscan"
+	"github.com/rs/zerolog"
+)
+
+const reportExt = ".json"
+
+var ErrDirRequired = errors.New("state dir required")
+
+// Entry is a saved report along with the collector bookkeeping at the time it completed.
+type Entry struct {
+	Start        time.Time      `json:"start"`
+	Duration     time.Duration  `json:"duration"`
+	TotalSuccess int            `json:"total_success"`
+	Report       masscan.Report `json:"report"`
+}
+
+// Store saves reports for each collector in a subdirectory of the state dir.
+type Store struct {
+	cfg Config
+}
+
+// Save writes the entry for the collector and removes reports outside of the retention.
+func (s *Store) Save(ctx context.Context, collector string, entry Entry) error {
+	dir := s.collectorDir(collector)
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failed to create state dir: %w", err)
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to encode report: %w", err)
+	}
+
+	path := filepath.Join(dir, strconv.FormatInt(entry.Start.UnixNano(), 10)+reportExt)
+
+	if err := os.WriteFile(path+".tmp", data, 0600); err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+
+	s.prune(ctx, dir)
+
+	return nil
+}
+
+// Latest returns the most recently started saved entry for the collector.
+// If no reports have been saved, nil is returned.
+// Reports which fail to load are skipped in favor of the next most recent.
+func (s *Store) Latest(ctx context.Context, collector string) (*Entry, error) {
+	logger := zerolog.Ctx(ctx)
+
+	dir := s.collectorDir(collector)
+
+	reports, err := listReports(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, report := range reports {
+		entry, err := loadEntry(filepath.Join(dir, report.name))
+		if err != nil {
+			logger.Warn().Err(err).Msgf("failed to load saved report %s", report.name)
+
+			continue
+		}
+
+		return entry, nil
+	}
+
+	return nil, nil
+}
+
+// prune removes reports beyond the retention count or older than the max age, the latest report is always kept.
+func (s *Store) prune(ctx context.Context, dir string) {
+	logger := zerolog.Ctx(ctx)
+
+	reports, err := listReports(dir)
+	if err != nil {
+		logger.Warn().Err(err).Msg("failed to list saved reports")
+
+		return
+	}
+
+	for i, report := range reports {
+		expired := s.cfg.MaxAge > 0 && time.Since(report.start) > s.cfg.MaxAge
+
+		if i == 0 || (i < s.cfg.Retention && !expired) {
+			continue
+		}
+
+		if err := os.Remove(filepath.Join(dir, report.name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			logger.Warn().Err(err).Msgf("failed to remove saved report %s", report.name)
+		}
+	}
+}
+
+func (s *Store) collectorDir(collector string) string {
+	return filepath.Join(s.cfg.Dir, url.PathEscape(collector))
+}
+
+type savedReport struct {
+	name  string
+	start time.Time
+}
+
+// listReports returns the saved reports in the directory, most recent first.
+func listReports(dir string) ([]savedReport, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("failed to read state dir: %w", err)
+	}
+
+	var reports []savedReport
+
+	for _, entry := range entries {
+		name := entry.Name()
+
+		nanos, err := strconv.ParseInt(strings.TrimSuffix(name, reportExt), 10, 64)
+		if entry.IsDir() || !strings.HasSuffix(name, reportExt) || err != nil {
+			continue
+		}
+
+		reports = append(reports, savedReport{
+			name:  name,
+			start: time.Unix(0, nanos),
+		})
+	}
+
+	slices.SortFunc(reports, func(a, b savedReport) int {
+		return b.start.Compare(a.start)
+	})
+
+	return reports, nil
+}
+
+func loadEntry(path string) (*Entry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var entry Entry
+
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, fmt.Errorf("failed to decode report: %w", err)
+	}
+
+	return &entry, nil
+}
+
+func New(_ context.Context, opts ...Option) (*Store, error) {
+	cfg := newConfig(opts...)
+
+	if cfg.Dir == "" {
+		return nil, ErrDirRequired
+	}
+
+	return &Store{
+		cfg: cfg,
+	}, nil
+}
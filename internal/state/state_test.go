@@ -0,0 +1,110 @@
+package state
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mikemrm/masscan-exporter/internal/masscan"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testEntry(start time.Time, ip string) Entry {
+	return Entry{
+		Start:        start,
+		Duration:     time.Minute,
+		TotalSuccess: 1,
+		Report: masscan.Report{
+			Ranges: []string{"10.0.0.0/24"},
+			Results: map[string]masscan.Results{
+				ip: {
+					IP:    ip,
+					Ports: masscan.Ports{{Port: 80, Proto: "tcp", Status: "open", Reason: "syn-ack"}},
+				},
+			},
+		},
+	}
+}
+
+func TestStore_Latest(t *testing.T) {
+	t.Parallel()
+
+	store, err := New(t.Context(), WithDir(t.TempDir()))
+	require.NoError(t, err, "no error expected creating store")
+
+	entry, err := store.Latest(t.Context(), "test")
+	require.NoError(t, err, "no error expected when no reports are saved")
+	assert.Nil(t, entry, "expected no entry when no reports are saved")
+
+	start := time.Now().Add(-time.Hour).Truncate(time.Second)
+
+	require.NoError(t, store.Save(t.Context(), "test", testEntry(start.Add(time.Minute), "10.0.0.2")), "no error expected saving report")
+	require.NoError(t, store.Save(t.Context(), "test", testEntry(start, "10.0.0.1")), "no error expected saving report")
+	require.NoError(t, store.Save(t.Context(), "other", testEntry(start.Add(time.Hour), "10.0.0.3")), "no error expected saving report")
+
+	entry, err = store.Latest(t.Context(), "test")
+	require.NoError(t, err, "no error expected loading latest report")
+	require.NotNil(t, entry, "expected latest entry")
+
+	assert.True(t, start.Add(time.Minute).Equal(entry.Start), "expected most recently started report")
+	assert.Equal(t, time.Minute, entry.Duration, "unexpected duration")
+	assert.Contains(t, entry.Report.Results, "10.0.0.2", "unexpected report results")
+}
+
+func TestStore_Latest_Corrupt(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	store, err := New(t.Context(), WithDir(dir))
+	require.NoError(t, err, "no error expected creating store")
+
+	start := time.Now().Add(-time.Hour)
+
+	require.NoError(t, store.Save(t.Context(), "test", testEntry(start, "10.0.0.1")), "no error expected saving report")
+
+	corrupt := filepath.Join(dir, "test", "99999999999999999.json")
+
+	require.NoError(t, os.WriteFile(corrupt, []byte("{"), 0600), "no error expected writing corrupt report")
+
+	entry, err := store.Latest(t.Context(), "test")
+	require.NoError(t, err, "no error expected loading latest report")
+	require.NotNil(t, entry, "expected corrupt report to be skipped")
+
+	assert.Contains(t, entry.Report.Results, "10.0.0.1", "unexpected report results")
+}
+
+func TestStore_Save_Retention(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	store, err := New(t.Context(), WithConfig(Config{
+		Dir:       dir,
+		Retention: 3,
+		MaxAge:    90 * time.Minute,
+	}))
+	require.NoError(t, err, "no error expected creating store")
+
+	now := time.Now()
+
+	for _, age := range []time.Duration{4 * time.Hour, 3 * time.Hour, time.Hour, 30 * time.Minute, 10 * time.Minute} {
+		require.NoError(t, store.Save(t.Context(), "test", testEntry(now.Add(-age), "10.0.0.1")), "no error expected saving report")
+	}
+
+	reports, err := listReports(filepath.Join(dir, "test"))
+	require.NoError(t, err, "no error expected listing reports")
+
+	require.Len(t, reports, 3, "expected reports beyond the retention and max age to be removed")
+	assert.True(t, now.Add(-10*time.Minute).Equal(reports[0].start), "expected latest report to be kept")
+	assert.True(t, now.Add(-time.Hour).Equal(reports[2].start), "expected oldest kept report within max age")
+}
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+
+	_, err := New(t.Context())
+	require.ErrorIs(t, err, ErrDirRequired, "expected dir required error")
+}